@@ -0,0 +1,295 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ogefest/findex/models"
+)
+
+// attachPrevious opens a connection to db with the database at prevPath
+// attached as "prev". ATTACH is per connection, so all statements that read
+// prev must go through the returned connection; close it with
+// detachPrevious.
+func attachPrevious(ctx context.Context, db *sql.DB, prevPath string) (*sql.Conn, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.ExecContext(ctx, `ATTACH DATABASE ? AS prev`, prevPath); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+func detachPrevious(conn *sql.Conn) {
+	conn.ExecContext(context.Background(), `DETACH DATABASE prev`)
+	conn.Close()
+}
+
+// carryOverHistory copies the scan history and the change journal of the
+// database at prevPath into db, which starts empty on every scan
+func carryOverHistory(ctx context.Context, db *sql.DB, prevPath string) error {
+	if _, err := os.Stat(prevPath); os.IsNotExist(err) {
+		return nil
+	}
+
+	conn, err := attachPrevious(ctx, db, prevPath)
+	if err != nil {
+		return err
+	}
+	defer detachPrevious(conn)
+
+	if _, err := conn.ExecContext(ctx, `
+		INSERT INTO main.scan_history (id, scan_time, stats_json)
+		SELECT id, scan_time, stats_json FROM prev.scan_history
+	`); err != nil {
+		return err
+	}
+	_, err = conn.ExecContext(ctx, `
+		INSERT INTO main.changes (scan_id, kind, dir, name, old_dir, size, old_size, mod_time, old_mod_time)
+		SELECT scan_id, kind, dir, name, old_dir, size, old_size, mod_time, old_mod_time FROM prev.changes
+	`)
+	return err
+}
+
+// recordChanges compares the files of db with the database at prevPath and
+// journals the differences under the newest scan_history entry of db. The
+// first scan of an index has nothing to compare with and records no changes.
+//
+// Only files are journaled. A file is moved when a removed and an added file
+// share name, size and modification time; several candidates are paired one
+// to one in directory order.
+func recordChanges(ctx context.Context, db *sql.DB, prevPath string) (models.ChangeSummary, error) {
+	var summary models.ChangeSummary
+	if _, err := os.Stat(prevPath); os.IsNotExist(err) {
+		return summary, nil
+	}
+
+	conn, err := attachPrevious(ctx, db, prevPath)
+	if err != nil {
+		return summary, err
+	}
+	defer detachPrevious(conn)
+
+	// Changes of scans that dropped out of the history go with them
+	if _, err := conn.ExecContext(ctx, `DELETE FROM main.changes WHERE scan_id NOT IN (SELECT id FROM main.scan_history)`); err != nil {
+		return summary, err
+	}
+
+	var scanID, prevScanID, prevFiles int64
+	if err := conn.QueryRowContext(ctx, `SELECT COALESCE(MAX(id), 0) FROM main.scan_history`).Scan(&scanID); err != nil {
+		return summary, err
+	}
+	if err := conn.QueryRowContext(ctx, `SELECT COALESCE(MAX(id), 0) FROM prev.scan_history`).Scan(&prevScanID); err != nil {
+		return summary, err
+	}
+	if scanID <= prevScanID {
+		return summary, fmt.Errorf("no scan history entry for this scan")
+	}
+	if err := conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM prev.files WHERE is_dir = 0`).Scan(&prevFiles); err != nil {
+		return summary, err
+	}
+	summary.ScanID = scanID
+	if prevFiles == 0 {
+		return summary, nil
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return summary, err
+	}
+	defer tx.Rollback()
+
+	statements := []sqlStatement{
+		{query: `
+			CREATE TEMP TABLE change_added AS
+			SELECT d.path AS dir, f.name, f.size, f.mod_time
+			FROM main.files f
+			JOIN main.dirs d ON d.id = f.parent_id
+			WHERE f.is_dir = 0 AND NOT EXISTS (
+				SELECT 1 FROM prev.dirs pd
+				JOIN prev.files pf ON pf.parent_id = pd.id
+				WHERE pd.path = d.path AND pf.name = f.name AND pf.is_dir = 0
+			)`},
+		{query: `
+			CREATE TEMP TABLE change_removed AS
+			SELECT pd.path AS dir, pf.name, pf.size, pf.mod_time
+			FROM prev.files pf
+			JOIN prev.dirs pd ON pd.id = pf.parent_id
+			WHERE pf.is_dir = 0 AND NOT EXISTS (
+				SELECT 1 FROM main.dirs d
+				JOIN main.files f ON f.parent_id = d.id
+				WHERE d.path = pd.path AND f.name = pf.name AND f.is_dir = 0
+			)`},
+		{query: `
+			CREATE TEMP TABLE change_moved AS
+			WITH r AS (
+				SELECT rowid AS rid, name, size, mod_time,
+				       ROW_NUMBER() OVER (PARTITION BY name, size, mod_time ORDER BY dir) AS n
+				FROM change_removed
+			), a AS (
+				SELECT rowid AS aid, name, size, mod_time,
+				       ROW_NUMBER() OVER (PARTITION BY name, size, mod_time ORDER BY dir) AS n
+				FROM change_added
+			)
+			SELECT r.rid, a.aid
+			FROM r JOIN a ON a.name = r.name AND a.size = r.size AND a.mod_time = r.mod_time AND a.n = r.n`},
+		{query: `
+			INSERT INTO main.changes (scan_id, kind, dir, name, old_dir, size, old_size, mod_time, old_mod_time)
+			SELECT ?, ?, a.dir, a.name, r.dir, a.size, r.size, a.mod_time, r.mod_time
+			FROM change_moved m
+			JOIN change_added a ON a.rowid = m.aid
+			JOIN change_removed r ON r.rowid = m.rid`,
+			args: []any{scanID, models.ChangeMoved}},
+		{query: `
+			INSERT INTO main.changes (scan_id, kind, dir, name, size, mod_time)
+			SELECT ?, ?, dir, name, size, mod_time
+			FROM change_added WHERE rowid NOT IN (SELECT aid FROM change_moved)`,
+			args: []any{scanID, models.ChangeAdded}},
+		{query: `
+			INSERT INTO main.changes (scan_id, kind, dir, name, old_size, old_mod_time)
+			SELECT ?, ?, dir, name, size, mod_time
+			FROM change_removed WHERE rowid NOT IN (SELECT rid FROM change_moved)`,
+			args: []any{scanID, models.ChangeRemoved}},
+		{query: `
+			INSERT INTO main.changes (scan_id, kind, dir, name, size, old_size, mod_time, old_mod_time)
+			SELECT ?, ?, d.path, f.name, f.size, pf.size, f.mod_time, pf.mod_time
+			FROM main.files f
+			JOIN main.dirs d ON d.id = f.parent_id
+			JOIN prev.dirs pd ON pd.path = d.path
+			JOIN prev.files pf ON pf.parent_id = pd.id AND pf.name = f.name
+			WHERE f.is_dir = 0 AND pf.is_dir = 0 AND (f.size != pf.size OR f.mod_time != pf.mod_time)`,
+			args: []any{scanID, models.ChangeModified}},
+		{query: `DROP TABLE temp.change_moved`},
+		{query: `DROP TABLE temp.change_added`},
+		{query: `DROP TABLE temp.change_removed`},
+	}
+	for _, stmt := range statements {
+		if _, err := tx.ExecContext(ctx, stmt.query, stmt.args...); err != nil {
+			return summary, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return summary, err
+	}
+
+	err = loadChangeCounts(conn.QueryRowContext(ctx, changeCountsQuery+` WHERE scan_id = ?`, changeCountsArgs(scanID)...), &summary)
+	return summary, err
+}
+
+// sqlStatement is one step of a multi-statement update
+type sqlStatement struct {
+	query string
+	args  []any
+}
+
+// changeCountsQuery counts the changes per kind, the args are
+// changeCountsArgs
+const changeCountsQuery = `
+	SELECT COUNT(CASE WHEN kind = ? THEN 1 END), COUNT(CASE WHEN kind = ? THEN 1 END),
+	       COUNT(CASE WHEN kind = ? THEN 1 END), COUNT(CASE WHEN kind = ? THEN 1 END)
+	FROM changes`
+
+func changeCountsArgs(extra ...any) []any {
+	return append([]any{models.ChangeAdded, models.ChangeRemoved, models.ChangeModified, models.ChangeMoved}, extra...)
+}
+
+func loadChangeCounts(row rowScanner, c *models.ChangeSummary) error {
+	return row.Scan(&c.Added, &c.Removed, &c.Modified, &c.Moved)
+}
+
+// GetChangeSummaries returns the change counts of the last scans of an
+// index, newest first
+func (s *Searcher) GetChangeSummaries(indexName string, limit int) ([]models.ChangeSummary, error) {
+	db := s.dbs[indexName]
+	if db == nil {
+		return nil, fmt.Errorf("index not found: %s", indexName)
+	}
+
+	rows, err := db.Query(`SELECT id, scan_time FROM scan_history ORDER BY scan_time DESC, id DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	var result []models.ChangeSummary
+	for rows.Next() {
+		var c models.ChangeSummary
+		var scanTime int64
+		if err := rows.Scan(&c.ScanID, &scanTime); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		c.ScanTime = time.Unix(scanTime, 0)
+		result = append(result, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range result {
+		row := db.QueryRow(changeCountsQuery+` WHERE scan_id = ?`, changeCountsArgs(result[i].ScanID)...)
+		if err := loadChangeCounts(row, &result[i]); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// GetChanges returns up to limit changes recorded by a scan, all kinds when
+// kind is empty
+func (s *Searcher) GetChanges(indexName string, scanID int64, kind string, limit int) ([]models.FileChange, error) {
+	db := s.dbs[indexName]
+	if db == nil {
+		return nil, fmt.Errorf("index not found: %s", indexName)
+	}
+
+	query := `
+		SELECT kind, dir, name, COALESCE(old_dir, ''), COALESCE(size, 0), COALESCE(old_size, 0),
+		       COALESCE(mod_time, 0), COALESCE(old_mod_time, 0)
+		FROM changes
+		WHERE scan_id = ?`
+	args := []any{scanID}
+	if kind != "" {
+		query += ` AND kind = ?`
+		args = append(args, kind)
+	}
+	query += ` ORDER BY kind, dir, name LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []models.FileChange
+	for rows.Next() {
+		var c models.FileChange
+		var dir, name, oldDir string
+		var modTime, oldModTime int64
+		if err := rows.Scan(&c.Kind, &dir, &name, &oldDir, &c.Size, &c.OldSize, &modTime, &oldModTime); err != nil {
+			return nil, err
+		}
+		c.Path = entryPath(dir, name)
+		if oldDir != "" {
+			c.OldPath = entryPath(oldDir, name)
+		}
+		c.ModTime = unixTime(modTime)
+		c.OldModTime = unixTime(oldModTime)
+		result = append(result, c)
+	}
+	return result, rows.Err()
+}
+
+// unixTime converts a stored timestamp, keeping 0 as the zero time
+func unixTime(sec int64) time.Time {
+	if sec == 0 {
+		return time.Time{}
+	}
+	return time.Unix(sec, 0)
+}
@@ -0,0 +1,116 @@
+package app
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ogefest/findex/models"
+)
+
+func TestScanIndexes_RecordsChanges(t *testing.T) {
+	fx := setupScanFixture(t, map[string]string{
+		"keep.txt":   "same",
+		"grow.txt":   "small",
+		"gone.txt":   "bye",
+		"a/move.bin": "moving",
+	}, "log_retention_days: 1")
+	dataDir := fx.dataDir
+	fx.scan(t)
+
+	fx.write(t, "grow.txt", "much bigger now")
+	fx.write(t, "new.txt", "hello")
+	if err := os.Remove(filepath.Join(dataDir, "gone.txt")); err != nil {
+		t.Fatalf("failed to remove file: %v", err)
+	}
+	// Rename keeps size and mtime, so this is a move
+	if err := os.MkdirAll(filepath.Join(dataDir, "b"), 0755); err != nil {
+		t.Fatalf("failed to create dir: %v", err)
+	}
+	if err := os.Rename(filepath.Join(dataDir, "a", "move.bin"), filepath.Join(dataDir, "b", "move.bin")); err != nil {
+		t.Fatalf("failed to move file: %v", err)
+	}
+	fx.scan(t)
+
+	searcher := createSearcher(t, fx.dbPath, "test-index")
+	defer searcher.Close()
+
+	scans, err := searcher.GetChangeSummaries("test-index", 10)
+	if err != nil {
+		t.Fatalf("GetChangeSummaries failed: %v", err)
+	}
+
+	t.Run("history survives the database swap", func(t *testing.T) {
+		if len(scans) != 2 {
+			t.Fatalf("expected 2 scans, got %d", len(scans))
+		}
+		if scans[1].Total() != 0 {
+			t.Errorf("first scan should record no changes, got %+v", scans[1])
+		}
+	})
+
+	t.Run("counts per kind", func(t *testing.T) {
+		latest := scans[0]
+		if latest.Added != 1 || latest.Removed != 1 || latest.Modified != 1 || latest.Moved != 1 {
+			t.Errorf("expected one change of each kind, got %+v", latest)
+		}
+	})
+
+	t.Run("changed files", func(t *testing.T) {
+		changes, err := searcher.GetChanges("test-index", scans[0].ScanID, "", 100)
+		if err != nil {
+			t.Fatalf("GetChanges failed: %v", err)
+		}
+
+		got := make(map[string]models.FileChange)
+		for _, c := range changes {
+			got[c.Kind] = c
+		}
+		if c := got[models.ChangeAdded]; c.Path != filepath.Join(dataDir, "new.txt") {
+			t.Errorf("unexpected added file: %+v", c)
+		}
+		if c := got[models.ChangeRemoved]; c.Path != filepath.Join(dataDir, "gone.txt") || c.OldSize != 3 {
+			t.Errorf("unexpected removed file: %+v", c)
+		}
+		if c := got[models.ChangeModified]; c.Path != filepath.Join(dataDir, "grow.txt") || c.OldSize != 5 || c.Size != 15 {
+			t.Errorf("unexpected modified file: %+v", c)
+		}
+		if c := got[models.ChangeMoved]; c.Path != filepath.Join(dataDir, "b", "move.bin") || c.OldPath != filepath.Join(dataDir, "a", "move.bin") {
+			t.Errorf("unexpected moved file: %+v", c)
+		}
+	})
+
+	t.Run("filter by kind", func(t *testing.T) {
+		changes, err := searcher.GetChanges("test-index", scans[0].ScanID, models.ChangeRemoved, 100)
+		if err != nil {
+			t.Fatalf("GetChanges failed: %v", err)
+		}
+		if len(changes) != 1 || changes[0].Kind != models.ChangeRemoved {
+			t.Errorf("expected only the removed file, got %+v", changes)
+		}
+	})
+
+	t.Run("diff output", func(t *testing.T) {
+		var out bytes.Buffer
+		if err := Diff(&out, fx.configPath, "", 0, ""); err != nil {
+			t.Fatalf("Diff failed: %v", err)
+		}
+		for _, expected := range []string{
+			"1 added, 1 removed, 1 modified, 1 moved",
+			"+ " + filepath.Join(dataDir, "new.txt"),
+			"- " + filepath.Join(dataDir, "gone.txt"),
+			"M " + filepath.Join(dataDir, "grow.txt") + " (5 -> 15 bytes)",
+			"R " + filepath.Join(dataDir, "a", "move.bin") + " -> " + filepath.Join(dataDir, "b", "move.bin"),
+		} {
+			if !strings.Contains(out.String(), expected) {
+				t.Errorf("diff output should contain %q, got:\n%s", expected, out.String())
+			}
+		}
+
+		if err := Diff(&out, fx.configPath, "", 0, "renamed"); err == nil {
+			t.Error("expected an error for an unknown kind")
+		}
+	})
+}
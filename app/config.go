@@ -1,6 +1,11 @@
 package app
 
 import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
 	"github.com/ogefest/findex/models"
 
 	"github.com/spf13/viper"
@@ -22,3 +27,113 @@ func LoadConfig(path string) (*models.AppConfig, error) {
 
 	return &cfg, nil
 }
+
+// RootOptions holds the walk limits applied to a single root. Zero values
+// mean "no limit".
+type RootOptions struct {
+	IncludePatterns []string
+	MaxDepth        int
+	MinFileSize     int64
+	MaxFileSize     int64
+	SkipHidden      bool
+}
+
+// ResolveRoots returns every root of an index (root_paths followed by roots)
+// together with its effective options, index-level values being overridden
+// by the per-root ones.
+func ResolveRoots(idx models.IndexConfig) ([]string, map[string]RootOptions, error) {
+	defaults := RootOptions{
+		IncludePatterns: idx.IncludePatterns,
+		MaxDepth:        idx.MaxDepth,
+		SkipHidden:      idx.SkipHidden,
+	}
+	var err error
+	if defaults.MinFileSize, err = ParseSize(idx.MinFileSize); err != nil {
+		return nil, nil, fmt.Errorf("invalid min_file_size %q: %w", idx.MinFileSize, err)
+	}
+	if defaults.MaxFileSize, err = ParseSize(idx.MaxFileSize); err != nil {
+		return nil, nil, fmt.Errorf("invalid max_file_size %q: %w", idx.MaxFileSize, err)
+	}
+
+	var roots []string
+	options := make(map[string]RootOptions)
+	for _, p := range idx.RootPaths {
+		clean := filepath.Clean(p)
+		roots = append(roots, clean)
+		options[clean] = defaults
+	}
+
+	for _, rc := range idx.Roots {
+		if rc.Path == "" {
+			return nil, nil, fmt.Errorf("root without path")
+		}
+		opts := defaults
+		if len(rc.IncludePatterns) > 0 {
+			opts.IncludePatterns = rc.IncludePatterns
+		}
+		if rc.MaxDepth != 0 {
+			opts.MaxDepth = rc.MaxDepth
+		}
+		if rc.MinFileSize != "" {
+			if opts.MinFileSize, err = ParseSize(rc.MinFileSize); err != nil {
+				return nil, nil, fmt.Errorf("invalid min_file_size %q for root %s: %w", rc.MinFileSize, rc.Path, err)
+			}
+		}
+		if rc.MaxFileSize != "" {
+			if opts.MaxFileSize, err = ParseSize(rc.MaxFileSize); err != nil {
+				return nil, nil, fmt.Errorf("invalid max_file_size %q for root %s: %w", rc.MaxFileSize, rc.Path, err)
+			}
+		}
+		if rc.SkipHidden != nil {
+			opts.SkipHidden = *rc.SkipHidden
+		}
+
+		clean := filepath.Clean(rc.Path)
+		if _, exists := options[clean]; !exists {
+			roots = append(roots, clean)
+		}
+		options[clean] = opts
+	}
+
+	for root, opts := range options {
+		if _, err := newPatternRules(root, "include_patterns", opts.IncludePatterns); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return roots, options, nil
+}
+
+// ParseSize parses size string like "10MB", "1GB", "500KB" to bytes
+func ParseSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if s == "" {
+		return 0, nil
+	}
+
+	// Order matters - check longer suffixes first
+	suffixes := []struct {
+		suffix string
+		mult   int64
+	}{
+		{"TB", 1024 * 1024 * 1024 * 1024},
+		{"GB", 1024 * 1024 * 1024},
+		{"MB", 1024 * 1024},
+		{"KB", 1024},
+		{"B", 1},
+	}
+
+	for _, s2 := range suffixes {
+		if strings.HasSuffix(s, s2.suffix) {
+			numStr := strings.TrimSuffix(s, s2.suffix)
+			num, err := strconv.ParseFloat(numStr, 64)
+			if err != nil {
+				return 0, err
+			}
+			return int64(num * float64(s2.mult)), nil
+		}
+	}
+
+	// Try plain number (assume bytes)
+	return strconv.ParseInt(s, 10, 64)
+}
@@ -0,0 +1,125 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ogefest/findex/models"
+)
+
+func TestResolveRoots(t *testing.T) {
+	skip := false
+	idx := models.IndexConfig{
+		Name:            "media",
+		RootPaths:       []string{"/mnt/a/", "/mnt/b"},
+		IncludePatterns: []string{"*.mkv", "*.mp4"},
+		MaxDepth:        3,
+		MinFileSize:     "1MB",
+		SkipHidden:      true,
+		Roots: []models.RootConfig{
+			{Path: "/mnt/b", MaxDepth: 1, MaxFileSize: "4GB", SkipHidden: &skip},
+			{Path: "/mnt/c", IncludePatterns: []string{"*.flac"}},
+		},
+	}
+
+	roots, options, err := ResolveRoots(idx)
+	if err != nil {
+		t.Fatalf("ResolveRoots failed: %v", err)
+	}
+
+	expectedRoots := []string{"/mnt/a", "/mnt/b", "/mnt/c"}
+	if len(roots) != len(expectedRoots) {
+		t.Fatalf("expected roots %v, got %v", expectedRoots, roots)
+	}
+	for i, r := range expectedRoots {
+		if roots[i] != r {
+			t.Errorf("root %d: expected %s, got %s", i, r, roots[i])
+		}
+	}
+
+	a := options["/mnt/a"]
+	if a.MaxDepth != 3 || a.MinFileSize != 1024*1024 || a.MaxFileSize != 0 || !a.SkipHidden || len(a.IncludePatterns) != 2 {
+		t.Errorf("unexpected options for /mnt/a: %+v", a)
+	}
+
+	b := options["/mnt/b"]
+	if b.MaxDepth != 1 || b.MaxFileSize != 4*1024*1024*1024 || b.SkipHidden || b.MinFileSize != 1024*1024 {
+		t.Errorf("unexpected options for /mnt/b: %+v", b)
+	}
+
+	c := options["/mnt/c"]
+	if len(c.IncludePatterns) != 1 || c.IncludePatterns[0] != "*.flac" || c.MaxDepth != 3 {
+		t.Errorf("unexpected options for /mnt/c: %+v", c)
+	}
+}
+
+func TestResolveRoots_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		idx  models.IndexConfig
+	}{
+		{"invalid index size", models.IndexConfig{RootPaths: []string{"/a"}, MinFileSize: "lots"}},
+		{"invalid root size", models.IndexConfig{Roots: []models.RootConfig{{Path: "/a", MaxFileSize: "x"}}}},
+		{"root without path", models.IndexConfig{Roots: []models.RootConfig{{MaxDepth: 2}}}},
+		{"invalid include pattern", models.IndexConfig{RootPaths: []string{"/a"}, IncludePatterns: []string{"[abc"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := ResolveRoots(tt.idx); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestLocalSourceWalk_RootOptions(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	files := map[string]int{
+		"movie.mkv":               2048,
+		"small.mkv":               10,
+		"notes.txt":               2048,
+		".hidden.mkv":             2048,
+		"season1/episode1.mkv":    2048,
+		"season1/deep/extra.mkv":  2048,
+		".cache/thumbs/thumb.mkv": 2048,
+	}
+	for rel, size := range files {
+		full := filepath.Join(tmpDir, rel)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatalf("failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(full, make([]byte, size), 0644); err != nil {
+			t.Fatalf("failed to create file: %v", err)
+		}
+	}
+
+	source := NewLocalSource("test-index", []string{tmpDir}, nil, 2, false, nil)
+	source.RootOptions = map[string]RootOptions{
+		filepath.Clean(tmpDir): {
+			IncludePatterns: []string{"*.mkv"},
+			MaxDepth:        2,
+			MinFileSize:     1024,
+			SkipHidden:      true,
+		},
+	}
+
+	found := make(map[string]bool)
+	for f := range source.Walk() {
+		rel, _ := filepath.Rel(tmpDir, f.Path)
+		found[filepath.ToSlash(rel)] = true
+	}
+
+	for _, p := range []string{"movie.mkv", "season1", "season1/episode1.mkv", "season1/deep"} {
+		if !found[p] {
+			t.Errorf("expected %s to be indexed", p)
+		}
+	}
+	for _, p := range []string{"small.mkv", "notes.txt", ".hidden.mkv", ".cache", "season1/deep/extra.mkv", ".cache/thumbs/thumb.mkv"} {
+		if found[p] {
+			t.Errorf("expected %s to be skipped", p)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package app
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/ogefest/findex/models"
+)
+
+// ErrInvalidCursor is returned by SearchPage for a cursor it did not write
+var ErrInvalidCursor = errors.New("invalid page cursor")
+
+// cursor is the position of a hit in the order of a search: its sort keys
+// and the index, table and id that break ties between equal keys. Pages
+// continue from it with a WHERE on the keys instead of an OFFSET, which an
+// index on the sort column answers without reading the pages before.
+type cursor struct {
+	Score   float64 `json:"s,omitempty"`
+	Name    string  `json:"n,omitempty"`
+	Dir     string  `json:"d,omitempty"`
+	Size    int64   `json:"z,omitempty"`
+	ModTime int64   `json:"m,omitempty"`
+	DB      string  `json:"i,omitempty"`
+	Deleted bool    `json:"x,omitempty"`
+	ID      int64   `json:"id"`
+	Before  bool    `json:"b,omitempty"` // the page ends before the hit
+}
+
+// cursorAt returns the cursor of h, keeping the name and directory only
+// when the sort reads them
+func cursorAt(h *searchHit, sort string, before bool) *cursor {
+	c := &cursor{
+		Score: h.score, Size: h.Size, ModTime: h.ModTime.Unix(),
+		DB: h.db, Deleted: h.Deleted, ID: h.ID, Before: before,
+	}
+	switch sort {
+	case SortName:
+		c.Name = h.Name
+	case SortPath:
+		c.Dir, c.Name = h.dir, h.Name
+	}
+	return c
+}
+
+// hit returns a hit at the position of the cursor, for hitLess
+func (c *cursor) hit() *searchHit {
+	return &searchHit{
+		FileRecord: models.FileRecord{ID: c.ID, Name: c.Name, Size: c.Size, ModTime: time.Unix(c.ModTime, 0), Deleted: c.Deleted},
+		score:      c.Score,
+		db:         c.DB,
+		dir:        c.Dir,
+	}
+}
+
+func (c *cursor) String() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// parseCursor reads a cursor written by cursor.String, nil for an empty one
+func parseCursor(s string) (*cursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c cursor
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// keysetCondition adds to where the condition selecting the rows after c in
+// the order of filter, for the files or tombstones of the index db. Rows of
+// the table of the cursor tie on their id, the others on their table.
+func keysetCondition(where *sqlWhere, filter *FileFilter, cols sortColumns, c *cursor, db string, deleted bool) {
+	keys, values := sortKeys(filter, cols, c)
+	table := compareTable(db, deleted, c.DB, c.Deleted)
+	op := ">"
+	if filter.SortDesc {
+		op = "<"
+	}
+	// Implied by the row value below, but SQLite only seeks an index on the
+	// collated name with a plain comparison
+	where.add(keys[0]+" "+op+"= ?", values[0])
+	if table == 0 {
+		keys = append(keys, "f.id")
+		values = append(values, c.ID)
+	} else if (table > 0) != filter.SortDesc {
+		// Equal keys of this table come after the cursor
+		op += "="
+	}
+	where.add("("+strings.Join(keys, ", ")+") "+op+" ("+strings.TrimSuffix(strings.Repeat("?, ", len(keys)), ", ")+")", values...)
+}
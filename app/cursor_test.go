@@ -0,0 +1,162 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ogefest/findex/models"
+)
+
+// createPagedSearcher creates two indexes whose files tie on size and time,
+// with tombstones in the first
+func createPagedSearcher(t *testing.T) *Searcher {
+	t.Helper()
+
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var configs []*models.IndexConfig
+	for _, name := range []string{"first", "second"} {
+		db, dbPath, cleanup := setupTestDB(t)
+		t.Cleanup(cleanup)
+		for i := 0; i < 20; i++ {
+			file := fmt.Sprintf("Track %02d.mp3", i)
+			dir := []string{"music/live", "music/studio"}[i%2]
+			if i%7 == 0 {
+				// A path match only
+				file, dir = fmt.Sprintf("%s %02d.mp3", name, i), "music/track"
+			}
+			insertTestFile(t, db, models.FileRecord{
+				IndexName: name, Path: dir + "/" + file, Name: file, Ext: ".mp3",
+				Size: int64(i % 4), ModTime: base.Add(time.Duration(i%5) * time.Hour),
+			})
+		}
+		if name == "first" {
+			for i := 0; i < 5; i++ {
+				res, err := db.Exec(`INSERT INTO tombstones (index_name, dir, name, ext, size, mod_time, last_seen) VALUES (?, 'music/old', ?, '.mp3', ?, ?, 1)`,
+					name, fmt.Sprintf("track gone %d.mp3", i), i%4, base.Add(time.Duration(i%5)*time.Hour).Unix())
+				if err != nil {
+					t.Fatalf("failed to insert tombstone: %v", err)
+				}
+				id, _ := res.LastInsertId()
+				db.Exec(`INSERT INTO tombstones_fts(rowid, name, dir) VALUES (?, ?, 'music/old')`, id, fmt.Sprintf("track gone %d.mp3", i))
+			}
+		}
+		configs = append(configs, &models.IndexConfig{Name: name, DBPath: dbPath})
+	}
+
+	searcher, err := NewSearcher(configs)
+	if err != nil {
+		t.Fatalf("NewSearcher failed: %v", err)
+	}
+	t.Cleanup(searcher.Close)
+	return searcher
+}
+
+func pageKeys(results []models.FileRecord) []string {
+	var keys []string
+	for _, f := range results {
+		keys = append(keys, fmt.Sprintf("%s:%s:%v", f.IndexName, f.Path, f.Deleted))
+	}
+	return keys
+}
+
+// Paging forward and back through a search visits every result of Search
+// once, in the same order
+func TestSearchPage_WalksAllResults(t *testing.T) {
+	searcher := createPagedSearcher(t)
+
+	for _, query := range []string{"", "track"} {
+		for _, sort := range []struct {
+			by   string
+			desc bool
+		}{
+			{SortRelevance, false}, {SortName, false}, {SortName, true}, {SortSize, true},
+			{SortSize, false}, {SortModified, true}, {SortModified, false}, {SortPath, false},
+		} {
+			t.Run(fmt.Sprintf("%q %s %v", query, sort.by, sort.desc), func(t *testing.T) {
+				filter := &FileFilter{Exts: []string{"mp3"}, IncludeDeleted: true, Sort: sort.by, SortDesc: sort.desc}
+				all, err := searcher.Search(query, filter, 1000)
+				if err != nil {
+					t.Fatalf("Search failed: %v", err)
+				}
+				if len(all) != 45 {
+					t.Fatalf("expected 45 results, got %d", len(all))
+				}
+
+				count, err := searcher.Count(context.Background(), query, filter)
+				if err != nil || count.Total != 45 || !count.Exact {
+					t.Errorf("Count = %+v (%v), expected 45 exact", count, err)
+				}
+
+				var pages [][]string
+				var seen []models.FileRecord
+				cursor := ""
+				for {
+					page, err := searcher.SearchPage(context.Background(), query, filter, cursor, 7)
+					if err != nil {
+						t.Fatalf("SearchPage failed: %v", err)
+					}
+					if (len(pages) == 0) != (page.Prev == "") {
+						t.Fatalf("page %d has prev cursor %q", len(pages), page.Prev)
+					}
+					pages = append(pages, pageKeys(page.Results))
+					seen = append(seen, page.Results...)
+					if page.Next == "" {
+						break
+					}
+					if len(pages) > 10 {
+						t.Fatal("paging does not end")
+					}
+					cursor = page.Next
+				}
+				if !reflect.DeepEqual(pageKeys(seen), pageKeys(all)) {
+					t.Fatalf("pages visit\n%v\nexpected\n%v", pageKeys(seen), pageKeys(all))
+				}
+
+				// And back from the last page
+				last, _ := searcher.SearchPage(context.Background(), query, filter, cursor, 7)
+				for i := len(pages) - 2; i >= 0; i-- {
+					page, err := searcher.SearchPage(context.Background(), query, filter, last.Prev, 7)
+					if err != nil {
+						t.Fatalf("SearchPage failed: %v", err)
+					}
+					if !reflect.DeepEqual(pageKeys(page.Results), pages[i]) {
+						t.Fatalf("page %d backwards is %v, expected %v", i, pageKeys(page.Results), pages[i])
+					}
+					last = page
+				}
+				if last.Prev != "" {
+					t.Error("expected no prev cursor on the first page")
+				}
+			})
+		}
+	}
+}
+
+func TestSearchPage_InvalidCursor(t *testing.T) {
+	searcher := createPagedSearcher(t)
+	for _, c := range []string{"not base64!", "bm90IGpzb24", (&cursor{ID: 1}).String() + "x"} {
+		if _, err := searcher.SearchPage(context.Background(), "track", nil, c, 10); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("SearchPage(%q) expected ErrInvalidCursor, got %v", c, err)
+		}
+	}
+}
+
+func TestCount_Limit(t *testing.T) {
+	db, dbPath, cleanup := setupTestDB(t)
+	defer cleanup()
+	createTestFiles(t, db, "test-index")
+	searcher := createSearcher(t, dbPath, "test-index")
+	defer searcher.Close()
+
+	count, err := searcher.Count(context.Background(), "", &FileFilter{OnlyFiles: true})
+	if err != nil {
+		t.Fatalf("Count failed: %v", err)
+	}
+	if count.Total != 5 || !count.Exact {
+		t.Errorf("Count = %+v, expected 5 exact", count)
+	}
+}
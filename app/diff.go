@@ -0,0 +1,82 @@
+package app
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/ogefest/findex/models"
+)
+
+// Diff writes the changes one scan of an index recorded, the latest scan
+// when scanID is 0. indexName may be empty when the config has a single
+// index, kind limits the output to one change kind.
+func Diff(w io.Writer, configPath, indexName string, scanID int64, kind string) error {
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		return err
+	}
+
+	var idx *models.IndexConfig
+	for i := range cfg.Indexes {
+		if cfg.Indexes[i].Name == indexName || (indexName == "" && len(cfg.Indexes) == 1) {
+			idx = &cfg.Indexes[i]
+		}
+	}
+	if idx == nil {
+		if indexName == "" {
+			return fmt.Errorf("config has %d indexes, pick one with -index", len(cfg.Indexes))
+		}
+		return fmt.Errorf("index not found: %s", indexName)
+	}
+
+	switch kind {
+	case "", models.ChangeAdded, models.ChangeRemoved, models.ChangeModified, models.ChangeMoved:
+	default:
+		return fmt.Errorf("unknown change kind %q", kind)
+	}
+
+	searcher, err := NewSearcher([]*models.IndexConfig{idx})
+	if err != nil {
+		return err
+	}
+	defer searcher.Close()
+
+	scans, err := searcher.GetChangeSummaries(idx.Name, -1)
+	if err != nil {
+		return err
+	}
+	var scan *models.ChangeSummary
+	for i := range scans {
+		if scanID == 0 || scans[i].ScanID == scanID {
+			scan = &scans[i]
+			break
+		}
+	}
+	if scan == nil {
+		if scanID == 0 {
+			return fmt.Errorf("index %s has not been scanned yet", idx.Name)
+		}
+		return fmt.Errorf("scan %d not found in index %s", scanID, idx.Name)
+	}
+
+	changes, err := searcher.GetChanges(idx.Name, scan.ScanID, kind, -1)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "Scan %d at %s: %d added, %d removed, %d modified, %d moved\n",
+		scan.ScanID, scan.ScanTime.Format("2006-01-02 15:04:05"), scan.Added, scan.Removed, scan.Modified, scan.Moved)
+	for _, c := range changes {
+		switch c.Kind {
+		case models.ChangeAdded:
+			fmt.Fprintf(w, "+ %s\n", c.Path)
+		case models.ChangeRemoved:
+			fmt.Fprintf(w, "- %s\n", c.Path)
+		case models.ChangeModified:
+			fmt.Fprintf(w, "M %s (%d -> %d bytes)\n", c.Path, c.OldSize, c.Size)
+		case models.ChangeMoved:
+			fmt.Fprintf(w, "R %s -> %s\n", c.OldPath, c.Path)
+		}
+	}
+	return nil
+}
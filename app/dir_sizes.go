@@ -1,113 +1,222 @@
 package app
 
 import (
+	"context"
 	"database/sql"
-	"log"
-	"time"
+	"fmt"
+	"path/filepath"
+	"sort"
 
+	"github.com/ogefest/findex/models"
 	_ "modernc.org/sqlite"
 )
 
-// CalculateDirSizesBackground calculates directory sizes in the background
-// after index scan completes. It opens a separate database connection with
-// WAL mode to avoid blocking the web server.
-func CalculateDirSizesBackground(dbPath, indexName string) error {
-	log.Printf("Starting background directory size calculation for %s", indexName)
+// sizeTotals are the size sums over a set of files
+type sizeTotals struct {
+	Files     int64
+	Apparent  int64 // logical sizes, every hardlink counted
+	Unique    int64 // logical sizes, each inode counted once
+	Allocated int64 // allocated bytes on disk, each inode counted once
+	Dirs      int64 // directories below, only set for directory totals
+}
+
+// querySizeTotals sums the files matching where (appended to "is_dir = 0").
+// Hardlinks are grouped by device and inode; files without inode numbers
+// (zip contents, Windows scans) each form their own group. Files without an
+// allocated size count with their logical size.
+func querySizeTotals(db *sql.DB, where string, args ...any) (sizeTotals, error) {
+	var t sizeTotals
+	query := fmt.Sprintf(`
+		SELECT COALESCE(SUM(cnt), 0), COALESCE(SUM(cnt * size), 0), COALESCE(SUM(size), 0), COALESCE(SUM(disk), 0)
+		FROM (
+			SELECT COUNT(*) AS cnt, MAX(size) AS size, MAX(COALESCE(disk_size, size)) AS disk
+			FROM files
+			WHERE is_dir = 0 %s
+			GROUP BY device, CASE WHEN inode IS NULL THEN -id ELSE inode END
+		)
+	`, where)
+	err := db.QueryRow(query, args...).Scan(&t.Files, &t.Apparent, &t.Unique, &t.Allocated)
+	return t, err
+}
 
-	db, err := sql.Open("sqlite", dbPath+"?_busy_timeout=5000")
+// querySubtreeTotals calculates the totals of the directory at path with
+// queries, for directories missing from dir_sizes
+func querySubtreeTotals(db *sql.DB, path string) (sizeTotals, error) {
+	t, err := querySizeTotals(db, subtreeCondition, path)
 	if err != nil {
-		return err
+		return t, err
 	}
-	defer db.Close()
+	err = db.QueryRow(`SELECT COUNT(*) - 1 FROM (`+subtreeDirs+`)`, path).Scan(&t.Dirs)
+	return t, err
+}
 
-	if _, err := db.Exec("PRAGMA journal_mode = WAL"); err != nil {
-		return err
+// cacheDirSize stores totals for a directory in dir_sizes
+func cacheDirSize(db *sql.DB, path string, t sizeTotals) error {
+	_, err := db.Exec(`
+		INSERT OR REPLACE INTO dir_sizes (path, total_size, file_count, unique_size, disk_size, dir_count)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, path, t.Apparent, t.Files, t.Unique, t.Allocated, t.Dirs)
+	return err
+}
+
+// dirSizeRollup computes the totals of every directory from the records of
+// one scan. Records are added to their parent directory as they arrive and
+// rolled up to the ancestors once, deepest directories first, so the cost is
+// linear in the number of entries instead of one subtree query per
+// directory. Only directories are kept in memory: files with several
+// hardlinks are read back from the files table once the scan stored them,
+// see addLinked.
+type dirSizeRollup struct {
+	dirs map[string]*dirTotals
+}
+
+type dirTotals struct {
+	sizeTotals
+	parent string // empty for roots
+	depth  int
+}
+
+func newDirSizeRollup() *dirSizeRollup {
+	return &dirSizeRollup{dirs: make(map[string]*dirTotals)}
+}
+
+// dir returns the totals of dir, registering it and its ancestors up to root
+func (r *dirSizeRollup) dir(dir, root string) *dirTotals {
+	if t, ok := r.dirs[dir]; ok {
+		return t
+	}
+	t := &dirTotals{}
+	if parent := filepath.Dir(dir); dir != root && parent != dir {
+		t.parent = parent
+		t.depth = r.dir(parent, root).depth + 1
+	}
+	r.dirs[dir] = t
+	return t
+}
+
+// add counts one scanned record. The unique and allocated sizes of files
+// with several hardlinks are left to addLinked.
+func (r *dirSizeRollup) add(f models.FileRecord) {
+	parent := filepath.Dir(f.Path)
+	if f.IsDir {
+		r.dir(f.Path, f.Dir)
+		return
+	}
+
+	t := r.dir(parent, f.Dir)
+	t.Files++
+	t.Apparent += f.Size
+
+	if f.Inode != 0 && f.Links > 1 {
+		return
+	}
+
+	t.Unique += f.Size
+	if f.Inode != 0 {
+		t.Allocated += f.DiskSize
+	} else {
+		t.Allocated += f.Size
+	}
+}
+
+// finish adds every directory's totals to its ancestors
+func (r *dirSizeRollup) finish() {
+	paths := make([]string, 0, len(r.dirs))
+	for p := range r.dirs {
+		paths = append(paths, p)
 	}
+	sort.Slice(paths, func(i, j int) bool {
+		return r.dirs[paths[i]].depth > r.dirs[paths[j]].depth
+	})
+
+	for _, p := range paths {
+		t := r.dirs[p]
+		if t.parent == "" {
+			continue
+		}
+		parent := r.dirs[t.parent]
+		parent.Files += t.Files
+		parent.Apparent += t.Apparent
+		parent.Unique += t.Unique
+		parent.Allocated += t.Allocated
+		parent.Dirs += t.Dirs + 1
+	}
+}
 
-	// Get all directories
-	rows, err := db.Query(`SELECT path FROM files WHERE is_dir = 1`)
+// addLinked adds the files with several hardlinks stored by the current
+// scan. An inode counts once in every directory that contains at least one
+// of its links; grouping by directory in SQL leaves one row per inode and
+// directory, and rows come ordered by inode, so only the directories of one
+// inode are held at a time.
+func (r *dirSizeRollup) addLinked(ctx context.Context, db *sql.DB) error {
+	rows, err := db.QueryContext(ctx, `
+		SELECT f.device, f.inode, d.path, MAX(f.size), MAX(COALESCE(f.disk_size, f.size))
+		FROM files f JOIN dirs d ON d.id = f.parent_id
+		WHERE f.is_dir = 0 AND f.is_searchable != 0 AND f.nlink > 1 AND f.inode IS NOT NULL
+		GROUP BY f.device, f.inode, f.parent_id
+		ORDER BY f.device, f.inode
+	`)
 	if err != nil {
 		return err
 	}
+	defer rows.Close()
 
-	var dirs []string
+	var current fileID
+	seen := make(map[string]bool)
 	for rows.Next() {
-		var path string
-		if err := rows.Scan(&path); err != nil {
-			rows.Close()
+		var device, inode, size, allocated int64
+		var dir string
+		if err := rows.Scan(&device, &inode, &dir, &size, &allocated); err != nil {
 			return err
 		}
-		dirs = append(dirs, path)
+		id := fileID{dev: uint64(device), ino: uint64(inode)}
+		if id != current {
+			current = id
+			clear(seen)
+		}
+		for d := dir; d != "" && !seen[d]; {
+			t := r.dirs[d]
+			if t == nil {
+				break
+			}
+			seen[d] = true
+			t.Unique += size
+			t.Allocated += allocated
+			d = t.parent
+		}
 	}
-	rows.Close()
+	return rows.Err()
+}
 
-	if err := rows.Err(); err != nil {
+// store rolls the totals up and replaces the contents of dir_sizes
+func (r *dirSizeRollup) store(ctx context.Context, db *sql.DB) error {
+	r.finish()
+	if err := r.addLinked(ctx, db); err != nil {
 		return err
 	}
 
-	log.Printf("Calculating sizes for %d directories in %s", len(dirs), indexName)
-
-	const batchSize = 500
-	processed := 0
-
-	tx, err := db.Begin()
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	stmt, err := tx.Prepare(`INSERT OR REPLACE INTO dir_sizes (path, total_size, file_count) VALUES (?, ?, ?)`)
+	if _, err := tx.ExecContext(ctx, `DELETE FROM dir_sizes`); err != nil {
+		return err
+	}
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO dir_sizes (path, total_size, file_count, unique_size, disk_size, dir_count)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`)
 	if err != nil {
-		tx.Rollback()
 		return err
 	}
 	defer stmt.Close()
 
-	for i, dirPath := range dirs {
-		var size, count int64
-		err := db.QueryRow(`
-			SELECT COALESCE(SUM(size), 0), COUNT(*)
-			FROM files
-			WHERE path LIKE ? AND is_dir = 0
-		`, dirPath+"/%").Scan(&size, &count)
-		if err != nil {
-			tx.Rollback()
+	for p, t := range r.dirs {
+		if _, err := stmt.ExecContext(ctx, p, t.Apparent, t.Files, t.Unique, t.Allocated, t.Dirs); err != nil {
 			return err
 		}
-
-		if _, err := stmt.Exec(dirPath, size, count); err != nil {
-			tx.Rollback()
-			return err
-		}
-
-		processed++
-
-		// Commit batch and start new transaction
-		if (i+1)%batchSize == 0 {
-			if err := tx.Commit(); err != nil {
-				return err
-			}
-			log.Printf("Processed %d/%d directories for %s", processed, len(dirs), indexName)
-
-			// Small delay to allow web server concurrent access
-			time.Sleep(10 * time.Millisecond)
-
-			tx, err = db.Begin()
-			if err != nil {
-				return err
-			}
-			stmt, err = tx.Prepare(`INSERT OR REPLACE INTO dir_sizes (path, total_size, file_count) VALUES (?, ?, ?)`)
-			if err != nil {
-				tx.Rollback()
-				return err
-			}
-		}
-	}
-
-	// Commit remaining
-	if err := tx.Commit(); err != nil {
-		return err
 	}
-
-	log.Printf("Background directory size calculation completed for %s: %d directories processed", indexName, processed)
-	return nil
+	return tx.Commit()
 }
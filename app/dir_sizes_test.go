@@ -1,32 +1,46 @@
 package app
 
 import (
+	"context"
+	"database/sql"
+	"fmt"
 	"testing"
 	"time"
 
 	"github.com/ogefest/findex/models"
 )
 
-func TestCalculateDirSizesBackground(t *testing.T) {
-	db, dbPath, cleanup := setupTestDB(t)
-	defer cleanup()
-
-	createTestFiles(t, db, "test-index")
+// rollupTestFiles stores dir_sizes for files the way a scan does, with every
+// record found under root
+func rollupTestFiles(t *testing.T, db *sql.DB, root string, files []models.FileRecord) {
+	t.Helper()
 
-	err := CalculateDirSizesBackground(dbPath, "test-index")
-	if err != nil {
-		t.Fatalf("CalculateDirSizesBackground failed: %v", err)
+	sizes := newDirSizeRollup()
+	for _, f := range files {
+		f.Dir = root
+		sizes.add(f)
 	}
+	if err := sizes.store(context.Background(), db); err != nil {
+		t.Fatalf("failed to store dir sizes: %v", err)
+	}
+}
+
+func TestDirSizeRollup(t *testing.T) {
+	db, _, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	files := createTestFiles(t, db, "test-index")
+	rollupTestFiles(t, db, ".", files)
 
 	// Verify dir_sizes table has entries for all directories
 	var count int
-	err = db.QueryRow(`SELECT COUNT(*) FROM dir_sizes`).Scan(&count)
+	err := db.QueryRow(`SELECT COUNT(*) FROM dir_sizes`).Scan(&count)
 	if err != nil {
 		t.Fatalf("failed to count dir_sizes: %v", err)
 	}
 
-	if count != 3 { // documents, images, videos
-		t.Errorf("expected 3 directories in dir_sizes, got %d", count)
+	if count != 4 { // root, documents, images, videos
+		t.Errorf("expected 4 directories in dir_sizes, got %d", count)
 	}
 
 	// Verify specific directory sizes
@@ -71,8 +85,8 @@ func TestCalculateDirSizesBackground(t *testing.T) {
 	}
 }
 
-func TestCalculateDirSizesBackground_NestedDirectories(t *testing.T) {
-	db, dbPath, cleanup := setupTestDB(t)
+func TestDirSizeRollup_NestedDirectories(t *testing.T) {
+	db, _, cleanup := setupTestDB(t)
 	defer cleanup()
 
 	now := time.Now()
@@ -89,30 +103,30 @@ func TestCalculateDirSizesBackground_NestedDirectories(t *testing.T) {
 		{IndexName: "test-index", Path: "/root/sub2/file4.txt", Name: "file4.txt", Dir: "/root/sub2", Ext: ".txt", Size: 400, ModTime: now},
 	}
 
-	for _, f := range files {
-		insertTestFile(t, db, f)
-	}
-
-	err := CalculateDirSizesBackground(dbPath, "test-index")
-	if err != nil {
-		t.Fatalf("CalculateDirSizesBackground failed: %v", err)
+	// Deepest entries first, the rollup must not depend on walk order
+	for i := len(files) - 1; i >= 0; i-- {
+		insertTestFile(t, db, files[i])
 	}
+	rollupTestFiles(t, db, "/root", files)
 
 	// Verify nested directory sizes
 	tests := []struct {
 		path          string
 		expectedSize  int64
 		expectedCount int64
+		expectedDirs  int64
 	}{
 		{
 			path:          "/root",
 			expectedSize:  100 + 200 + 300 + 400, // all files under /root
 			expectedCount: 4,
+			expectedDirs:  3,
 		},
 		{
 			path:          "/root/sub1",
 			expectedSize:  200 + 300, // file2.txt + file3.txt
 			expectedCount: 2,
+			expectedDirs:  1,
 		},
 		{
 			path:          "/root/sub1/deep",
@@ -128,8 +142,8 @@ func TestCalculateDirSizesBackground_NestedDirectories(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.path, func(t *testing.T) {
-			var size, fileCount int64
-			err := db.QueryRow(`SELECT total_size, file_count FROM dir_sizes WHERE path = ?`, tt.path).Scan(&size, &fileCount)
+			var size, fileCount, dirCount int64
+			err := db.QueryRow(`SELECT total_size, file_count, dir_count FROM dir_sizes WHERE path = ?`, tt.path).Scan(&size, &fileCount, &dirCount)
 			if err != nil {
 				t.Fatalf("failed to get dir_size for %s: %v", tt.path, err)
 			}
@@ -141,32 +155,41 @@ func TestCalculateDirSizesBackground_NestedDirectories(t *testing.T) {
 			if fileCount != tt.expectedCount {
 				t.Errorf("expected file_count %d for %s, got %d", tt.expectedCount, tt.path, fileCount)
 			}
+
+			if dirCount != tt.expectedDirs {
+				t.Errorf("expected dir_count %d for %s, got %d", tt.expectedDirs, tt.path, dirCount)
+			}
 		})
 	}
+
+	t.Run("matches on-demand calculation", func(t *testing.T) {
+		for _, tt := range tests {
+			q, err := querySubtreeTotals(db, tt.path)
+			if err != nil {
+				t.Fatalf("querySubtreeTotals failed: %v", err)
+			}
+			if q.Apparent != tt.expectedSize || q.Files != tt.expectedCount || q.Dirs != tt.expectedDirs {
+				t.Errorf("%s: query gives %+v", tt.path, q)
+			}
+		}
+	})
 }
 
-func TestCalculateDirSizesBackground_EmptyDirectory(t *testing.T) {
-	db, dbPath, cleanup := setupTestDB(t)
+func TestDirSizeRollup_EmptyDirectory(t *testing.T) {
+	db, _, cleanup := setupTestDB(t)
 	defer cleanup()
 
-	now := time.Now()
-
 	// Create empty directory
-	insertTestFile(t, db, models.FileRecord{
+	rollupTestFiles(t, db, "/", []models.FileRecord{{
 		IndexName: "test-index",
 		Path:      "/empty",
 		Name:      "empty",
 		IsDir:     true,
-		ModTime:   now,
-	})
-
-	err := CalculateDirSizesBackground(dbPath, "test-index")
-	if err != nil {
-		t.Fatalf("CalculateDirSizesBackground failed: %v", err)
-	}
+		ModTime:   time.Now(),
+	}})
 
 	var size, fileCount int64
-	err = db.QueryRow(`SELECT total_size, file_count FROM dir_sizes WHERE path = ?`, "/empty").Scan(&size, &fileCount)
+	err := db.QueryRow(`SELECT total_size, file_count FROM dir_sizes WHERE path = ?`, "/empty").Scan(&size, &fileCount)
 	if err != nil {
 		t.Fatalf("failed to get dir_size for /empty: %v", err)
 	}
@@ -180,68 +203,131 @@ func TestCalculateDirSizesBackground_EmptyDirectory(t *testing.T) {
 	}
 }
 
-func TestCalculateDirSizesBackground_NoDirectories(t *testing.T) {
-	db, dbPath, cleanup := setupTestDB(t)
+func TestDirSizeRollup_RootOnly(t *testing.T) {
+	db, _, cleanup := setupTestDB(t)
 	defer cleanup()
 
-	now := time.Now()
-
-	// Create only files, no directories
-	insertTestFile(t, db, models.FileRecord{
-		IndexName: "test-index",
-		Path:      "/file1.txt",
-		Name:      "file1.txt",
-		Ext:       ".txt",
-		Size:      100,
-		ModTime:   now,
+	// Only files directly in the root
+	rollupTestFiles(t, db, "/data", []models.FileRecord{
+		{Path: "/data/file1.txt", Name: "file1.txt", Size: 100},
+		{Path: "/data/file2.txt", Name: "file2.txt", Size: 50},
 	})
 
-	err := CalculateDirSizesBackground(dbPath, "test-index")
-	if err != nil {
-		t.Fatalf("CalculateDirSizesBackground failed: %v", err)
-	}
-
 	var count int
-	err = db.QueryRow(`SELECT COUNT(*) FROM dir_sizes`).Scan(&count)
+	err := db.QueryRow(`SELECT COUNT(*) FROM dir_sizes`).Scan(&count)
 	if err != nil {
 		t.Fatalf("failed to count dir_sizes: %v", err)
 	}
+	if count != 1 {
+		t.Errorf("expected only the root in dir_sizes, got %d entries", count)
+	}
 
-	if count != 0 {
-		t.Errorf("expected 0 entries in dir_sizes, got %d", count)
+	var size, fileCount, dirCount int64
+	db.QueryRow(`SELECT total_size, file_count, dir_count FROM dir_sizes WHERE path = '/data'`).Scan(&size, &fileCount, &dirCount)
+	if size != 150 || fileCount != 2 || dirCount != 0 {
+		t.Errorf("unexpected root totals: size %d, files %d, dirs %d", size, fileCount, dirCount)
 	}
 }
 
-func TestCalculateDirSizesBackground_LargeBatch(t *testing.T) {
-	db, dbPath, cleanup := setupTestDB(t)
+func TestDirSizeRollup_Hardlinks(t *testing.T) {
+	db, _, cleanup := setupTestDB(t)
 	defer cleanup()
 
 	now := time.Now()
-
-	// Create more than 500 directories to test batching
-	numDirs := 600
-	for i := 0; i < numDirs; i++ {
-		insertTestFile(t, db, models.FileRecord{
-			IndexName: "test-index",
-			Path:      "/dir" + string(rune('A'+i%26)) + string(rune('0'+i/26)),
-			Name:      "dir" + string(rune('A'+i%26)) + string(rune('0'+i/26)),
-			IsDir:     true,
-			ModTime:   now,
-		})
+	files := []models.FileRecord{
+		{Path: "backup", Name: "backup", IsDir: true, ModTime: now},
+		// daily.0 and daily.1 share one inode, as rsnapshot trees do
+		{Path: "backup/daily.0/data.bin", Name: "data.bin", Size: 1000, ModTime: now, Device: 1, Inode: 42, Links: 2, DiskSize: 1024},
+		{Path: "backup/daily.1/data.bin", Name: "data.bin", Size: 1000, ModTime: now, Device: 1, Inode: 42, Links: 2, DiskSize: 1024},
+		// same inode number on another device is a different file
+		{Path: "backup/other/data.bin", Name: "data.bin", Size: 1000, ModTime: now, Device: 2, Inode: 42, Links: 1, DiskSize: 1024},
+		// sparse file: large logical size, few allocated blocks
+		{Path: "backup/disk.img", Name: "disk.img", Size: 10000, ModTime: now, Device: 1, Inode: 7, Links: 1, DiskSize: 4096},
+		// no inode information (zip contents): counted individually at logical size
+		{Path: "backup/a.zip/x.txt", Name: "x.txt", Size: 10, ModTime: now},
+		{Path: "backup/a.zip/y.txt", Name: "y.txt", Size: 10, ModTime: now},
 	}
+	for i := range files {
+		files[i].IndexName = "test-index"
+		insertTestFile(t, db, files[i])
+	}
+	rollupTestFiles(t, db, ".", files)
 
-	err := CalculateDirSizesBackground(dbPath, "test-index")
+	var size, count, unique, disk int64
+	err := db.QueryRow(`SELECT total_size, file_count, unique_size, disk_size FROM dir_sizes WHERE path = 'backup'`).Scan(&size, &count, &unique, &disk)
 	if err != nil {
-		t.Fatalf("CalculateDirSizesBackground failed: %v", err)
+		t.Fatalf("failed to get dir_size: %v", err)
 	}
 
-	var count int
-	err = db.QueryRow(`SELECT COUNT(*) FROM dir_sizes`).Scan(&count)
-	if err != nil {
-		t.Fatalf("failed to count dir_sizes: %v", err)
+	if count != 6 {
+		t.Errorf("expected 6 files, got %d", count)
+	}
+	if size != 13020 {
+		t.Errorf("expected apparent size 13020, got %d", size)
+	}
+	if unique != 12020 {
+		t.Errorf("expected unique size 12020, got %d", unique)
+	}
+	if disk != 1024+1024+4096+20 {
+		t.Errorf("expected disk usage %d, got %d", 1024+1024+4096+20, disk)
 	}
 
-	if count != numDirs {
-		t.Errorf("expected %d entries in dir_sizes, got %d", numDirs, count)
+	stats := &models.IndexStats{}
+	if err := loadSizeTotals(db, stats); err != nil {
+		t.Fatalf("loadSizeTotals failed: %v", err)
+	}
+	if stats.TotalSize != 13020 || stats.UniqueSize != 12020 {
+		t.Errorf("unexpected index totals: apparent %d, unique %d", stats.TotalSize, stats.UniqueSize)
+	}
+	if stats.HardlinkedFiles != 2 {
+		t.Errorf("expected 2 hardlinked files, got %d", stats.HardlinkedFiles)
+	}
+}
+
+func TestDirSizeRollup_ManyHardlinks(t *testing.T) {
+	db, _, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	// One inode linked from every snapshot, twice in each, as a long
+	// rotation of hardlinked backups leaves it
+	const snapshots = 200
+	now := time.Now()
+	var files []models.FileRecord
+	for i := 0; i < snapshots; i++ {
+		dir := fmt.Sprintf("backup/daily.%d", i)
+		for _, name := range []string{"data.bin", "copy.bin"} {
+			files = append(files, models.FileRecord{
+				Path: dir + "/" + name, Name: name, Size: 1000, ModTime: now,
+				Device: 1, Inode: 42, Links: 2 * snapshots, DiskSize: 1024,
+			})
+		}
+	}
+	for i := range files {
+		files[i].IndexName = "test-index"
+		insertTestFile(t, db, files[i])
+	}
+	rollupTestFiles(t, db, ".", files)
+
+	tests := []struct {
+		path         string
+		files        int64
+		size, unique int64
+		disk         int64
+	}{
+		{path: "backup", files: 2 * snapshots, size: 2 * snapshots * 1000, unique: 1000, disk: 1024},
+		{path: "backup/daily.0", files: 2, size: 2000, unique: 1000, disk: 1024},
+		{path: fmt.Sprintf("backup/daily.%d", snapshots-1), files: 2, size: 2000, unique: 1000, disk: 1024},
+		{path: ".", files: 2 * snapshots, size: 2 * snapshots * 1000, unique: 1000, disk: 1024},
+	}
+	for _, tt := range tests {
+		var count, size, unique, disk int64
+		err := db.QueryRow(`SELECT file_count, total_size, unique_size, disk_size FROM dir_sizes WHERE path = ?`, tt.path).Scan(&count, &size, &unique, &disk)
+		if err != nil {
+			t.Fatalf("failed to get dir_size for %s: %v", tt.path, err)
+		}
+		if count != tt.files || size != tt.size || unique != tt.unique || disk != tt.disk {
+			t.Errorf("%s: files %d, size %d, unique %d, disk %d; expected %d, %d, %d, %d",
+				tt.path, count, size, unique, disk, tt.files, tt.size, tt.unique, tt.disk)
+		}
 	}
 }
@@ -0,0 +1,128 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"strings"
+)
+
+// dirTree assigns dirs ids while a scan inserts files. Parents are created
+// before their children, so every directory row knows its parent_id; ids are
+// cached for the whole scan since most files share their parent with the
+// previous one.
+type dirTree struct {
+	ids map[string]int64
+}
+
+func newDirTree() *dirTree {
+	return &dirTree{ids: make(map[string]int64)}
+}
+
+// ensure returns the id of dir, creating it and any missing ancestors up to
+// root. Roots are stored with a NULL parent and root_id and their full path
+// as name.
+func (t *dirTree) ensure(ctx context.Context, tx *sql.Tx, dir, root string) (int64, error) {
+	if id, ok := t.ids[dir]; ok {
+		return id, nil
+	}
+
+	var parentID, rootID any
+	name := dir
+	if dir != root && strings.HasPrefix(dir, root) {
+		parent, err := t.ensure(ctx, tx, filepath.Dir(dir), root)
+		if err != nil {
+			return 0, err
+		}
+		parentID = parent
+		rootID = t.ids[root]
+		name = filepath.Base(dir)
+	}
+
+	var id int64
+	err := tx.QueryRowContext(ctx, `
+		INSERT INTO dirs (path, name, parent_id, root_id) VALUES (?, ?, ?, ?)
+		ON CONFLICT(path) DO UPDATE SET parent_id = excluded.parent_id, root_id = excluded.root_id
+		RETURNING id
+	`, dir, name, parentID, rootID).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	t.ids[dir] = id
+	return id, nil
+}
+
+// entryPath rebuilds the full path of a files row from its parent directory
+func entryPath(dir, name string) string {
+	return filepath.Join(dir, name)
+}
+
+// dirRef is a row of the dirs table
+type dirRef struct {
+	ID   int64
+	Path string
+}
+
+// rootDirs returns the directories without a parent, one per indexed root
+func rootDirs(db *sql.DB) ([]dirRef, error) {
+	rows, err := db.Query(`SELECT id, path FROM dirs WHERE parent_id IS NULL ORDER BY path`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var roots []dirRef
+	for rows.Next() {
+		var d dirRef
+		if err := rows.Scan(&d.ID, &d.Path); err != nil {
+			return nil, err
+		}
+		roots = append(roots, d)
+	}
+	return roots, rows.Err()
+}
+
+// resolveDir finds the directory for a browse path, which is either a full
+// path or relative to one of the roots. ok is false when no directory matches.
+func resolveDir(db *sql.DB, path string) (dirRef, bool, error) {
+	d := dirRef{Path: path}
+	err := db.QueryRow(`SELECT id FROM dirs WHERE path = ?`, path).Scan(&d.ID)
+	if err == nil {
+		return d, true, nil
+	}
+	if err != sql.ErrNoRows {
+		return d, false, err
+	}
+
+	roots, err := rootDirs(db)
+	if err != nil {
+		return d, false, err
+	}
+	for _, root := range roots {
+		candidate := strings.TrimSuffix(root.Path, "/") + "/" + strings.TrimPrefix(path, "/")
+		err := db.QueryRow(`SELECT id FROM dirs WHERE path = ?`, candidate).Scan(&d.ID)
+		if err == nil {
+			d.Path = candidate
+			return d, true, nil
+		}
+		if err != sql.ErrNoRows {
+			return d, false, err
+		}
+	}
+	return d, false, nil
+}
+
+// subtreeDirs selects the ids of the directory with the given path (bound as
+// the single argument) and of every directory below it. The recursive walk
+// over dirs.parent_id uses the idx_dirs_parent index instead of a LIKE scan.
+const subtreeDirs = `
+	WITH RECURSIVE subtree(id) AS (
+		SELECT id FROM dirs WHERE path = ?
+		UNION ALL
+		SELECT d.id FROM dirs d JOIN subtree s ON d.parent_id = s.id
+	)
+	SELECT id FROM subtree`
+
+// subtreeCondition restricts a files query to everything below a directory,
+// see subtreeDirs
+const subtreeCondition = `AND parent_id IN (` + subtreeDirs + `)`
@@ -0,0 +1,226 @@
+package app
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestScanSource_DirectoryTree(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	for _, f := range []string{"top.txt", "a/one.txt", "a/b/two.txt", "a/b/c/three.txt", "x/one.txt"} {
+		full := filepath.Join(tmpDir, f)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatalf("failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(full, []byte("0123456789"), 0644); err != nil {
+			t.Fatalf("failed to create file: %v", err)
+		}
+	}
+
+	db, dbPath, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	source := NewLocalSource("test-index", []string{tmpDir}, nil, 0, false, nil)
+	if err := scanSource(context.Background(), db, source, "test-index", nil); err != nil {
+		t.Fatalf("scanSource failed: %v", err)
+	}
+
+	t.Run("every file points at its parent directory", func(t *testing.T) {
+		var orphans int
+		err := db.QueryRow(`
+			SELECT COUNT(*) FROM files f
+			LEFT JOIN dirs d ON d.id = f.parent_id
+			WHERE d.path IS NULL
+		`).Scan(&orphans)
+		if err != nil {
+			t.Fatalf("query failed: %v", err)
+		}
+		if orphans != 0 {
+			t.Errorf("expected no files with a wrong parent, got %d", orphans)
+		}
+	})
+
+	t.Run("root has no parent", func(t *testing.T) {
+		roots, err := rootDirs(db)
+		if err != nil {
+			t.Fatalf("rootDirs failed: %v", err)
+		}
+		if len(roots) != 1 || roots[0].Path != tmpDir {
+			t.Errorf("expected single root %s, got %+v", tmpDir, roots)
+		}
+	})
+
+	t.Run("scan stores every directory size", func(t *testing.T) {
+		var stored, dirs int
+		db.QueryRow(`SELECT COUNT(*) FROM dir_sizes`).Scan(&stored)
+		db.QueryRow(`SELECT COUNT(*) FROM dirs`).Scan(&dirs)
+		if stored != dirs {
+			t.Errorf("expected sizes for all %d directories, got %d", dirs, stored)
+		}
+	})
+
+	searcher := createSearcher(t, dbPath, "test-index")
+	defer searcher.Close()
+
+	names := func(path string) []string {
+		items, err := searcher.GetDirectoryContent("test-index", path)
+		if err != nil {
+			t.Fatalf("GetDirectoryContent(%q) failed: %v", path, err)
+		}
+		var result []string
+		for _, f := range items {
+			result = append(result, f.Name)
+		}
+		sort.Strings(result)
+		return result
+	}
+
+	tests := []struct {
+		path     string
+		expected []string
+	}{
+		{"", []string{"a", "top.txt", "x"}},
+		{"a", []string{"b", "one.txt"}},
+		{filepath.Join(tmpDir, "a", "b"), []string{"c", "two.txt"}},
+		{"a/b/c", []string{"three.txt"}},
+		{"missing", nil},
+	}
+	for _, tt := range tests {
+		got := names(tt.path)
+		if len(got) != len(tt.expected) {
+			t.Errorf("listing %q: expected %v, got %v", tt.path, tt.expected, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.expected[i] {
+				t.Errorf("listing %q: expected %v, got %v", tt.path, tt.expected, got)
+				break
+			}
+		}
+	}
+
+	t.Run("full paths are rebuilt from dirs", func(t *testing.T) {
+		results, err := searcher.Search("three", nil, 10)
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		if len(results) != 1 {
+			t.Fatalf("expected 1 result, got %d", len(results))
+		}
+		if want := filepath.Join(tmpDir, "a", "b", "c", "three.txt"); results[0].Path != want {
+			t.Errorf("expected path %s, got %s", want, results[0].Path)
+		}
+		if results[0].Dir != tmpDir {
+			t.Errorf("expected root %s, got %s", tmpDir, results[0].Dir)
+		}
+	})
+
+	t.Run("directory components are searchable", func(t *testing.T) {
+		results, err := searcher.Search("b", &FileFilter{OnlyFiles: true}, 10)
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		if len(results) != 2 {
+			t.Errorf("expected the 2 files below a/b, got %d", len(results))
+		}
+	})
+
+	t.Run("search in a browsed folder", func(t *testing.T) {
+		scope, ok, err := searcher.DirPath("test-index", "a/b")
+		if err != nil || !ok || scope != filepath.Join(tmpDir, "a", "b") {
+			t.Fatalf("DirPath = %q, %v (%v), expected the full path of a/b", scope, ok, err)
+		}
+		results, err := searcher.Search("one OR two OR three", &FileFilter{InDir: scope}, 10)
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		var got []string
+		for _, f := range results {
+			got = append(got, f.Name)
+		}
+		sort.Strings(got)
+		if len(got) != 2 || got[0] != "three.txt" || got[1] != "two.txt" {
+			t.Errorf("expected the files below a/b, got %v", got)
+		}
+		if _, ok, _ := searcher.DirPath("test-index", "missing"); ok {
+			t.Error("expected no directory for a missing path")
+		}
+	})
+
+	t.Run("directory size covers the whole subtree", func(t *testing.T) {
+		info, err := searcher.GetDirectorySize("test-index", "a")
+		if err != nil {
+			t.Fatalf("GetDirectorySize failed: %v", err)
+		}
+		if info.Files != 3 || info.Size != 30 || info.Dirs != 2 {
+			t.Errorf("expected 3 files, 2 dirs and 30 bytes, got %d files, %d dirs and %d bytes", info.Files, info.Dirs, info.Size)
+		}
+	})
+}
+
+func TestRunMigrations_BackfillsDirs(t *testing.T) {
+	db := openMigrationTestDB(t)
+
+	// Unversioned database in the crc32 dir_index layout
+	for _, stmt := range migrations[0].statements {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("failed to create legacy schema: %v", err)
+		}
+	}
+	_, err := db.Exec(`
+		INSERT INTO files(path, name, dir, dir_index, size, is_dir, is_searchable) VALUES
+			('/data/docs', 'docs', '/data', 1, 0, 1, 2),
+			('/data/docs/old', 'old', '/data', 2, 0, 1, 2),
+			('/data/docs/old/a.txt', 'a.txt', '/data', 3, 10, 0, 2),
+			('/data/top.txt', 'top.txt', '/data', 4, 5, 0, 2)
+	`)
+	if err != nil {
+		t.Fatalf("failed to insert legacy rows: %v", err)
+	}
+
+	if err := RunMigrations(db); err != nil {
+		t.Fatalf("RunMigrations failed: %v", err)
+	}
+
+	parentOf := func(name string) string {
+		var parent string
+		err := db.QueryRow(`SELECT d.path FROM files f JOIN dirs d ON d.id = f.parent_id WHERE f.name = ?`, name).Scan(&parent)
+		if err != nil {
+			t.Fatalf("no parent for %s: %v", name, err)
+		}
+		return parent
+	}
+	if p := parentOf("a.txt"); p != "/data/docs/old" {
+		t.Errorf("unexpected parent %s", p)
+	}
+	if p := parentOf("top.txt"); p != "/data" {
+		t.Errorf("unexpected parent %s", p)
+	}
+
+	var rootParent any
+	if err := db.QueryRow(`SELECT parent_id FROM dirs WHERE path = '/data'`).Scan(&rootParent); err != nil || rootParent != nil {
+		t.Errorf("expected root without parent, got %v (%v)", rootParent, err)
+	}
+
+	for _, col := range []string{"dir_index", "path", "dir"} {
+		var count int
+		db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('files') WHERE name = ?`, col).Scan(&count)
+		if count != 0 {
+			t.Errorf("expected %s column to be dropped", col)
+		}
+	}
+
+	var rootID int64
+	if err := db.QueryRow(`SELECT root_id FROM dirs WHERE path = '/data/docs/old'`).Scan(&rootID); err != nil {
+		t.Fatalf("failed to read root_id: %v", err)
+	}
+	var root string
+	db.QueryRow(`SELECT path FROM dirs WHERE id = ?`, rootID).Scan(&root)
+	if root != "/data" {
+		t.Errorf("expected root /data, got %q", root)
+	}
+}
@@ -0,0 +1,258 @@
+package app
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// IgnoreFileName is the per-directory ignore file honoured during scans.
+// It uses the same syntax as exclude_patterns and applies to the directory
+// it is placed in and everything below it.
+const IgnoreFileName = ".findexignore"
+
+// excludeRule is a single compiled exclusion rule
+type excludeRule struct {
+	source   string // original text, reported in the scan log
+	origin   string // where the rule came from (config key or ignore file path)
+	base     string // directory gitignore patterns are relative to
+	negate   bool
+	dirOnly  bool
+	legacy   bool // exclude_paths entry: filepath.Match or prefix on absolute path
+	absolute bool // regex rule matched against the absolute path
+	re       *regexp.Regexp
+}
+
+// String describes the rule for log output
+func (r *excludeRule) String() string {
+	if r.origin == "" {
+		return r.source
+	}
+	return fmt.Sprintf("%s (%s)", r.source, r.origin)
+}
+
+// match reports whether the rule applies to path
+func (r *excludeRule) match(path string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	if r.legacy {
+		if matched, _ := filepath.Match(r.source, path); matched {
+			return true
+		}
+		return strings.HasPrefix(path, r.source)
+	}
+	if r.absolute {
+		return r.re.MatchString(filepath.ToSlash(path))
+	}
+
+	rel, err := filepath.Rel(r.base, path)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return false
+	}
+	return r.re.MatchString(filepath.ToSlash(rel))
+}
+
+// excludeRules is an ordered, immutable rule list. Rules are evaluated
+// gitignore-style: the last matching rule decides, so a later "!pattern"
+// re-includes a path excluded by an earlier rule.
+type excludeRules struct {
+	rules []*excludeRule
+}
+
+// newExcludeRules compiles the index-level rules for a single root
+func newExcludeRules(root string, excludePaths, excludePatterns, excludeRegex []string) (*excludeRules, error) {
+	rs := &excludeRules{}
+	for _, p := range excludePaths {
+		if p == "" {
+			continue
+		}
+		rs.rules = append(rs.rules, &excludeRule{source: p, origin: "exclude_paths", legacy: true})
+	}
+	patterns, err := newPatternRules(root, "exclude_patterns", excludePatterns)
+	if err != nil {
+		return nil, err
+	}
+	rs.rules = append(rs.rules, patterns.rules...)
+	for _, p := range excludeRegex {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exclude_regex %q: %w", p, err)
+		}
+		rs.rules = append(rs.rules, &excludeRule{source: p, origin: "exclude_regex", absolute: true, re: re})
+	}
+	return rs, nil
+}
+
+// newPatternRules compiles gitignore-style patterns anchored at root. It is
+// also used for include_patterns, where a match means "keep" instead of
+// "skip".
+func newPatternRules(root, origin string, patterns []string) (*excludeRules, error) {
+	rs := &excludeRules{}
+	for _, p := range patterns {
+		rule, err := compileGitignorePattern(p, root, origin)
+		if err != nil {
+			return nil, err
+		}
+		if rule != nil {
+			rs.rules = append(rs.rules, rule)
+		}
+	}
+	return rs, nil
+}
+
+// withIgnoreFile returns a new rule list extended with the patterns from an
+// ignore file located in dir. The receiver is left untouched so sibling
+// directories sharing it are not affected.
+func (rs *excludeRules) withIgnoreFile(dir, ignorePath string) (*excludeRules, error) {
+	f, err := os.Open(ignorePath)
+	if err != nil {
+		return rs, err
+	}
+	defer f.Close()
+
+	var added []*excludeRule
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		rule, err := compileGitignorePattern(scanner.Text(), dir, ignorePath)
+		if err != nil {
+			return rs, err
+		}
+		if rule != nil {
+			added = append(added, rule)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return rs, err
+	}
+	if len(added) == 0 {
+		return rs, nil
+	}
+
+	rules := make([]*excludeRule, 0, len(rs.rules)+len(added))
+	rules = append(rules, rs.rules...)
+	rules = append(rules, added...)
+	return &excludeRules{rules: rules}, nil
+}
+
+// match returns the rule that excludes path, or nil when the path is kept
+func (rs *excludeRules) match(path string, isDir bool) *excludeRule {
+	if rs == nil {
+		return nil
+	}
+	var decided *excludeRule
+	for _, r := range rs.rules {
+		if r.match(path, isDir) {
+			decided = r
+		}
+	}
+	if decided == nil || decided.negate {
+		return nil
+	}
+	return decided
+}
+
+// compileGitignorePattern converts one gitignore line into a rule anchored
+// at base. Blank lines and comments yield a nil rule.
+func compileGitignorePattern(line, base, origin string) (*excludeRule, error) {
+	pattern := strings.TrimRight(line, " \t\r")
+	if pattern == "" || strings.HasPrefix(pattern, "#") {
+		return nil, nil
+	}
+
+	rule := &excludeRule{source: pattern, origin: origin, base: base}
+
+	if strings.HasPrefix(pattern, "!") {
+		rule.negate = true
+		pattern = pattern[1:]
+	} else if strings.HasPrefix(pattern, `\!`) || strings.HasPrefix(pattern, `\#`) {
+		pattern = pattern[1:]
+	}
+
+	if strings.HasSuffix(pattern, "/") {
+		rule.dirOnly = true
+		pattern = strings.TrimRight(pattern, "/")
+	}
+	if pattern == "" {
+		return nil, nil
+	}
+
+	// A slash anywhere but the end anchors the pattern to base, otherwise
+	// it matches at any depth.
+	anchored := strings.Contains(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+
+	expr, err := globToRegexp(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q in %s: %w", line, origin, err)
+	}
+	if anchored {
+		expr = "^" + expr + "$"
+	} else {
+		expr = "^(?:.*/)?" + expr + "$"
+	}
+
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q in %s: %w", line, origin, err)
+	}
+	rule.re = re
+	return rule, nil
+}
+
+// globToRegexp translates gitignore glob syntax (*, ?, [...], **) into a
+// regular expression fragment matching slash-separated relative paths.
+func globToRegexp(glob string) (string, error) {
+	var sb strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				atStart := i == 0 || glob[i-1] == '/'
+				j := i + 2
+				if atStart && j < len(glob) && glob[j] == '/' {
+					// "**/" matches zero or more leading directories
+					sb.WriteString("(?:.*/)?")
+					i = j
+					continue
+				}
+				if atStart && j == len(glob) {
+					// trailing "/**" matches everything inside
+					sb.WriteString(".*")
+					i = j - 1
+					continue
+				}
+				// "**" elsewhere behaves like "*"
+				sb.WriteString("[^/]*")
+				i = j - 1
+				continue
+			}
+			sb.WriteString("[^/]*")
+		case '?':
+			sb.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				return "", fmt.Errorf("unterminated character class")
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+				sb.WriteString(regexp.QuoteMeta(string(glob[i])))
+			}
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,149 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExcludeRules_GitignorePatterns(t *testing.T) {
+	root := "/data"
+
+	tests := []struct {
+		name     string
+		patterns []string
+		path     string
+		isDir    bool
+		excluded bool
+	}{
+		{"basename matches at any depth", []string{"node_modules"}, "/data/a/b/node_modules", true, true},
+		{"basename matches at top level", []string{"node_modules"}, "/data/node_modules", true, true},
+		{"extension glob", []string{"*.tmp"}, "/data/x/y/file.tmp", false, true},
+		{"extension glob does not match other ext", []string{"*.tmp"}, "/data/x/file.txt", false, false},
+		{"dir-only pattern skips files", []string{"build/"}, "/data/src/build", false, false},
+		{"dir-only pattern matches dirs", []string{"build/"}, "/data/src/build", true, true},
+		{"anchored pattern", []string{"/cache"}, "/data/cache", true, true},
+		{"anchored pattern not nested", []string{"/cache"}, "/data/sub/cache", true, false},
+		{"pattern with slash is anchored", []string{"docs/private"}, "/data/docs/private", true, true},
+		{"pattern with slash not nested", []string{"docs/private"}, "/data/x/docs/private", true, false},
+		{"double star prefix", []string{"**/logs"}, "/data/a/b/logs", true, true},
+		{"double star middle", []string{"a/**/z"}, "/data/a/b/c/z", true, true},
+		{"double star middle zero dirs", []string{"a/**/z"}, "/data/a/z", true, true},
+		{"trailing double star", []string{"tmp/**"}, "/data/tmp/x/y.txt", false, true},
+		{"question mark", []string{"file?.txt"}, "/data/file1.txt", false, true},
+		{"character class", []string{"file[0-9].txt"}, "/data/file7.txt", false, true},
+		{"negated character class", []string{"file[!0-9].txt"}, "/data/file7.txt", false, false},
+		{"negation re-includes", []string{"*.log", "!keep.log"}, "/data/keep.log", false, false},
+		{"negation order matters", []string{"!keep.log", "*.log"}, "/data/keep.log", false, true},
+		{"comment and blank lines", []string{"# comment", "", "*.bak"}, "/data/a.bak", false, true},
+		{"escaped hash", []string{`\#notes`}, "/data/#notes", false, true},
+		{"outside root is ignored", []string{"*.tmp"}, "/other/file.tmp", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := newExcludeRules(root, nil, tt.patterns, nil)
+			if err != nil {
+				t.Fatalf("newExcludeRules failed: %v", err)
+			}
+			got := rules.match(tt.path, tt.isDir) != nil
+			if got != tt.excluded {
+				t.Errorf("match(%q) = %v, expected %v", tt.path, got, tt.excluded)
+			}
+		})
+	}
+}
+
+func TestExcludeRules_LegacyAndRegex(t *testing.T) {
+	rules, err := newExcludeRules("/data", []string{"/data/private"}, nil, []string{`\.(iso|img)$`})
+	if err != nil {
+		t.Fatalf("newExcludeRules failed: %v", err)
+	}
+
+	if r := rules.match("/data/private/secret.txt", false); r == nil || r.origin != "exclude_paths" {
+		t.Errorf("expected legacy prefix rule to match, got %v", r)
+	}
+	if r := rules.match("/data/images/disk.iso", false); r == nil || r.origin != "exclude_regex" {
+		t.Errorf("expected regex rule to match, got %v", r)
+	}
+	if r := rules.match("/data/images/photo.jpg", false); r != nil {
+		t.Errorf("expected no match, got %v", r)
+	}
+
+	if _, err := newExcludeRules("/data", nil, nil, []string{"("}); err == nil {
+		t.Error("expected error for invalid regex")
+	}
+	if _, err := newExcludeRules("/data", nil, []string{"[abc"}, nil); err == nil {
+		t.Error("expected error for unterminated character class")
+	}
+}
+
+func TestExcludeRule_String(t *testing.T) {
+	rule, err := compileGitignorePattern("*.tmp", "/data", "/data/.findexignore")
+	if err != nil {
+		t.Fatalf("compileGitignorePattern failed: %v", err)
+	}
+	if got := rule.String(); got != "*.tmp (/data/.findexignore)" {
+		t.Errorf("unexpected rule description %q", got)
+	}
+}
+
+func TestLocalSourceWalk_ExcludePatternsAndIgnoreFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	files := map[string]string{
+		"keep.txt":                       "a",
+		"scratch.tmp":                    "b",
+		"app/node_modules/pkg/index.js":  "c",
+		"app/src/main.go":                "d",
+		"app/src/debug.log":              "e",
+		"app/src/important.log":          "f",
+		"app/src/.findexignore":          "*.log\n!important.log\n",
+		"media/.findexignore":            "# only this subtree\ncache/\n",
+		"media/cache/thumb.jpg":          "g",
+		"media/movie.mkv":                "h",
+		"other/cache/thumb.jpg":          "i",
+		"other/secret/passwords.kdbx":    "j",
+		"other/secret/notes/passwords.x": "k",
+	}
+	for rel, content := range files {
+		full := filepath.Join(tmpDir, rel)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatalf("failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to create file: %v", err)
+		}
+	}
+
+	source := NewLocalSource("test-index", []string{tmpDir}, nil, 2, false, nil)
+	source.ExcludePatterns = []string{"node_modules/", "*.tmp"}
+	source.ExcludeRegex = []string{`/secret(/|$)`}
+
+	found := make(map[string]bool)
+	for f := range source.Walk() {
+		rel, _ := filepath.Rel(tmpDir, f.Path)
+		found[filepath.ToSlash(rel)] = true
+	}
+
+	expected := []string{"keep.txt", "app/src/main.go", "app/src/important.log", "media/movie.mkv", "other/cache/thumb.jpg"}
+	for _, p := range expected {
+		if !found[p] {
+			t.Errorf("expected %s to be indexed", p)
+		}
+	}
+
+	excluded := []string{"scratch.tmp", "app/node_modules", "app/node_modules/pkg/index.js", "app/src/debug.log", "media/cache", "media/cache/thumb.jpg", "other/secret", "other/secret/passwords.kdbx"}
+	for _, p := range excluded {
+		if found[p] {
+			t.Errorf("expected %s to be excluded", p)
+		}
+	}
+
+	for p := range found {
+		if strings.Contains(p, "node_modules") {
+			t.Errorf("node_modules content leaked into results: %s", p)
+		}
+	}
+}
@@ -0,0 +1,321 @@
+package app
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/ogefest/findex/models"
+)
+
+// Export formats
+const (
+	FormatNDJSON = "ndjson"
+	FormatCSV    = "csv"
+	FormatSQLite = "sqlite"
+)
+
+// exportColumns are the stable column names of every export format
+var exportColumns = []string{"index_name", "root", "path", "name", "ext", "size", "mod_time", "is_dir",
+	"link_target", "owner_name", "group_name", "mode"}
+
+// ExportRow is one exported file. NDJSON and CSV write mod_time as RFC 3339
+// in UTC and mode as an octal string, the SQLite snapshot as unix seconds and
+// an integer.
+type ExportRow struct {
+	IndexName  string    `json:"index_name"`
+	Root       string    `json:"root"`
+	Path       string    `json:"path"`
+	Name       string    `json:"name"`
+	Ext        string    `json:"ext"`
+	Size       int64     `json:"size"`
+	ModTime    time.Time `json:"mod_time"`
+	IsDir      bool      `json:"is_dir"`
+	LinkTarget string    `json:"link_target"`
+	Owner      string    `json:"owner_name"`
+	Group      string    `json:"group_name"`
+	Mode       string    `json:"mode"`
+}
+
+// exportRowFromRecord keeps the origin of imported files as their index, so
+// provenance survives further exports
+func exportRowFromRecord(f models.FileRecord) ExportRow {
+	row := ExportRow{
+		IndexName:  f.IndexName,
+		Root:       f.Dir,
+		Path:       f.Path,
+		Name:       f.Name,
+		Ext:        f.Ext,
+		Size:       f.Size,
+		ModTime:    f.ModTime.UTC(),
+		IsDir:      f.IsDir,
+		LinkTarget: f.LinkTarget,
+		Owner:      f.Owner,
+		Group:      f.Group,
+	}
+	if f.Origin != "" {
+		row.IndexName = f.Origin
+	}
+	if f.Mode != 0 {
+		row.Mode = fmt.Sprintf("%04o", f.Mode)
+	}
+	return row
+}
+
+// exportWriter writes rows in one export format
+type exportWriter interface {
+	write(row ExportRow) error
+	close() error
+}
+
+type ndjsonWriter struct {
+	enc *json.Encoder
+}
+
+func (e *ndjsonWriter) write(row ExportRow) error { return e.enc.Encode(row) }
+func (e *ndjsonWriter) close() error              { return nil }
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func newCSVWriter(w io.Writer) (*csvWriter, error) {
+	c := &csvWriter{w: csv.NewWriter(w)}
+	return c, c.w.Write(exportColumns)
+}
+
+func (c *csvWriter) write(row ExportRow) error {
+	return c.w.Write([]string{row.IndexName, row.Root, row.Path, row.Name, row.Ext,
+		strconv.FormatInt(row.Size, 10), row.ModTime.Format(time.RFC3339), strconv.FormatBool(row.IsDir),
+		row.LinkTarget, row.Owner, row.Group, row.Mode})
+}
+
+func (c *csvWriter) close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// sqliteWriter fills a temporary database and copies it to w on close, as a
+// database file cannot be written as a stream
+type sqliteWriter struct {
+	w    io.Writer
+	path string
+	db   *sql.DB
+	tx   *sql.Tx
+	stmt *sql.Stmt
+}
+
+func newSQLiteWriter(w io.Writer) (*sqliteWriter, error) {
+	tmp, err := os.CreateTemp("", "findex-export-*.db")
+	if err != nil {
+		return nil, err
+	}
+	tmp.Close()
+
+	s := &sqliteWriter{w: w, path: tmp.Name()}
+	if err := s.open(); err != nil {
+		s.cleanup()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *sqliteWriter) open() error {
+	var err error
+	if s.db, err = sql.Open("sqlite", s.path); err != nil {
+		return err
+	}
+	if _, err := s.db.Exec(`
+		CREATE TABLE files (
+			index_name TEXT,
+			root TEXT,
+			path TEXT NOT NULL,
+			name TEXT NOT NULL,
+			ext TEXT,
+			size INTEGER,
+			mod_time INTEGER,
+			is_dir INTEGER,
+			link_target TEXT,
+			owner_name TEXT,
+			group_name TEXT,
+			mode INTEGER
+		)`); err != nil {
+		return err
+	}
+	if s.tx, err = s.db.Begin(); err != nil {
+		return err
+	}
+	s.stmt, err = s.tx.Prepare(`INSERT INTO files (index_name, root, path, name, ext, size, mod_time, is_dir, link_target, owner_name, group_name, mode)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	return err
+}
+
+func (s *sqliteWriter) write(row ExportRow) error {
+	mode, _ := strconv.ParseUint(row.Mode, 8, 32)
+	_, err := s.stmt.Exec(row.IndexName, row.Root, row.Path, row.Name, row.Ext, row.Size, row.ModTime.Unix(),
+		row.IsDir, row.LinkTarget, row.Owner, row.Group, mode)
+	return err
+}
+
+func (s *sqliteWriter) close() error {
+	defer s.cleanup()
+
+	s.stmt.Close()
+	if err := s.tx.Commit(); err != nil {
+		return err
+	}
+	if err := s.db.Close(); err != nil {
+		return err
+	}
+
+	f, err := os.Open(s.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(s.w, f)
+	return err
+}
+
+func (s *sqliteWriter) cleanup() {
+	if s.db != nil {
+		s.db.Close()
+	}
+	os.Remove(s.path)
+	os.Remove(s.path + "-journal")
+}
+
+func newExportWriter(w io.Writer, format string) (exportWriter, error) {
+	switch format {
+	case FormatNDJSON:
+		return &ndjsonWriter{enc: json.NewEncoder(w)}, nil
+	case FormatCSV:
+		return newCSVWriter(w)
+	case FormatSQLite:
+		return newSQLiteWriter(w)
+	default:
+		return nil, fmt.Errorf("unknown export format %q", format)
+	}
+}
+
+// Export writes the files of every index of the searcher matching query and
+// filter to w, indexes in name order. An empty query and filter export whole
+// indexes. Rows are streamed from the database, so memory use does not grow
+// with the index. Export returns the number of rows written.
+func (s *Searcher) Export(w io.Writer, format, query string, filter *FileFilter) (int64, error) {
+	q, err := s.compile(query, filter)
+	if err != nil {
+		return 0, err
+	}
+	out, err := newExportWriter(w, format)
+	if err != nil {
+		return 0, err
+	}
+
+	sqlQuery, args, ok := searchStatement(q, "", nil)
+	if !ok {
+		sqlQuery = `SELECT ` + fileColumns + `, 0 FROM ` + fileTables + ` ORDER BY f.id`
+	}
+
+	names := make([]string, 0, len(s.dbs))
+	for name := range s.dbs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var count int64
+	for _, name := range names {
+		if err := s.checkIndex(q, name); err != nil {
+			log.Printf("Index %s left out of the export: %v", name, err)
+			continue
+		}
+		n, err := exportRows(s.dbs[name], out, q, sqlQuery, args)
+		count += n
+		if err != nil {
+			out.close()
+			return count, err
+		}
+	}
+	return count, out.close()
+}
+
+// exportRows writes the rows of sqlQuery, a searchStatement of q, dropping
+// the fuzzy candidates too far from the terms
+func exportRows(db *sql.DB, out exportWriter, q *Query, sqlQuery string, args []any) (int64, error) {
+	rows, err := db.Query(sqlQuery, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var count int64
+	var score float64
+	for rows.Next() {
+		f, err := scanFileRecord(scoredRow{rows, &score})
+		if err != nil {
+			return count, err
+		}
+		if q.Filter.MatchMode == MatchFuzzy && q.fuzzyDistance(f.Name) < 0 {
+			continue
+		}
+		if err := out.write(exportRowFromRecord(f)); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, rows.Err()
+}
+
+// ExportIndexes exports the indexes named in indexNames, all configured
+// indexes when empty, with Searcher.Export
+func ExportIndexes(w io.Writer, configPath string, indexNames []string, format, query string, filter *FileFilter) (int64, error) {
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		return 0, err
+	}
+	indexes, err := configIndexes(cfg, indexNames)
+	if err != nil {
+		return 0, err
+	}
+
+	searcher, err := NewSearcher(indexes)
+	if err != nil {
+		return 0, err
+	}
+	defer searcher.Close()
+
+	return searcher.Export(w, format, query, filter)
+}
+
+// configIndexes returns the indexes of cfg named in names, all of them when
+// names is empty
+func configIndexes(cfg *models.AppConfig, names []string) ([]*models.IndexConfig, error) {
+	var result []*models.IndexConfig
+	if len(names) == 0 {
+		for i := range cfg.Indexes {
+			result = append(result, &cfg.Indexes[i])
+		}
+		return result, nil
+	}
+
+	for _, name := range names {
+		var found *models.IndexConfig
+		for i := range cfg.Indexes {
+			if cfg.Indexes[i].Name == name {
+				found = &cfg.Indexes[i]
+			}
+		}
+		if found == nil {
+			return nil, fmt.Errorf("index not found: %s", name)
+		}
+		result = append(result, found)
+	}
+	return result, nil
+}
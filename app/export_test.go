@@ -0,0 +1,100 @@
+package app
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExport(t *testing.T) {
+	db, dbPath, cleanup := setupTestDB(t)
+	defer cleanup()
+	createTestFiles(t, db, "test-index")
+
+	searcher := createSearcher(t, dbPath, "test-index")
+	defer searcher.Close()
+
+	t.Run("ndjson exports the whole index", func(t *testing.T) {
+		var out bytes.Buffer
+		count, err := searcher.Export(&out, FormatNDJSON, "", nil)
+		if err != nil {
+			t.Fatalf("Export failed: %v", err)
+		}
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		if count != 8 || len(lines) != 8 {
+			t.Fatalf("expected 8 rows, got count %d and %d lines", count, len(lines))
+		}
+
+		var row map[string]any
+		if err := json.Unmarshal([]byte(lines[0]), &row); err != nil {
+			t.Fatalf("invalid json line: %v", err)
+		}
+		for _, column := range exportColumns {
+			if _, ok := row[column]; !ok {
+				t.Errorf("row is missing column %q: %v", column, row)
+			}
+		}
+		if row["path"] != "documents/report.pdf" || row["index_name"] != "test-index" {
+			t.Errorf("unexpected first row: %v", row)
+		}
+	})
+
+	t.Run("csv uses the filter", func(t *testing.T) {
+		var out bytes.Buffer
+		count, err := searcher.Export(&out, FormatCSV, "", &FileFilter{Exts: []string{"pdf", "txt"}})
+		if err != nil {
+			t.Fatalf("Export failed: %v", err)
+		}
+		records, err := csv.NewReader(&out).ReadAll()
+		if err != nil {
+			t.Fatalf("invalid csv: %v", err)
+		}
+		if count != 2 || len(records) != 3 {
+			t.Fatalf("expected header and 2 rows, got count %d and %v", count, records)
+		}
+		if strings.Join(records[0], ",") != strings.Join(exportColumns, ",") {
+			t.Errorf("unexpected header %v", records[0])
+		}
+	})
+
+	t.Run("sqlite snapshot of a search", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "export.db")
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatalf("failed to create file: %v", err)
+		}
+		count, err := searcher.Export(f, FormatSQLite, "movie", nil)
+		f.Close()
+		if err != nil {
+			t.Fatalf("Export failed: %v", err)
+		}
+		if count != 1 {
+			t.Fatalf("expected 1 row, got %d", count)
+		}
+
+		snapshot, err := sql.Open("sqlite", path)
+		if err != nil {
+			t.Fatalf("failed to open snapshot: %v", err)
+		}
+		defer snapshot.Close()
+		var name string
+		var size int64
+		if err := snapshot.QueryRow(`SELECT name, size FROM files`).Scan(&name, &size); err != nil {
+			t.Fatalf("query failed: %v", err)
+		}
+		if name != "movie.mp4" || size != 500*1024*1024 {
+			t.Errorf("unexpected row %s %d", name, size)
+		}
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		if _, err := searcher.Export(&bytes.Buffer{}, "xml", "", nil); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
@@ -0,0 +1,301 @@
+package app
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FacetValue is one value of a facet with the number of results having it.
+// Refine holds the search form parameters, see ParseFilter, that narrow the
+// search to the value, nil when the filter cannot express it.
+type FacetValue struct {
+	Label  string
+	Count  int64
+	Refine url.Values
+}
+
+// Facets break the results of a search down by extension, index, year of
+// modification, size and the folder below the root they are in. Like Count
+// they read at most countLimit results of an index, Exact is false when
+// they stopped there or an index failed.
+type Facets struct {
+	Ext     []FacetValue
+	Index   []FacetValue
+	Year    []FacetValue
+	Size    []FacetValue
+	Folder  []FacetValue
+	Exact   bool
+	Indexes []IndexStatus
+}
+
+// Facet is a named facet, see Facets.List
+type Facet struct {
+	Name   string
+	Values []FacetValue
+}
+
+// List returns the facets in the order they are shown
+func (f *Facets) List() []Facet {
+	return []Facet{
+		{"Type", f.Ext},
+		{"Index", f.Index},
+		{"Year", f.Year},
+		{"Size", f.Size},
+		{"Folder", f.Folder},
+	}
+}
+
+// maxFacetValues is how many values of the extension, year and folder
+// facets are kept, those with the most results
+const maxFacetValues = 10
+
+// sizeBuckets are the ranges of the size facet, each up to the next
+const sizeBuckets = `0 1MB 100MB 1GB 10GB`
+
+type sizeBucket struct {
+	label    string
+	min, max int64 // max 0 for no upper bound
+}
+
+var facetSizes = func() []sizeBucket {
+	bounds := strings.Fields(sizeBuckets)
+	var buckets []sizeBucket
+	for i, b := range bounds {
+		min, _ := ParseSize(b)
+		bucket := sizeBucket{label: "over " + b, min: min}
+		if i+1 < len(bounds) {
+			max, _ := ParseSize(bounds[i+1])
+			bucket.max = max - 1
+			bucket.label = b + " – " + bounds[i+1]
+			if i == 0 {
+				bucket.label = "under " + bounds[i+1]
+			}
+		}
+		buckets = append(buckets, bucket)
+	}
+	return buckets
+}()
+
+// facetCounts are the counts of one index, by facet and value
+type facetCounts struct {
+	total   int64
+	exact   bool
+	ext     map[string]int64
+	year    map[int]int64
+	size    []int64
+	folders map[string]int64 // by the path of the folder
+}
+
+func newFacetCounts() *facetCounts {
+	return &facetCounts{
+		exact:   true,
+		ext:     map[string]int64{},
+		year:    map[int]int64{},
+		size:    make([]int64, len(facetSizes)),
+		folders: map[string]int64{},
+	}
+}
+
+// add counts a result of extension ext, modified at mod, size bytes large,
+// in the directory dir below root
+func (c *facetCounts) add(ext string, mod, size int64, root, dir string) {
+	c.total++
+	c.ext[ext]++
+	c.year[time.Unix(mod, 0).UTC().Year()]++
+	for i := len(facetSizes) - 1; i >= 0; i-- {
+		if size >= facetSizes[i].min {
+			c.size[i]++
+			break
+		}
+	}
+	if folder := topFolder(root, dir); folder != "" {
+		c.folders[folder]++
+	}
+}
+
+// topFolder returns the folder directly below root that dir is in, empty
+// for dir being the root
+func topFolder(root, dir string) string {
+	prefix := strings.TrimSuffix(root, "/") + "/"
+	rel, ok := strings.CutPrefix(dir, prefix)
+	if !ok || rel == "" {
+		return ""
+	}
+	top, _, _ := strings.Cut(rel, "/")
+	return prefix + top
+}
+
+// Facets counts the results of a search like Count by facet. It runs on its
+// own, so it can run next to SearchPage.
+func (s *Searcher) Facets(ctx context.Context, query string, filter *FileFilter) (*Facets, error) {
+	q, err := s.compile(query, filter)
+	if err != nil {
+		return nil, err
+	}
+	counts, statuses := fanOut(ctx, s, func(ctx context.Context, name string, db *sql.DB) (*facetCounts, error) {
+		if err := s.checkIndex(q, name); err != nil {
+			return nil, err
+		}
+		return facetIndex(ctx, db, q)
+	})
+
+	facets := &Facets{Exact: true, Indexes: statuses}
+	merged := newFacetCounts()
+	for i, c := range counts {
+		if c == nil {
+			// Like Count, only failed indexes make the counts inexact
+			facets.Exact = facets.Exact && statuses[i].Skipped
+			continue
+		}
+		facets.Exact = facets.Exact && c.exact
+		for k, n := range c.ext {
+			merged.ext[k] += n
+		}
+		for k, n := range c.year {
+			merged.year[k] += n
+		}
+		for k, n := range c.size {
+			merged.size[k] += n
+		}
+		for k, n := range c.folders {
+			merged.folders[k] += n
+		}
+		if c.total > 0 {
+			name := statuses[i].Index
+			facets.Index = append(facets.Index, FacetValue{name, c.total, url.Values{"index[]": {name}}})
+		}
+	}
+
+	for ext, n := range merged.ext {
+		v := FacetValue{Label: ext, Count: n}
+		if ext == "" {
+			v.Label = "(none)"
+		} else {
+			v.Refine = url.Values{"ext": {strings.TrimPrefix(ext, ".")}}
+		}
+		facets.Ext = append(facets.Ext, v)
+	}
+	facets.Ext = topFacetValues(facets.Ext)
+
+	for year, n := range merged.year {
+		facets.Year = append(facets.Year, FacetValue{strconv.Itoa(year), n, url.Values{
+			"date_from": {fmt.Sprintf("%04d-01-01", year)},
+			"date_to":   {fmt.Sprintf("%04d-12-31", year)},
+		}})
+	}
+	facets.Year = topFacetValues(facets.Year)
+	// The most frequent years, newest first
+	slices.SortFunc(facets.Year, func(a, b FacetValue) int { return strings.Compare(b.Label, a.Label) })
+
+	for i, n := range merged.size {
+		if n == 0 {
+			continue
+		}
+		b := facetSizes[i]
+		refine := url.Values{"min_size": {""}, "max_size": {""}}
+		if b.min > 0 {
+			refine.Set("min_size", strconv.FormatInt(b.min, 10))
+		}
+		if b.max > 0 {
+			refine.Set("max_size", strconv.FormatInt(b.max, 10))
+		}
+		facets.Size = append(facets.Size, FacetValue{b.label, n, refine})
+	}
+
+	for folder, n := range merged.folders {
+		facets.Folder = append(facets.Folder, FacetValue{folder, n, url.Values{"in": {folder}}})
+	}
+	facets.Folder = topFacetValues(facets.Folder)
+	return facets, nil
+}
+
+// topFacetValues keeps the maxFacetValues values with the most results,
+// ordered by count and then label
+func topFacetValues(values []FacetValue) []FacetValue {
+	slices.SortFunc(values, func(a, b FacetValue) int {
+		if c := cmp.Compare(b.Count, a.Count); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Label, b.Label)
+	})
+	if len(values) > maxFacetValues {
+		values = values[:maxFacetValues]
+	}
+	return values
+}
+
+// facetIndex counts the results of q in one index by facet, reading at most
+// countLimit of them
+func facetIndex(ctx context.Context, db *sql.DB, q *Query) (*facetCounts, error) {
+	counts := newFacetCounts()
+
+	if q.Filter.MatchMode == MatchFuzzy {
+		// Only comparing the candidates tells the results
+		sqlQuery, args, ok := searchStatement(q, "", nil)
+		if !ok {
+			return counts, nil
+		}
+		rows, err := db.QueryContext(ctx, sqlQuery+" LIMIT ?", append(args, fuzzyCandidates)...)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		var score float64
+		var candidates int64
+		for rows.Next() {
+			f, err := scanFileRecord(scoredRow{rows, &score})
+			if err != nil {
+				return nil, err
+			}
+			candidates++
+			if q.fuzzyDistance(f.Name) >= 0 {
+				counts.add(f.Ext, f.ModTime.Unix(), f.Size, f.Dir, filepath.Dir(f.Path))
+			}
+		}
+		counts.exact = candidates < fuzzyCandidates
+		return counts, rows.Err()
+	}
+
+	sources := []func(*Query) (string, *sqlWhere, bool){searchSource}
+	columns := []string{`COALESCE(f.ext, ''), COALESCE(f.mod_time, 0), COALESCE(f.size, 0), COALESCE(r.path, d.path), d.path`}
+	if q.searchesDeleted() {
+		sources = append(sources, tombstoneSource)
+		columns = append(columns, `COALESCE(f.ext, ''), COALESCE(f.mod_time, 0), COALESCE(f.size, 0), COALESCE(f.root, f.dir), f.dir`)
+	}
+	for i, source := range sources {
+		from, where, ok := source(q)
+		if !ok {
+			continue
+		}
+		rows, err := db.QueryContext(ctx, `SELECT `+columns[i]+` FROM `+from+` WHERE `+where.String()+` LIMIT ?`,
+			append(where.Args(), countLimit+1-counts.total)...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var ext, root, dir string
+			var mod, size int64
+			if err := rows.Scan(&ext, &mod, &size, &root, &dir); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			counts.add(ext, mod, size, root, dir)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	if counts.total > countLimit {
+		counts.exact = false
+	}
+	return counts, nil
+}
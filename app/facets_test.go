@@ -0,0 +1,119 @@
+package app
+
+import (
+	"context"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ogefest/findex/models"
+)
+
+func TestFacets(t *testing.T) {
+	var configs []*models.IndexConfig
+	for _, name := range []string{"archive", "media"} {
+		db, dbPath, cleanup := setupTestDB(t)
+		defer cleanup()
+		files := []struct {
+			path string
+			size int64
+			year int
+		}{
+			{"photos/beach.jpg", 3 << 20, 2023},
+			{"photos/city.jpg", 200 << 10, 2024},
+			{"photos/raw/beach.cr2", 30 << 20, 2024},
+			{"video/beach.mp4", 2 << 30, 2022},
+		}
+		if name == "media" {
+			files = files[:2]
+		}
+		for _, f := range files {
+			base := path.Base(f.path)
+			insertTestFile(t, db, models.FileRecord{
+				IndexName: name, Path: f.path, Name: base, Ext: path.Ext(base), Size: f.size,
+				ModTime: time.Date(f.year, 6, 1, 0, 0, 0, 0, time.UTC),
+			})
+		}
+		configs = append(configs, &models.IndexConfig{Name: name, DBPath: dbPath})
+	}
+	searcher, err := NewSearcher(configs)
+	if err != nil {
+		t.Fatalf("NewSearcher failed: %v", err)
+	}
+	defer searcher.Close()
+
+	facets, err := searcher.Facets(context.Background(), "", &FileFilter{OnlyFiles: true})
+	if err != nil {
+		t.Fatalf("Facets failed: %v", err)
+	}
+	if !facets.Exact || len(FailedIndexes(facets.Indexes)) != 0 {
+		t.Errorf("expected exact facets of both indexes, got %+v", facets)
+	}
+
+	labels := func(values []FacetValue) map[string]int64 {
+		counts := map[string]int64{}
+		for _, v := range values {
+			counts[v.Label] = v.Count
+		}
+		return counts
+	}
+	for _, tt := range []struct {
+		facet    string
+		values   []FacetValue
+		expected map[string]int64
+	}{
+		{"ext", facets.Ext, map[string]int64{".jpg": 4, ".cr2": 1, ".mp4": 1}},
+		{"index", facets.Index, map[string]int64{"archive": 4, "media": 2}},
+		{"year", facets.Year, map[string]int64{"2024": 3, "2023": 2, "2022": 1}},
+		{"size", facets.Size, map[string]int64{"under 1MB": 2, "1MB – 100MB": 3, "1GB – 10GB": 1}},
+	} {
+		if got := labels(tt.values); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%s facet = %v, expected %v", tt.facet, got, tt.expected)
+		}
+	}
+
+	// Most results first, years newest first
+	if facets.Ext[0].Label != ".jpg" || facets.Year[0].Label != "2024" {
+		t.Errorf("unexpected order of %+v and %+v", facets.Ext, facets.Year)
+	}
+
+	// Refining by a value finds as many results as it counted
+	for _, values := range [][]FacetValue{facets.Ext, facets.Year, facets.Size} {
+		for _, v := range values {
+			filter := ParseFilter(v.Refine)
+			filter.OnlyFiles = true
+			count, err := searcher.Count(context.Background(), "", filter)
+			if err != nil || count.Total != v.Count {
+				t.Errorf("refining by %s (%s) counts %d (%v), expected %d", v.Label, v.Refine.Encode(), count.Total, err, v.Count)
+			}
+		}
+	}
+
+	// Facets follow the query
+	facets, err = searcher.Facets(context.Background(), "beach", nil)
+	if err != nil {
+		t.Fatalf("Facets failed: %v", err)
+	}
+	if got := labels(facets.Index); !reflect.DeepEqual(got, map[string]int64{"archive": 3, "media": 1}) {
+		t.Errorf("index facet for beach = %v", got)
+	}
+}
+
+func TestTopFolder(t *testing.T) {
+	tests := []struct {
+		root, dir, expected string
+	}{
+		{"/mnt/media", "/mnt/media", ""},
+		{"/mnt/media", "/mnt/media/photos", "/mnt/media/photos"},
+		{"/mnt/media", "/mnt/media/photos/2024/summer", "/mnt/media/photos"},
+		{"/", "/home/user", "/home"},
+		{"/mnt/media", "/mnt/other", ""},
+		{"/mnt/media", "/mnt/media2/photos", ""},
+	}
+	for _, tt := range tests {
+		if got := topFolder(tt.root, tt.dir); got != tt.expected {
+			t.Errorf("topFolder(%q, %q) = %q, expected %q", tt.root, tt.dir, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// DefaultSearchTimeout is how long a search waits for its indexes when the
+// searcher has no Timeout
+const DefaultSearchTimeout = 10 * time.Second
+
+// ErrIndexTimeout is the error of an index that did not answer a search
+// within the timeout
+var ErrIndexTimeout = errors.New("timed out")
+
+// IndexStatus reports how one index answered a search
+type IndexStatus struct {
+	Index    string
+	Duration time.Duration
+	Err      error // why the results of the index are missing, nil when it answered
+	Skipped  bool  // not searched, it cannot run the match mode; Err says why
+}
+
+// FailedIndexes returns the statuses of the indexes missing from a result
+func FailedIndexes(statuses []IndexStatus) []IndexStatus {
+	var failed []IndexStatus
+	for _, st := range statuses {
+		if st.Err != nil {
+			failed = append(failed, st)
+		}
+	}
+	return failed
+}
+
+// indexesError joins the errors of the failed indexes, nil when none failed
+func indexesError(statuses []IndexStatus) error {
+	var errs []error
+	for _, st := range FailedIndexes(statuses) {
+		errs = append(errs, fmt.Errorf("index %s: %w", st.Index, st.Err))
+	}
+	return errors.Join(errs...)
+}
+
+func (s *Searcher) timeout() time.Duration {
+	if s.Timeout > 0 {
+		return s.Timeout
+	}
+	return DefaultSearchTimeout
+}
+
+// fanOut runs search on every index of s at once and returns their results
+// and statuses in index name order. Indexes that fail or do not answer
+// before the timeout leave a zero result; the context of a late search is
+// cancelled and fanOut does not wait for it to return.
+func fanOut[T any](ctx context.Context, s *Searcher, search func(ctx context.Context, name string, db *sql.DB) (T, error)) ([]T, []IndexStatus) {
+	timeout := s.timeout()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	names := make([]string, 0, len(s.dbs))
+	for name := range s.dbs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	type answer struct {
+		i      int
+		result T
+		err    error
+		took   time.Duration
+	}
+	// Buffered, so searches answering after the timeout do not block
+	answers := make(chan answer, len(names))
+	start := time.Now()
+	for i, name := range names {
+		go func() {
+			result, err := search(ctx, name, s.dbs[name])
+			answers <- answer{i, result, err, time.Since(start)}
+		}()
+	}
+
+	results := make([]T, len(names))
+	statuses := make([]IndexStatus, len(names))
+	answered := make([]bool, len(names))
+	for pending := len(names); pending > 0; pending-- {
+		select {
+		case a := <-answers:
+			answered[a.i] = true
+			if a.err != nil && ctx.Err() != nil {
+				// Interrupted by the timeout
+				a.err = lateError(ctx, timeout)
+			}
+			statuses[a.i] = IndexStatus{Index: names[a.i], Duration: a.took, Err: a.err, Skipped: errors.Is(a.err, ErrNoTrigramIndex)}
+			if a.err == nil {
+				results[a.i] = a.result
+			}
+		case <-ctx.Done():
+			for i, name := range names {
+				if !answered[i] {
+					statuses[i] = IndexStatus{Index: name, Duration: time.Since(start), Err: lateError(ctx, timeout)}
+				}
+			}
+			return results, statuses
+		}
+	}
+	return results, statuses
+}
+
+// lateError is the status of an index whose search ctx ended
+func lateError(ctx context.Context, timeout time.Duration) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w after %s", ErrIndexTimeout, timeout)
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,96 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ogefest/findex/models"
+)
+
+func TestFanOut(t *testing.T) {
+	s := &Searcher{
+		dbs:     map[string]*sql.DB{"broken": nil, "fast": nil, "slow": nil},
+		Timeout: 100 * time.Millisecond,
+	}
+	errBroken := errors.New("database is locked")
+
+	start := time.Now()
+	results, statuses := fanOut(context.Background(), s, func(ctx context.Context, name string, _ *sql.DB) (int, error) {
+		switch name {
+		case "broken":
+			return 1, errBroken
+		case "slow":
+			// Ignores the deadline, fanOut must not wait for it
+			time.Sleep(2 * time.Second)
+		}
+		return 2, nil
+	})
+	if took := time.Since(start); took > time.Second {
+		t.Errorf("fanOut waited %s for the slow index", took)
+	}
+
+	if !reflect.DeepEqual(results, []int{0, 2, 0}) {
+		t.Errorf("results = %v, expected only the fast index", results)
+	}
+	var names []string
+	for _, st := range statuses {
+		names = append(names, st.Index)
+	}
+	if !reflect.DeepEqual(names, []string{"broken", "fast", "slow"}) {
+		t.Errorf("statuses are for %v, expected index name order", names)
+	}
+	if !errors.Is(statuses[0].Err, errBroken) || statuses[1].Err != nil || !errors.Is(statuses[2].Err, ErrIndexTimeout) {
+		t.Errorf("unexpected statuses %+v", statuses)
+	}
+	if failed := FailedIndexes(statuses); len(failed) != 2 {
+		t.Errorf("expected 2 failed indexes, got %+v", failed)
+	}
+}
+
+// A broken index leaves out its own results only
+func TestSearch_PartialResults(t *testing.T) {
+	var configs []*models.IndexConfig
+	for _, name := range []string{"good", "broken"} {
+		db, dbPath, cleanup := setupTestDB(t)
+		defer cleanup()
+		createTestFiles(t, db, name)
+		if name == "broken" {
+			if _, err := db.Exec(`DROP TABLE files_fts`); err != nil {
+				t.Fatalf("failed to drop files_fts: %v", err)
+			}
+		}
+		configs = append(configs, &models.IndexConfig{Name: name, DBPath: dbPath})
+	}
+	searcher, err := NewSearcher(configs)
+	if err != nil {
+		t.Fatalf("NewSearcher failed: %v", err)
+	}
+	defer searcher.Close()
+
+	results, err := searcher.Search("report", nil, 100)
+	if err == nil || !strings.Contains(err.Error(), "index broken") {
+		t.Errorf("expected an error naming the broken index, got %v", err)
+	}
+	if len(results) != 1 || results[0].IndexName != "good" {
+		t.Errorf("expected report.pdf of the good index, got %+v", results)
+	}
+
+	page, err := searcher.SearchPage(context.Background(), "report", nil, "", 10)
+	if err != nil {
+		t.Fatalf("SearchPage failed: %v", err)
+	}
+	failed := FailedIndexes(page.Indexes)
+	if len(page.Results) != 1 || len(failed) != 1 || failed[0].Index != "broken" {
+		t.Errorf("expected one result and the broken index failed, got %d results and %+v", len(page.Results), page.Indexes)
+	}
+
+	count, err := searcher.Count(context.Background(), "report", nil)
+	if err != nil || count.Total != 1 || count.Exact {
+		t.Errorf("Count = %+v (%v), expected 1 and inexact", count, err)
+	}
+}
@@ -0,0 +1,16 @@
+package app
+
+// fileID identifies a file on disk independent of the path used to reach it
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+// fileStat holds the on-disk identity and allocation of a file
+type fileStat struct {
+	id        fileID
+	nlink     int64
+	allocated int64 // bytes allocated on disk, less than the size for sparse files
+	uid       uint32
+	gid       uint32
+}
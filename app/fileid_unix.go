@@ -0,0 +1,31 @@
+//go:build !windows
+
+package app
+
+import (
+	"os"
+	"syscall"
+)
+
+// statFileID returns the device and inode numbers behind info
+func statFileID(info os.FileInfo) (fileID, bool) {
+	st, ok := statFile(info)
+	return st.id, ok
+}
+
+// statFile returns identity, link count, allocated size and ownership behind
+// info.
+// st_blocks is always counted in 512-byte units.
+func statFile(info os.FileInfo) (fileStat, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileStat{}, false
+	}
+	return fileStat{
+		id:        fileID{dev: uint64(st.Dev), ino: uint64(st.Ino)},
+		nlink:     int64(st.Nlink),
+		allocated: int64(st.Blocks) * 512,
+		uid:       st.Uid,
+		gid:       st.Gid,
+	}, true
+}
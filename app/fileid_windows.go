@@ -0,0 +1,17 @@
+//go:build windows
+
+package app
+
+import "os"
+
+// statFileID is not available on Windows; loop detection falls back to
+// resolved paths and one_file_system has no effect.
+func statFileID(info os.FileInfo) (fileID, bool) {
+	return fileID{}, false
+}
+
+// statFile is not available on Windows; files are stored without device and
+// inode numbers and every file counts towards unique totals.
+func statFile(info os.FileInfo) (fileStat, bool) {
+	return fileStat{}, false
+}
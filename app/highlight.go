@@ -0,0 +1,155 @@
+package app
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/ogefest/findex/models"
+)
+
+// markTerm is a word or phrase of a query whose matches are marked in the
+// results. The full-text tables store no content, so FTS5 highlight() and
+// snippet() have nothing to cut from; the matches are found again here.
+type markTerm struct {
+	text   string
+	prefix bool // the last word matches as a prefix
+	path   bool // from a path: qualifier, matches the directories only
+}
+
+// wordToken is a word of a text split like the unicode61 tokenizer does,
+// with its byte range. Words are compared lower case; unlike the tokenizer
+// this does not fold diacritics, so such matches are not marked.
+type wordToken struct {
+	start, end int
+	folded     []rune
+	offsets    []int // byte offset of every rune of folded
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r) || unicode.Is(unicode.Co, r)
+}
+
+func wordTokens(text string) []wordToken {
+	var tokens []wordToken
+	var cur *wordToken
+	for i, r := range text {
+		if !isWordRune(r) {
+			cur = nil
+			continue
+		}
+		if cur == nil {
+			tokens = append(tokens, wordToken{start: i})
+			cur = &tokens[len(tokens)-1]
+		}
+		cur.folded = append(cur.folded, unicode.ToLower(r))
+		cur.offsets = append(cur.offsets, i)
+		cur.end = i + len(string(r))
+	}
+	return tokens
+}
+
+// markWords returns the byte ranges where the words of term follow each
+// other in tokens, the last one only as a prefix when prefix is set
+func markWords(tokens []wordToken, term []wordToken, prefix bool) []models.Span {
+	var spans []models.Span
+	for i := 0; i+len(term) <= len(tokens); i++ {
+		end, ok := 0, true
+		for j, w := range term {
+			t := tokens[i+j]
+			last := prefix && j == len(term)-1
+			if last && len(t.folded) >= len(w.folded) && string(t.folded[:len(w.folded)]) == string(w.folded) {
+				end = t.end
+				if len(w.folded) < len(t.folded) {
+					end = t.offsets[len(w.folded)]
+				}
+			} else if !last && string(t.folded) == string(w.folded) {
+				end = t.end
+			} else {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			spans = append(spans, models.Span{Start: tokens[i].start, End: end})
+		}
+	}
+	return spans
+}
+
+// markSubstrings returns the byte ranges of text holding sub, case-insensitive
+func markSubstrings(text, sub string) []models.Span {
+	var folded []rune
+	var offsets []int
+	for i, r := range text {
+		folded = append(folded, unicode.ToLower(r))
+		offsets = append(offsets, i)
+	}
+	offsets = append(offsets, len(text))
+	want := []rune(strings.ToLower(sub))
+	var spans []models.Span
+	for i := 0; len(want) > 0 && i+len(want) <= len(folded); i++ {
+		if string(folded[i:i+len(want)]) == string(want) {
+			spans = append(spans, models.Span{Start: offsets[i], End: offsets[i+len(want)]})
+		}
+	}
+	return spans
+}
+
+// markMatches sets the NameMatches and PathMatches of results, the parts of
+// their names and directories the terms of q match. Fuzzy matches and glob
+// patterns, which match whole names, are not marked.
+func (q *Query) markMatches(results []models.FileRecord) {
+	var regexps []*regexp.Regexp
+	for _, p := range q.names {
+		if p.re == "" || p.negated {
+			continue
+		}
+		if re, err := cachedRegexp(p.re); err == nil {
+			regexps = append(regexps, re)
+		}
+	}
+	terms := make([][]wordToken, len(q.marks))
+	for i, t := range q.marks {
+		terms[i] = wordTokens(t.text)
+	}
+	if len(regexps) == 0 && len(q.marks) == 0 {
+		return
+	}
+
+	for i := range results {
+		f := &results[i]
+		// The directories of the path, without the entry itself
+		dirEnd := max(strings.LastIndex(f.Path, "/"), 0)
+		nameTokens := wordTokens(f.Name)
+		dirTokens := wordTokens(f.Path[:dirEnd])
+
+		var name, path []models.Span
+		for j, t := range q.marks {
+			if len(terms[j]) == 0 {
+				continue
+			}
+			if !t.path {
+				switch q.Filter.MatchMode {
+				case MatchSubstring:
+					// The trigram index holds names only
+					name = append(name, markSubstrings(f.Name, t.text)...)
+					continue
+				case MatchFuzzy:
+					continue
+				}
+				name = append(name, markWords(nameTokens, terms[j], t.prefix)...)
+			}
+			path = append(path, markWords(dirTokens, terms[j], t.prefix)...)
+		}
+		for _, re := range regexps {
+			for _, m := range re.FindAllStringIndex(f.Name, -1) {
+				if m[1] > m[0] {
+					name = append(name, models.Span{Start: m[0], End: m[1]})
+				}
+			}
+		}
+		f.NameMatches = models.MergeSpans(name)
+		f.PathMatches = models.MergeSpans(path)
+	}
+}
@@ -0,0 +1,78 @@
+package app
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ogefest/findex/models"
+)
+
+func TestSearch_MarksMatches(t *testing.T) {
+	db, dbPath, cleanup := setupTestDB(t)
+	defer cleanup()
+	createTestFiles(t, db, "test-index")
+	if err := rebuildTrigram(db, true); err != nil {
+		t.Fatalf("rebuildTrigram failed: %v", err)
+	}
+	searcher := createSearcher(t, dbPath, "test-index")
+	defer searcher.Close()
+
+	tests := []struct {
+		query  string
+		filter *FileFilter
+		name   string // marked name of the first result
+		path   string // marked path of the first result
+	}{
+		{"report", nil, "[report].pdf", "documents/report.pdf"},
+		{"rep", nil, "[rep]ort.pdf", "documents/report.pdf"},
+		{`"report pdf"`, nil, "[report.pdf]", "documents/report.pdf"},
+		{"docu", &FileFilter{OnlyFiles: true, Sort: SortName}, "notes.txt", "[docu]ments/notes.txt"},
+		{"path:images screen", nil, "[screen]shot.png", "[images]/screenshot.png"},
+		{"screenshot -photo", nil, "[screenshot].png", "images/screenshot.png"},
+		{"-(photo OR report) notes", nil, "[notes].txt", "documents/notes.txt"},
+		{"eensho", &FileFilter{MatchMode: MatchSubstring}, "scr[eensho]t.png", "images/screenshot.png"},
+		{`re:o\.`, nil, "phot[o.]jpg", "images/photo.jpg"},
+		{"*.mp4", nil, "movie.mp4", "videos/movie.mp4"},
+	}
+	for _, tt := range tests {
+		results, err := searcher.Search(tt.query, tt.filter, 10)
+		if err != nil {
+			t.Fatalf("Search(%q) failed: %v", tt.query, err)
+		}
+		if len(results) == 0 {
+			t.Fatalf("Search(%q) found nothing", tt.query)
+		}
+		f := results[0]
+		if got := models.Mark(f.Name, f.NameMatches, "[", "]", nil); got != tt.name {
+			t.Errorf("Search(%q) marks name %s, expected %s", tt.query, got, tt.name)
+		}
+		if got := models.Mark(f.Path, f.PathMatches, "[", "]", nil); got != tt.path {
+			t.Errorf("Search(%q) marks path %s, expected %s", tt.query, got, tt.path)
+		}
+	}
+}
+
+func TestPathSnippet(t *testing.T) {
+	path := "/mnt/media/photos/2024/summer/beach/day one/IMG_0001.jpg"
+	names := func(parts []models.PathPart) []string {
+		var result []string
+		for _, p := range parts {
+			result = append(result, models.Mark(p.Name, p.Matches, "[", "]", nil))
+		}
+		return result
+	}
+
+	parts := models.PathSnippet(path, markWords(wordTokens(path[:43]), wordTokens("2024"), false), 2)
+	expected := []string{"mnt", "…", "[2024]", "…", "beach", "day one"}
+	if got := names(parts); !reflect.DeepEqual(got, expected) {
+		t.Errorf("snippet = %v, expected %v", got, expected)
+	}
+	if parts[2].Path != "/mnt/media/photos/2024" || !parts[1].Elided {
+		t.Errorf("unexpected parts %+v", parts)
+	}
+
+	short := models.PathSnippet("docs/report.pdf", nil, 2)
+	if got := names(short); !reflect.DeepEqual(got, []string{"docs"}) {
+		t.Errorf("snippet of a short path = %v", got)
+	}
+}
@@ -0,0 +1,227 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ogefest/findex/models"
+)
+
+// carryOverTombstones copies the tombstones of the database at prevPath into
+// db. Only indexes with keep_history carry them, so turning the option off
+// drops the history with the next scan.
+func carryOverTombstones(ctx context.Context, db *sql.DB, prevPath string) error {
+	if _, err := os.Stat(prevPath); os.IsNotExist(err) {
+		return nil
+	}
+
+	conn, err := attachPrevious(ctx, db, prevPath)
+	if err != nil {
+		return err
+	}
+	defer detachPrevious(conn)
+
+	_, err = conn.ExecContext(ctx, `
+		INSERT INTO main.tombstones (id, index_name, root, dir, name, ext, size, mod_time, first_seen, last_seen)
+		SELECT id, index_name, root, dir, name, ext, size, mod_time, first_seen, last_seen FROM prev.tombstones
+	`)
+	return err
+}
+
+// recordHistory updates the lifecycle history of db after a scan. Files keep
+// the first_seen of the same path in the database at prevPath, files this scan
+// journaled as removed become tombstones and tombstones of paths that are
+// back are dropped. Tombstones last seen more than retentionDays ago, or
+// beyond the newest maxFiles, are pruned; zero disables either limit.
+//
+// recordHistory reads the removed files from the change journal, so it runs
+// after recordChanges.
+func recordHistory(ctx context.Context, db *sql.DB, prevPath string, retentionDays, maxFiles int) error {
+	var scanID, scanTime int64
+	if err := db.QueryRowContext(ctx, `SELECT id, scan_time FROM scan_history ORDER BY id DESC LIMIT 1`).Scan(&scanID, &scanTime); err != nil {
+		return fmt.Errorf("no scan history entry for this scan: %w", err)
+	}
+
+	var conn *sql.Conn
+	var err error
+	_, statErr := os.Stat(prevPath)
+	hasPrev := statErr == nil
+	if hasPrev {
+		conn, err = attachPrevious(ctx, db, prevPath)
+		if err != nil {
+			return err
+		}
+		defer detachPrevious(conn)
+	} else {
+		conn, err = db.Conn(ctx)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var statements []sqlStatement
+	add := func(query string, args ...any) {
+		statements = append(statements, sqlStatement{query, args})
+	}
+
+	if hasPrev {
+		var prevScanTime int64
+		if err := tx.QueryRowContext(ctx, `SELECT COALESCE(MAX(scan_time), 0) FROM prev.scan_history`).Scan(&prevScanTime); err != nil {
+			return err
+		}
+
+		add(`
+			UPDATE main.files SET first_seen = COALESCE((
+				SELECT pf.first_seen
+				FROM main.dirs d
+				JOIN prev.dirs pd ON pd.path = d.path
+				JOIN prev.files pf ON pf.parent_id = pd.id AND pf.name = files.name
+				WHERE d.id = files.parent_id
+			), ?)`, scanTime)
+		add(`
+			INSERT INTO main.tombstones (index_name, root, dir, name, ext, size, mod_time, first_seen, last_seen)
+			SELECT pf.index_name, COALESCE(r.path, pd.path), pd.path, pf.name, pf.ext, pf.size, pf.mod_time, pf.first_seen, ?
+			FROM main.changes c
+			JOIN prev.dirs pd ON pd.path = c.dir
+			JOIN prev.files pf ON pf.parent_id = pd.id AND pf.name = c.name
+			LEFT JOIN prev.dirs r ON r.id = pd.root_id
+			WHERE c.scan_id = ? AND c.kind = ?
+			ON CONFLICT (dir, name) DO UPDATE SET
+				size = excluded.size, mod_time = excluded.mod_time, first_seen = excluded.first_seen, last_seen = excluded.last_seen`,
+			prevScanTime, scanID, models.ChangeRemoved)
+	} else {
+		add(`UPDATE main.files SET first_seen = ?`, scanTime)
+	}
+
+	add(`
+		DELETE FROM main.tombstones WHERE EXISTS (
+			SELECT 1 FROM main.dirs d
+			JOIN main.files f ON f.parent_id = d.id
+			WHERE d.path = tombstones.dir AND f.name = tombstones.name
+		)`)
+	if retentionDays > 0 {
+		add(`DELETE FROM main.tombstones WHERE last_seen < ?`, scanTime-int64(retentionDays)*24*3600)
+	}
+	if maxFiles > 0 {
+		add(`DELETE FROM main.tombstones WHERE id NOT IN (
+			SELECT id FROM main.tombstones ORDER BY last_seen DESC, id DESC LIMIT ?
+		)`, maxFiles)
+	}
+	add(`INSERT INTO main.tombstones_fts(tombstones_fts) VALUES('delete-all')`)
+	add(`INSERT INTO main.tombstones_fts(rowid, name, dir) SELECT id, name, dir FROM main.tombstones`)
+
+	for _, stmt := range statements {
+		if _, err := tx.ExecContext(ctx, stmt.query, stmt.args...); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// tombstoneColumns is the column list read by scanTombstone, selected from
+// tombstones aliased f so filterConditions apply unchanged
+const tombstoneColumns = `f.id, f.dir, f.name, COALESCE(f.root, f.dir), COALESCE(f.ext, ''), COALESCE(f.size, 0),
+	COALESCE(f.mod_time, 0), f.index_name, COALESCE(f.first_seen, 0), f.last_seen`
+
+// scanTombstone reads one row selected with tombstoneColumns
+func scanTombstone(row rowScanner) (models.FileRecord, error) {
+	f := models.FileRecord{Deleted: true}
+	var dir string
+	var mod, firstSeen, lastSeen int64
+	if err := row.Scan(&f.ID, &dir, &f.Name, &f.Dir, &f.Ext, &f.Size, &mod, &f.IndexName, &firstSeen, &lastSeen); err != nil {
+		return f, err
+	}
+	f.Path = entryPath(dir, f.Name)
+	f.ModTime = time.Unix(mod, 0)
+	f.FirstSeen = unixTime(firstSeen)
+	f.LastSeen = unixTime(lastSeen)
+	return f, nil
+}
+
+// tombstoneSource returns the FROM and WHERE of the tombstones matching a
+// compiled query. Tombstones only hold files without ownership, so filters
+// on directories, symlinks, owners or groups match none of them.
+func tombstoneSource(q *Query) (from string, where *sqlWhere, ok bool) {
+	filter := q.Filter
+	if filter.OnlyDirs || filter.OnlyLinks || filter.Owner != "" || filter.Group != "" {
+		return "", nil, false
+	}
+	filter.OnlyFiles = false // every tombstone is a file
+	// Tombstones keep their directory as a path, not as a dirs id
+	inDir := filter.InDir
+	filter.InDir = ""
+	where = &sqlWhere{}
+	if q.Match != "" {
+		where.add("tombstones_fts MATCH ?", q.Match)
+	}
+	filterConditions(where, &filter)
+	nameConditions(where, q.names)
+	if inDir != "" {
+		prefix := strings.TrimSuffix(inDir, "/") + "/"
+		where.add("(f.dir = ? OR substr(f.dir, 1, ?) = ?)", inDir, len(prefix), prefix)
+	}
+	if q.Exclude != "" {
+		where.add("f.id NOT IN (SELECT rowid FROM tombstones_fts WHERE tombstones_fts MATCH ?)", q.Exclude)
+	}
+	if where.empty() {
+		return "", nil, false
+	}
+
+	from = "tombstones f"
+	if q.Match != "" {
+		from += " JOIN tombstones_fts ft ON ft.rowid = f.id"
+	}
+	return from, where, true
+}
+
+// searchTombstones runs a search against the tombstones of deleted files of
+// the index name, in the sort order of the filter and after the cursor at
+// when it is not nil
+func searchTombstones(ctx context.Context, name string, db *sql.DB, q *Query, at *cursor, limit int) ([]searchHit, error) {
+	from, where, ok := tombstoneSource(q)
+	if !ok {
+		return nil, nil
+	}
+	score := "0"
+	if q.Match != "" {
+		score = ftsRankTombstones
+	}
+	if at != nil {
+		keysetCondition(where, &q.Filter, tombstoneSort, at, name, true)
+	}
+	sqlQuery := `
+			SELECT ` + tombstoneColumns + `, ` + score + ` AS score
+			FROM ` + from + `
+			WHERE ` + where.String() + `
+			ORDER BY ` + orderClause(&q.Filter, tombstoneSort) + `
+			LIMIT ?`
+	args := where.Args()
+
+	rows, err := db.QueryContext(ctx, sqlQuery, append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []searchHit
+	for rows.Next() {
+		var score float64
+		f, err := scanTombstone(scoredRow{rows, &score})
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, newHit(name, f, score))
+	}
+	return results, rows.Err()
+}
@@ -0,0 +1,180 @@
+package app
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestScanIndexes_KeepHistory(t *testing.T) {
+	fx := setupScanFixture(t, map[string]string{
+		"docs/report.pdf": "content",
+		"docs/draft.pdf":  "content",
+		"notes.txt":       "content",
+	}, "log_retention_days: 1", "keep_history: true", "trigram_index: true")
+	dataDir, dbPath := fx.dataDir, fx.dbPath
+
+	fx.scan(t)
+	db, err := openDB(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	var firstScan int64
+	db.QueryRow(`SELECT scan_time FROM scan_history ORDER BY id LIMIT 1`).Scan(&firstScan)
+	db.Close()
+
+	// Scans are a second apart so first and last seen can be told apart
+	time.Sleep(1100 * time.Millisecond)
+	if err := os.Remove(filepath.Join(dataDir, "docs", "draft.pdf")); err != nil {
+		t.Fatalf("failed to remove file: %v", err)
+	}
+	fx.scan(t)
+	time.Sleep(1100 * time.Millisecond)
+	fx.write(t, "new.txt", "new")
+	fx.scan(t)
+
+	searcher := createSearcher(t, dbPath, "test-index")
+	defer searcher.Close()
+
+	t.Run("files keep their first seen time", func(t *testing.T) {
+		results, err := searcher.Search("report", nil, 10)
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		if len(results) != 1 || results[0].FirstSeen.Unix() != firstScan {
+			t.Fatalf("expected report.pdf first seen at %d, got %+v", firstScan, results)
+		}
+
+		results, err = searcher.Search("new", nil, 10)
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		if len(results) != 1 || results[0].FirstSeen.Unix() <= firstScan {
+			t.Errorf("expected new.txt first seen in the last scan, got %+v", results)
+		}
+	})
+
+	t.Run("deleted files are hidden by default", func(t *testing.T) {
+		results, err := searcher.Search("draft", nil, 10)
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		if len(results) != 0 {
+			t.Errorf("expected no results, got %+v", results)
+		}
+	})
+
+	t.Run("tombstone survives later scans", func(t *testing.T) {
+		results, err := searcher.Search("draft", &FileFilter{IncludeDeleted: true}, 10)
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		if len(results) != 1 {
+			t.Fatalf("expected the deleted draft, got %+v", results)
+		}
+		f := results[0]
+		if !f.Deleted || f.Path != filepath.Join(dataDir, "docs", "draft.pdf") || f.Size != 7 {
+			t.Errorf("unexpected tombstone: %+v", f)
+		}
+		if f.FirstSeen.Unix() != firstScan || f.LastSeen.Unix() != firstScan {
+			t.Errorf("expected first and last seen %d, got %v and %v", firstScan, f.FirstSeen.Unix(), f.LastSeen.Unix())
+		}
+	})
+
+	t.Run("filters apply to tombstones", func(t *testing.T) {
+		results, err := searcher.Search("", &FileFilter{IncludeDeleted: true, Exts: []string{"pdf"}}, 10)
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		deleted := 0
+		for _, f := range results {
+			if f.Deleted {
+				deleted++
+			}
+		}
+		if len(results) != 2 || deleted != 1 {
+			t.Errorf("expected report.pdf and the deleted draft, got %+v", results)
+		}
+
+		results, err = searcher.Search("draft", &FileFilter{IncludeDeleted: true, OnlyDirs: true}, 10)
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		if len(results) != 0 {
+			t.Errorf("expected no deleted directories, got %+v", results)
+		}
+	})
+
+	t.Run("substring search reports that tombstones are left out", func(t *testing.T) {
+		page, err := searcher.SearchPage(context.Background(), "draf", &FileFilter{IncludeDeleted: true, MatchMode: MatchSubstring}, "", 10)
+		if err != nil {
+			t.Fatalf("SearchPage failed: %v", err)
+		}
+		if len(page.Results) != 0 || !page.DeletedSkipped {
+			t.Errorf("expected no results and deleted files skipped, got %+v", page)
+		}
+
+		page, err = searcher.SearchPage(context.Background(), "draft", &FileFilter{IncludeDeleted: true}, "", 10)
+		if err != nil {
+			t.Fatalf("SearchPage failed: %v", err)
+		}
+		if len(page.Results) != 1 || page.DeletedSkipped {
+			t.Errorf("expected the deleted draft, got %+v", page)
+		}
+	})
+
+	t.Run("file that comes back drops its tombstone", func(t *testing.T) {
+		fx.write(t, "docs/draft.pdf", "again")
+		fx.scan(t)
+
+		db, err := openDB(dbPath)
+		if err != nil {
+			t.Fatalf("failed to open db: %v", err)
+		}
+		defer db.Close()
+		var count int
+		db.QueryRow(`SELECT COUNT(*) FROM tombstones`).Scan(&count)
+		if count != 0 {
+			t.Errorf("expected no tombstones, got %d", count)
+		}
+	})
+}
+
+func TestRecordHistory_Retention(t *testing.T) {
+	db, dbPath, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	now := time.Now().Unix()
+	db.Exec(`INSERT INTO scan_history (scan_time, stats_json) VALUES (?, '{}')`, now)
+	for name, days := range map[string]int64{"a.txt": 40, "b.txt": 5, "c.txt": 2, "d.txt": 1} {
+		db.Exec(`INSERT INTO tombstones (dir, name, size, last_seen) VALUES ('/data', ?, 1, ?)`, name, now-days*24*3600)
+	}
+
+	// No previous database, only the limits apply
+	if err := recordHistory(t.Context(), db, dbPath+".missing", 30, 2); err != nil {
+		t.Fatalf("recordHistory failed: %v", err)
+	}
+
+	rows, err := db.Query(`SELECT name FROM tombstones ORDER BY last_seen DESC`)
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		rows.Scan(&name)
+		names = append(names, name)
+	}
+	if len(names) != 2 || names[0] != "d.txt" || names[1] != "c.txt" {
+		t.Errorf("expected the two newest tombstones, got %v", names)
+	}
+
+	var indexed int
+	db.QueryRow(`SELECT COUNT(*) FROM tombstones_fts WHERE tombstones_fts MATCH 'txt'`).Scan(&indexed)
+	if indexed != 2 {
+		t.Errorf("expected 2 searchable tombstones, got %d", indexed)
+	}
+}
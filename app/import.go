@@ -0,0 +1,406 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ogefest/findex/models"
+)
+
+// SourceCatalog is the source_engine of read-only indexes that are filled by
+// findex import and findex merge instead of a scan
+const SourceCatalog = "catalog"
+
+// catalogFormat returns the format of an exported catalog, format when set
+// and otherwise taken from the file extension
+func catalogFormat(path, format string) (string, error) {
+	if format == "" {
+		format = FormatNDJSON
+		if strings.EqualFold(filepath.Ext(path), ".csv") {
+			format = FormatCSV
+		}
+	}
+	if format != FormatNDJSON && format != FormatCSV {
+		return "", fmt.Errorf("cannot import format %q, use ndjson or csv", format)
+	}
+	return format, nil
+}
+
+// recordFromExportRow turns an exported row back into a file of indexName.
+// The index that scanned it is kept as its origin.
+func recordFromExportRow(indexName string, row ExportRow) (models.FileRecord, error) {
+	if row.Path == "" {
+		return models.FileRecord{}, fmt.Errorf("row without path")
+	}
+	f := models.FileRecord{
+		IndexName:  indexName,
+		Origin:     row.IndexName,
+		Path:       filepath.Clean(row.Path),
+		Name:       row.Name,
+		Dir:        filepath.Clean(row.Root),
+		Ext:        row.Ext,
+		Size:       row.Size,
+		ModTime:    row.ModTime,
+		IsDir:      row.IsDir,
+		LinkTarget: row.LinkTarget,
+		Owner:      row.Owner,
+		Group:      row.Group,
+	}
+	if f.Name == "" {
+		f.Name = filepath.Base(f.Path)
+	}
+	// Without a root every directory of the path would become one
+	if row.Root == "" {
+		f.Dir = filepath.Dir(f.Path)
+	}
+	if row.Mode != "" {
+		mode, err := strconv.ParseUint(row.Mode, 8, 32)
+		if err != nil {
+			return f, fmt.Errorf("invalid mode %q", row.Mode)
+		}
+		f.Mode = uint32(mode)
+	}
+	return f, nil
+}
+
+// catalogSource reads the files of catalogs written by findex export. A
+// catalog that cannot be read stops the walk, Err then reports why.
+type catalogSource struct {
+	indexName string
+	paths     []string
+	format    string
+	err       error
+}
+
+func (c *catalogSource) Name() string {
+	return "catalog"
+}
+
+func (c *catalogSource) Err() error {
+	return c.err
+}
+
+func (c *catalogSource) Walk() <-chan models.FileRecord {
+	out := make(chan models.FileRecord, 1000)
+	go func() {
+		defer close(out)
+		for _, path := range c.paths {
+			if err := c.read(path, out); err != nil {
+				c.err = fmt.Errorf("failed to import %s: %w", path, err)
+				return
+			}
+		}
+	}()
+	return out
+}
+
+func (c *catalogSource) read(path string, out chan<- models.FileRecord) error {
+	format, err := catalogFormat(path, c.format)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	emit := func(row ExportRow) error {
+		rec, err := recordFromExportRow(c.indexName, row)
+		if err != nil {
+			return err
+		}
+		out <- rec
+		return nil
+	}
+	if format == FormatCSV {
+		return readCSVCatalog(f, emit)
+	}
+	return readNDJSONCatalog(f, emit)
+}
+
+func readNDJSONCatalog(r io.Reader, emit func(ExportRow) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var row ExportRow
+		if err := json.Unmarshal(scanner.Bytes(), &row); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		if err := emit(row); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// readCSVCatalog reads columns by their header name, so only path is
+// required and the column order does not matter
+func readCSVCatalog(r io.Reader, emit func(ExportRow) error) error {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err != nil {
+		return fmt.Errorf("failed to read header: %w", err)
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[name] = i
+	}
+	if _, ok := columns["path"]; !ok {
+		return fmt.Errorf("header has no path column")
+	}
+
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		line, _ := cr.FieldPos(0)
+		value := func(name string) string {
+			if i, ok := columns[name]; ok {
+				return record[i]
+			}
+			return ""
+		}
+
+		row := ExportRow{
+			IndexName:  value("index_name"),
+			Root:       value("root"),
+			Path:       value("path"),
+			Name:       value("name"),
+			Ext:        value("ext"),
+			LinkTarget: value("link_target"),
+			Owner:      value("owner_name"),
+			Group:      value("group_name"),
+			Mode:       value("mode"),
+		}
+		if v := value("size"); v != "" {
+			if row.Size, err = strconv.ParseInt(v, 10, 64); err != nil {
+				return fmt.Errorf("line %d: invalid size %q", line, v)
+			}
+		}
+		if v := value("mod_time"); v != "" {
+			if row.ModTime, err = time.Parse(time.RFC3339, v); err != nil {
+				return fmt.Errorf("line %d: invalid mod_time %q", line, v)
+			}
+		}
+		if v := value("is_dir"); v != "" {
+			if row.IsDir, err = strconv.ParseBool(v); err != nil {
+				return fmt.Errorf("line %d: invalid is_dir %q", line, v)
+			}
+		}
+		if err := emit(row); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+}
+
+// mergeSource reads the files of other index databases. Entries keep the
+// index that scanned them as origin, also across repeated merges.
+type mergeSource struct {
+	indexName string
+	paths     []string
+	err       error
+}
+
+func (m *mergeSource) Name() string {
+	return "merge"
+}
+
+func (m *mergeSource) Err() error {
+	return m.err
+}
+
+func (m *mergeSource) Walk() <-chan models.FileRecord {
+	out := make(chan models.FileRecord, 1000)
+	go func() {
+		defer close(out)
+		for _, path := range m.paths {
+			if err := m.read(path, out); err != nil {
+				m.err = fmt.Errorf("failed to merge %s: %w", path, err)
+				return
+			}
+		}
+	}()
+	return out
+}
+
+func (m *mergeSource) read(path string, out chan<- models.FileRecord) error {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if err := RunMigrations(db); err != nil {
+		return err
+	}
+
+	rows, err := db.Query(`SELECT ` + fileColumns + ` FROM ` + fileTables + ` ORDER BY f.id`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		f, err := scanFileRecord(rows)
+		if err != nil {
+			return err
+		}
+		if f.Origin == "" {
+			f.Origin = f.IndexName
+		}
+		f.IndexName = m.indexName
+		f.ID = 0
+		out <- f
+	}
+	return rows.Err()
+}
+
+// ImportCatalogs replaces the contents of the catalog index indexName with
+// the files of NDJSON or CSV catalogs written by findex export. An empty
+// format is taken from each file's extension.
+func ImportCatalogs(configPath, indexName string, paths []string, format string) error {
+	if len(paths) == 0 {
+		return fmt.Errorf("no catalog files given")
+	}
+	for _, path := range paths {
+		if _, err := catalogFormat(path, format); err != nil {
+			return err
+		}
+	}
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		return err
+	}
+	idx, err := findCatalogIndex(cfg, indexName)
+	if err != nil {
+		return err
+	}
+	return fillCatalog(idx, &catalogSource{indexName: idx.Name, paths: paths, format: format}, paths)
+}
+
+// MergeIndexes replaces the contents of the catalog index indexName with the
+// files of the given indexes, each a configured index name or the path of an
+// index database. Entries with the same path are taken from the first
+// source that has them.
+func MergeIndexes(configPath, indexName string, sources []string) error {
+	if len(sources) == 0 {
+		return fmt.Errorf("no indexes to merge given")
+	}
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		return err
+	}
+	idx, err := findCatalogIndex(cfg, indexName)
+	if err != nil {
+		return err
+	}
+	target, err := filepath.Abs(idx.DBPath)
+	if err != nil {
+		return err
+	}
+
+	var paths []string
+	for _, source := range sources {
+		path := source
+		for _, other := range cfg.Indexes {
+			if other.Name == source {
+				path = other.DBPath
+			}
+		}
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		if abs == target {
+			return fmt.Errorf("cannot merge index %s into itself", indexName)
+		}
+		// sql.Open would create a missing database
+		if _, err := os.Stat(abs); err != nil {
+			return fmt.Errorf("index not found: %s", source)
+		}
+		paths = append(paths, abs)
+	}
+	return fillCatalog(idx, &mergeSource{indexName: idx.Name, paths: paths}, sources)
+}
+
+// findCatalogIndex returns the index indexName, which must use the catalog
+// source engine so a later scan does not replace what was imported
+func findCatalogIndex(cfg *models.AppConfig, indexName string) (models.IndexConfig, error) {
+	indexes, err := configIndexes(cfg, []string{indexName})
+	if err != nil {
+		return models.IndexConfig{}, err
+	}
+	idx := *indexes[0]
+	if idx.SourceEngine != SourceCatalog {
+		return idx, fmt.Errorf("index %s has source_engine %q, import and merge need %q", idx.Name, idx.SourceEngine, SourceCatalog)
+	}
+	return idx, nil
+}
+
+// fillCatalog rebuilds a catalog index from source the way a scan rebuilds
+// any other index, so history and the change journal work the same
+func fillCatalog(idx models.IndexConfig, source models.FileSource, from []string) error {
+	absDBPath, err := filepath.Abs(idx.DBPath)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path for index %s: %w", idx.Name, err)
+	}
+	if err := ensureIndex(idx); err != nil {
+		return fmt.Errorf("failed to init index %s: %w", idx.Name, err)
+	}
+
+	mainDB, err := sql.Open("sqlite", absDBPath)
+	if err != nil {
+		return fmt.Errorf("failed to open db: %w", err)
+	}
+	lastScan, err := getLastScan(mainDB)
+	if err != nil {
+		mainDB.Close()
+		return fmt.Errorf("failed to get last scan for index %s: %w", idx.Name, err)
+	}
+	var prevFiles, prevDirs int64
+	_ = mainDB.QueryRow(`SELECT COUNT(*) FROM files WHERE is_dir = 0`).Scan(&prevFiles)
+	_ = mainDB.QueryRow(`SELECT COUNT(*) FROM files WHERE is_dir = 1`).Scan(&prevDirs)
+	mainDB.Close()
+
+	logRetention := idx.LogRetentionDays
+	if logRetention == 0 {
+		logRetention = 30 // default 30 days
+	}
+	scanLogger, err := NewScanLogger(absDBPath, idx.Name, logRetention)
+	if err != nil {
+		log.Printf("Warning: failed to create scan logger: %v", err)
+	}
+	if scanLogger != nil {
+		scanLogger.LogSection("CATALOG " + strings.ToUpper(source.Name()))
+		for i, p := range from {
+			scanLogger.Log("  [%d] %s", i+1, p)
+		}
+		scanLogger.LogPreviousStats(prevFiles, prevDirs, lastScan)
+	}
+
+	log.Printf("Filling catalog index %s by %s of %s\n", idx.Name, source.Name(), strings.Join(from, ", "))
+	err = buildIndex(context.Background(), idx, absDBPath, source, scanLogger, prevFiles, prevDirs)
+	if scanLogger != nil {
+		scanLogger.Close()
+	}
+	return err
+}
@@ -0,0 +1,237 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// setupCatalogConfig scans one local index per name into tmpDir and writes a
+// config with those indexes and a catalog index "hq"
+func setupCatalogConfig(t *testing.T, tmpDir string, files map[string][]string) string {
+	t.Helper()
+
+	var config strings.Builder
+	config.WriteString("indexes:\n")
+	for name, paths := range files {
+		dataDir := filepath.Join(tmpDir, name)
+		for _, p := range paths {
+			full := filepath.Join(dataDir, p)
+			if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+				t.Fatalf("failed to create dir: %v", err)
+			}
+			if err := os.WriteFile(full, []byte("content of "+p), 0644); err != nil {
+				t.Fatalf("failed to create file: %v", err)
+			}
+		}
+		fmt.Fprintf(&config, "  - name: %s\n    db_path: %s\n    source_engine: local\n    root_paths:\n      - %s\n",
+			name, filepath.Join(tmpDir, name+".db"), dataDir)
+	}
+	fmt.Fprintf(&config, "  - name: hq\n    db_path: %s\n    source_engine: catalog\n", filepath.Join(tmpDir, "hq.db"))
+
+	configPath := filepath.Join(tmpDir, "config.yaml")
+	if err := os.WriteFile(configPath, []byte(config.String()), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if err := ScanIndexes(cfg, true); err != nil {
+		t.Fatalf("ScanIndexes failed: %v", err)
+	}
+	return configPath
+}
+
+func TestImportCatalogs(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := setupCatalogConfig(t, tmpDir, map[string][]string{
+		"branch": {"docs/report.pdf", "docs/notes.txt", "video.mp4"},
+	})
+
+	catalogs := map[string]string{}
+	for _, format := range []string{FormatNDJSON, FormatCSV} {
+		path := filepath.Join(tmpDir, "branch."+format)
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatalf("failed to create file: %v", err)
+		}
+		_, err = ExportIndexes(f, configPath, []string{"branch"}, format, "", nil)
+		f.Close()
+		if err != nil {
+			t.Fatalf("ExportIndexes failed: %v", err)
+		}
+		catalogs[format] = path
+	}
+
+	hqDB := filepath.Join(tmpDir, "hq.db")
+	searchHQ := func(query string) []string {
+		t.Helper()
+		searcher := createSearcher(t, hqDB, "hq")
+		defer searcher.Close()
+		results, err := searcher.Search(query, nil, 100)
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		var found []string
+		for _, f := range results {
+			found = append(found, f.IndexName+"/"+f.Origin+":"+f.Name)
+		}
+		return found
+	}
+
+	for format, path := range catalogs {
+		t.Run(format+" round trip keeps provenance", func(t *testing.T) {
+			if err := ImportCatalogs(configPath, "hq", []string{path}, ""); err != nil {
+				t.Fatalf("ImportCatalogs failed: %v", err)
+			}
+			found := searchHQ("report")
+			if len(found) != 1 || found[0] != "hq/branch:report.pdf" {
+				t.Errorf("expected report.pdf from branch, got %v", found)
+			}
+
+			searcher := createSearcher(t, hqDB, "hq")
+			defer searcher.Close()
+			results, _ := searcher.Search("", &FileFilter{OnlyFiles: true}, 100)
+			if len(results) != 3 {
+				t.Errorf("expected 3 files, got %d", len(results))
+			}
+			for _, f := range results {
+				if f.Name == "report.pdf" && (f.Size != int64(len("content of docs/report.pdf")) || f.Path != filepath.Join(tmpDir, "branch", "docs", "report.pdf")) {
+					t.Errorf("unexpected imported file: %+v", f)
+				}
+			}
+		})
+	}
+
+	t.Run("broken catalog keeps the index", func(t *testing.T) {
+		broken := filepath.Join(tmpDir, "broken.ndjson")
+		if err := os.WriteFile(broken, []byte(`{"path": "/x/a.txt", "root": "/x"}`+"\nnot json\n"), 0644); err != nil {
+			t.Fatalf("failed to write catalog: %v", err)
+		}
+		err := ImportCatalogs(configPath, "hq", []string{broken}, "")
+		if err == nil || !strings.Contains(err.Error(), "line 2") {
+			t.Fatalf("expected an error for line 2, got %v", err)
+		}
+		if found := searchHQ("report"); len(found) != 1 {
+			t.Errorf("expected the previous import to stay, got %v", found)
+		}
+	})
+
+	t.Run("scans leave catalogs alone", func(t *testing.T) {
+		cfg, err := LoadConfig(configPath)
+		if err != nil {
+			t.Fatalf("LoadConfig failed: %v", err)
+		}
+		if err := ScanIndexes(cfg, true); err != nil {
+			t.Fatalf("ScanIndexes failed: %v", err)
+		}
+		if found := searchHQ("report"); len(found) != 1 {
+			t.Errorf("expected the import to survive a scan, got %v", found)
+		}
+	})
+
+	t.Run("only catalog indexes can be filled", func(t *testing.T) {
+		if err := ImportCatalogs(configPath, "branch", []string{catalogs[FormatNDJSON]}, ""); err == nil {
+			t.Error("expected an error for a local index")
+		}
+		if err := ImportCatalogs(configPath, "hq", []string{catalogs[FormatNDJSON]}, FormatSQLite); err == nil {
+			t.Error("expected an error for the sqlite format")
+		}
+	})
+}
+
+func TestMergeIndexes(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := setupCatalogConfig(t, tmpDir, map[string][]string{
+		"north": {"plans/north.dwg", "shared.txt"},
+		"south": {"plans/south.dwg"},
+	})
+
+	// Configured names and database paths are both accepted
+	if err := MergeIndexes(configPath, "hq", []string{"north", filepath.Join(tmpDir, "south.db")}); err != nil {
+		t.Fatalf("MergeIndexes failed: %v", err)
+	}
+
+	searcher := createSearcher(t, filepath.Join(tmpDir, "hq.db"), "hq")
+	defer searcher.Close()
+	results, err := searcher.Search("dwg", nil, 100)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	origins := map[string]string{}
+	for _, f := range results {
+		origins[f.Name] = f.Origin
+	}
+	if len(results) != 2 || origins["north.dwg"] != "north" || origins["south.dwg"] != "south" {
+		t.Errorf("expected a drawing from each office, got %v", origins)
+	}
+
+	if err := MergeIndexes(configPath, "hq", []string{"hq"}); err == nil {
+		t.Error("expected an error when merging a catalog into itself")
+	}
+	if err := MergeIndexes(configPath, "hq", []string{"missing"}); err == nil {
+		t.Error("expected an error for a missing index")
+	}
+}
+
+// Indexes holding the same paths merge into one entry per path, the first
+// index keeps it and the directory sizes count it once
+func TestMergeIndexes_OverlappingPaths(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := setupCatalogConfig(t, tmpDir, map[string][]string{
+		"north": {"plans/north.dwg", "shared.txt"},
+	})
+
+	// A second index of the same tree, like one scanned from another host
+	data, err := os.ReadFile(filepath.Join(tmpDir, "north.db"))
+	if err != nil {
+		t.Fatalf("failed to read db: %v", err)
+	}
+	mirrorDB := filepath.Join(tmpDir, "mirror.db")
+	if err := os.WriteFile(mirrorDB, data, 0644); err != nil {
+		t.Fatalf("failed to write db: %v", err)
+	}
+	db, err := openDB(mirrorDB)
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	if _, err := db.Exec(`UPDATE files SET index_name = 'mirror'`); err != nil {
+		t.Fatalf("failed to rename index: %v", err)
+	}
+	db.Close()
+
+	if err := MergeIndexes(configPath, "hq", []string{"north", mirrorDB}); err != nil {
+		t.Fatalf("MergeIndexes failed: %v", err)
+	}
+
+	searcher := createSearcher(t, filepath.Join(tmpDir, "hq.db"), "hq")
+	defer searcher.Close()
+	results, err := searcher.Search("", &FileFilter{OnlyFiles: true}, 100)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected each file once, got %d", len(results))
+	}
+	for _, f := range results {
+		if f.Origin != "north" {
+			t.Errorf("expected %s from the first index, got origin %q", f.Name, f.Origin)
+		}
+	}
+
+	hq, err := openDB(filepath.Join(tmpDir, "hq.db"))
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	defer hq.Close()
+	var files, size int64
+	if err := hq.QueryRow(`SELECT file_count, total_size FROM dir_sizes WHERE path = ?`, filepath.Join(tmpDir, "north")).Scan(&files, &size); err != nil {
+		t.Fatalf("failed to read the size of the root: %v", err)
+	}
+	if want := int64(len("content of plans/north.dwg") + len("content of shared.txt")); files != 2 || size != want {
+		t.Errorf("expected 2 files of %d bytes, got %d of %d", want, files, size)
+	}
+}
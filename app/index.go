@@ -3,7 +3,6 @@ package app
 import (
 	"database/sql"
 	"fmt"
-	"log"
 	"os"
 	"path/filepath"
 
@@ -14,9 +13,18 @@ func InitIndexes(cfg *models.AppConfig) error {
 	defined := map[string]bool{}
 
 	for _, idx := range cfg.Indexes {
-		if idx.SourceEngine != "local" {
+		if idx.SourceEngine != "local" && idx.SourceEngine != SourceCatalog {
 			return fmt.Errorf("unsupported source_engine %q for index %s", idx.SourceEngine, idx.Name)
 		}
+		// Imported catalogs have no roots or exclude rules to check
+		if idx.SourceEngine == "local" {
+			if _, err := newExcludeRules("", idx.ExcludePaths, idx.ExcludePatterns, idx.ExcludeRegex); err != nil {
+				return fmt.Errorf("invalid exclude rules for index %s: %w", idx.Name, err)
+			}
+			if _, _, err := ResolveRoots(idx); err != nil {
+				return fmt.Errorf("invalid roots for index %s: %w", idx.Name, err)
+			}
+		}
 
 		absDBPath, err := filepath.Abs(idx.DBPath)
 		if err != nil {
@@ -29,32 +37,7 @@ func InitIndexes(cfg *models.AppConfig) error {
 		}
 	}
 
-	dataDir, err := filepath.Abs("./data")
-	if err != nil {
-		return fmt.Errorf("failed to get absolute path for data dir: %w", err)
-	}
-
-	pattern := filepath.Join(dataDir, "*.db")
-	files, err := filepath.Glob(pattern)
-	if err != nil {
-		return fmt.Errorf("failed to glob data dir: %w", err)
-	}
-
-	for _, f := range files {
-		absFile, err := filepath.Abs(f)
-		if err != nil {
-			return err
-		}
-
-		if !defined[absFile] {
-			log.Printf("Removing unused index: %s\n", absFile)
-			if err := os.Remove(absFile); err != nil {
-				return err
-			}
-		}
-	}
-
-	return nil
+	return quarantineUnknownDBs(cfg, defined)
 }
 
 func ensureIndex(idx models.IndexConfig) error {
@@ -17,6 +17,11 @@ import (
 
 func ScanIndexes(cfg *models.AppConfig, forceScan bool) error {
 	for _, idx := range cfg.Indexes {
+		// Catalogs are only filled by findex import and merge
+		if idx.SourceEngine == SourceCatalog {
+			continue
+		}
+
 		absDBPath, err := filepath.Abs(idx.DBPath)
 		if err != nil {
 			return fmt.Errorf("failed to get absolute path for index %s: %w", idx.Name, err)
@@ -27,6 +32,10 @@ func ScanIndexes(cfg *models.AppConfig, forceScan bool) error {
 		if err != nil {
 			return fmt.Errorf("failed to open db: %w", err)
 		}
+		if err := RunMigrations(mainDB); err != nil {
+			mainDB.Close()
+			return fmt.Errorf("failed to migrate db for index %s: %w", idx.Name, err)
+		}
 
 		lastScan, err := getLastScan(mainDB)
 		if err != nil {
@@ -69,7 +78,21 @@ func ScanIndexes(cfg *models.AppConfig, forceScan bool) error {
 
 		switch idx.SourceEngine {
 		case "local":
-			source = NewLocalSource(idx.Name, idx.RootPaths, idx.ExcludePaths, idx.ScanWorkers, idx.ScanZipContents, scanLogger)
+			rootPaths, rootOptions, err := ResolveRoots(idx)
+			if err != nil {
+				if scanLogger != nil {
+					scanLogger.LogError("resolve_roots", idx.Name, err)
+					scanLogger.Close()
+				}
+				return fmt.Errorf("invalid roots for index %s: %w", idx.Name, err)
+			}
+			local := NewLocalSource(idx.Name, rootPaths, idx.ExcludePaths, idx.ScanWorkers, idx.ScanZipContents, scanLogger)
+			local.ExcludePatterns = idx.ExcludePatterns
+			local.ExcludeRegex = idx.ExcludeRegex
+			local.RootOptions = rootOptions
+			local.FollowSymlinks = idx.FollowSymlinks
+			local.OneFileSystem = idx.OneFileSystem
+			source = local
 		default:
 			if scanLogger != nil {
 				scanLogger.Log("Skipping unsupported source_engine %s for index %s", idx.SourceEngine, idx.Name)
@@ -84,108 +107,152 @@ func ScanIndexes(cfg *models.AppConfig, forceScan bool) error {
 			if forceScan {
 				scanLogger.Log("FORCE SCAN: Ignoring refresh_interval")
 			}
-			scanLogger.LogConfig(idx.RootPaths, idx.ExcludePaths, idx.ScanWorkers, idx.ScanZipContents)
+			scanLogger.LogConfig(idx)
 			scanLogger.LogPreviousStats(prevFiles, prevDirs, lastScan)
 		}
 
 		log.Printf("Scanning index %s using %s engine (scan_zip_contents=%v)\n", idx.Name, source.Name(), idx.ScanZipContents)
 
-		// Atomic database swap: scan into temp DB, then rename
-		tempDBPath := absDBPath + ".new"
-
-		// Clean up any leftover temp files from previous crash
-		os.Remove(tempDBPath)
-		os.Remove(tempDBPath + "-wal")
-		os.Remove(tempDBPath + "-shm")
+		err = buildIndex(context.Background(), idx, absDBPath, source, scanLogger, prevFiles, prevDirs)
 
-		// Initialize temp database with schema
-		tempDB, err := initTempDB(tempDBPath)
+		// Close logger (this will write the summary)
+		if scanLogger != nil {
+			scanLogger.Close()
+		}
 		if err != nil {
-			if scanLogger != nil {
-				scanLogger.LogError("init_temp_db", tempDBPath, err)
-				scanLogger.Close()
-			}
-			return fmt.Errorf("failed to init temp db for index %s: %w", idx.Name, err)
+			return err
 		}
+	}
+	return nil
+}
 
-		if err := scanSource(context.Background(), tempDB, source, idx.Name, scanLogger); err != nil {
-			tempDB.Close()
-			// Clean up temp files on error
-			os.Remove(tempDBPath)
-			os.Remove(tempDBPath + "-wal")
-			os.Remove(tempDBPath + "-shm")
-			if scanLogger != nil {
-				scanLogger.LogError("scan_source", idx.Name, err)
-				scanLogger.Close()
-			}
-			return fmt.Errorf("failed to scan index %s: %w", idx.Name, err)
+// buildIndex fills a fresh database for idx from source and atomically
+// swaps it in place of the database at absDBPath, carrying over history and
+// recording what changed. Errors are also written to scanLogger, which the
+// caller closes.
+func buildIndex(ctx context.Context, idx models.IndexConfig, absDBPath string, source models.FileSource, scanLogger *ScanLogger, prevFiles, prevDirs int64) error {
+	// Atomic database swap: scan into temp DB, then rename
+	tempDBPath := absDBPath + ".new"
+
+	// Clean up any leftover temp files from previous crash
+	os.Remove(tempDBPath)
+	os.Remove(tempDBPath + "-wal")
+	os.Remove(tempDBPath + "-shm")
+
+	// Initialize temp database with schema
+	tempDB, err := initTempDB(tempDBPath)
+	if err != nil {
+		if scanLogger != nil {
+			scanLogger.LogError("init_temp_db", tempDBPath, err)
 		}
+		return fmt.Errorf("failed to init temp db for index %s: %w", idx.Name, err)
+	}
 
-		// WAL checkpoint before rename to ensure all data is in main file
+	// Scan history and the change journal live in the index database,
+	// bring them over before the scan adds its own entry
+	if err := carryOverHistory(ctx, tempDB, absDBPath); err != nil {
+		log.Printf("Warning: failed to carry over scan history for index %s: %v", idx.Name, err)
 		if scanLogger != nil {
-			scanLogger.Log("Checkpointing WAL...")
-		}
-		log.Println("Checkpointing WAL...")
-		if _, err := tempDB.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
-			tempDB.Close()
-			os.Remove(tempDBPath)
-			os.Remove(tempDBPath + "-wal")
-			os.Remove(tempDBPath + "-shm")
+			scanLogger.LogError("carry_over_history", absDBPath, err)
+		}
+	}
+	if idx.KeepHistory {
+		if err := carryOverTombstones(ctx, tempDB, absDBPath); err != nil {
+			log.Printf("Warning: failed to carry over deleted files for index %s: %v", idx.Name, err)
 			if scanLogger != nil {
-				scanLogger.LogError("wal_checkpoint", tempDBPath, err)
-				scanLogger.Close()
+				scanLogger.LogError("carry_over_tombstones", absDBPath, err)
 			}
-			return fmt.Errorf("failed to checkpoint temp db for index %s: %w", idx.Name, err)
 		}
+	}
 
-		// Get new stats before closing temp DB
-		var currFiles, currDirs, totalSize int64
-		_ = tempDB.QueryRow(`SELECT COUNT(*) FROM files WHERE is_dir = 0`).Scan(&currFiles)
-		_ = tempDB.QueryRow(`SELECT COUNT(*) FROM files WHERE is_dir = 1`).Scan(&currDirs)
-		_ = tempDB.QueryRow(`SELECT COALESCE(SUM(size), 0) FROM files WHERE is_dir = 0`).Scan(&totalSize)
-
+	if err := scanSource(ctx, tempDB, source, idx.Name, scanLogger); err != nil {
 		tempDB.Close()
-
-		// Log comparison and final stats
+		// Clean up temp files on error
+		os.Remove(tempDBPath)
+		os.Remove(tempDBPath + "-wal")
+		os.Remove(tempDBPath + "-shm")
 		if scanLogger != nil {
-			scanLogger.LogDatabaseStats(currFiles, currDirs, totalSize)
-			scanLogger.LogComparison(prevFiles, currFiles, prevDirs, currDirs)
+			scanLogger.LogError("scan_source", idx.Name, err)
 		}
+		return fmt.Errorf("failed to scan index %s: %w", idx.Name, err)
+	}
 
-		// Atomic rename: replace main database with temp database
+	changes, err := recordChanges(ctx, tempDB, absDBPath)
+	if err != nil {
+		log.Printf("Warning: failed to record changes for index %s: %v", idx.Name, err)
 		if scanLogger != nil {
-			scanLogger.Log("Swapping database...")
+			scanLogger.LogError("record_changes", absDBPath, err)
 		}
-		log.Println("Swapping database...")
-		if err := os.Rename(tempDBPath, absDBPath); err != nil {
-			os.Remove(tempDBPath)
-			os.Remove(tempDBPath + "-wal")
-			os.Remove(tempDBPath + "-shm")
+	} else if scanLogger != nil {
+		scanLogger.LogChanges(changes)
+	}
+
+	if idx.KeepHistory {
+		if err := recordHistory(ctx, tempDB, absDBPath, idx.HistoryRetention, idx.HistoryMaxFiles); err != nil {
+			log.Printf("Warning: failed to record file history for index %s: %v", idx.Name, err)
 			if scanLogger != nil {
-				scanLogger.LogError("db_swap", absDBPath, err)
-				scanLogger.Close()
+				scanLogger.LogError("record_history", absDBPath, err)
 			}
-			return fmt.Errorf("failed to rename temp db for index %s: %w", idx.Name, err)
 		}
+	}
+
+	if err := rebuildTrigram(tempDB, idx.TrigramIndex); err != nil {
+		log.Printf("Warning: failed to build trigram index for index %s: %v", idx.Name, err)
+		if scanLogger != nil {
+			scanLogger.LogError("trigram_index", absDBPath, err)
+		}
+	}
 
-		// Clean up any leftover WAL/SHM files from temp
+	// WAL checkpoint before rename to ensure all data is in main file
+	if scanLogger != nil {
+		scanLogger.Log("Checkpointing WAL...")
+	}
+	log.Println("Checkpointing WAL...")
+	if _, err := tempDB.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+		tempDB.Close()
+		os.Remove(tempDBPath)
 		os.Remove(tempDBPath + "-wal")
 		os.Remove(tempDBPath + "-shm")
+		if scanLogger != nil {
+			scanLogger.LogError("wal_checkpoint", tempDBPath, err)
+		}
+		return fmt.Errorf("failed to checkpoint temp db for index %s: %w", idx.Name, err)
+	}
 
-		log.Printf("Index %s scan completed and atomically swapped\n", idx.Name)
+	// Get new stats before closing temp DB
+	var currFiles, currDirs, totalSize int64
+	_ = tempDB.QueryRow(`SELECT COUNT(*) FROM files WHERE is_dir = 0`).Scan(&currFiles)
+	_ = tempDB.QueryRow(`SELECT COUNT(*) FROM files WHERE is_dir = 1`).Scan(&currDirs)
+	_ = tempDB.QueryRow(`SELECT COALESCE(SUM(size), 0) FROM files WHERE is_dir = 0`).Scan(&totalSize)
 
-		// Close logger (this will write the summary)
+	tempDB.Close()
+
+	// Log comparison and final stats
+	if scanLogger != nil {
+		scanLogger.LogDatabaseStats(currFiles, currDirs, totalSize)
+		scanLogger.LogComparison(prevFiles, currFiles, prevDirs, currDirs)
+	}
+
+	// Atomic rename: replace main database with temp database
+	if scanLogger != nil {
+		scanLogger.Log("Swapping database...")
+	}
+	log.Println("Swapping database...")
+	if err := os.Rename(tempDBPath, absDBPath); err != nil {
+		os.Remove(tempDBPath)
+		os.Remove(tempDBPath + "-wal")
+		os.Remove(tempDBPath + "-shm")
 		if scanLogger != nil {
-			scanLogger.Close()
+			scanLogger.LogError("db_swap", absDBPath, err)
 		}
-
-		// Start background goroutine to calculate directory sizes
-		go func(dbPath string, indexName string) {
-			if err := CalculateDirSizesBackground(dbPath, indexName); err != nil {
-				log.Printf("Warning: background dir size calculation failed for %s: %v", indexName, err)
-			}
-		}(absDBPath, idx.Name)
+		return fmt.Errorf("failed to rename temp db for index %s: %w", idx.Name, err)
 	}
+
+	// Clean up any leftover WAL/SHM files from temp
+	os.Remove(tempDBPath + "-wal")
+	os.Remove(tempDBPath + "-shm")
+
+	log.Printf("Index %s scan completed and atomically swapped\n", idx.Name)
 	return nil
 }
 
@@ -216,8 +283,11 @@ func scanSource(ctx context.Context, db *sql.DB, source models.FileSource, index
 	log.Println("Scanning files...")
 
 	count := 0
+	duplicates := 0
 	batch := 100000
 	var batchFiles []models.FileRecord
+	dirs := newDirTree()
+	sizes := newDirSizeRollup()
 
 	for f := range source.Walk() {
 		batchFiles = append(batchFiles, f)
@@ -228,27 +298,51 @@ func scanSource(ctx context.Context, db *sql.DB, source models.FileSource, index
 			if scanLogger != nil {
 				scanLogger.LogBatchInsert(len(batchFiles), count)
 			}
-			if err := upsertFilesBatch(ctx, db, batchFiles); err != nil {
+			dropped, err := upsertFilesBatch(ctx, db, dirs, sizes, batchFiles)
+			if err != nil {
 				return fmt.Errorf("failed to upsert batch at %d files: %w", count, err)
 			}
+			duplicates += dropped
 			batchFiles = batchFiles[:0]
 			log.Printf("Saved %d files to database", count)
 		}
 	}
+	// A source that fails part way, like an unreadable catalog, must not
+	// replace the index with what it delivered so far
+	if failing, ok := source.(interface{ Err() error }); ok && failing.Err() != nil {
+		return failing.Err()
+	}
 	if len(batchFiles) > 0 {
 		log.Printf("Inserting final batch of %d files...", len(batchFiles))
 		if scanLogger != nil {
 			scanLogger.LogBatchInsert(len(batchFiles), count)
 		}
-		if err := upsertFilesBatch(ctx, db, batchFiles); err != nil {
+		dropped, err := upsertFilesBatch(ctx, db, dirs, sizes, batchFiles)
+		if err != nil {
 			return fmt.Errorf("failed to upsert final batch: %w", err)
 		}
+		duplicates += dropped
+	}
+	// Only a source combining several trees, like a merge of indexes that
+	// hold the same paths, delivers a path twice; the first one is kept
+	if duplicates > 0 {
+		log.Printf("Warning: %d files left out, their path was already taken by an earlier source", duplicates)
+		if scanLogger != nil {
+			scanLogger.Log("WARNING: %d files left out, their path was already taken by an earlier source", duplicates)
+		}
 	}
 
 	log.Printf("Scanning completed. Total files scanned: %d", count)
 	if scanLogger != nil {
 		scanLogger.Log("Scanning completed. Total records from source: %d", count)
 	}
+	// Directory sizes are stored before the swap, so browsing a fresh index
+	// never has to compute them
+	log.Println("Storing directory sizes...")
+	if err := sizes.store(ctx, db); err != nil {
+		return fmt.Errorf("failed to store directory sizes: %w", err)
+	}
+
 	log.Println("Finalizing index (this may take a while)...")
 	if err := finalizeIndex(db, indexName); err != nil {
 		return err
@@ -262,14 +356,17 @@ func scanSource(ctx context.Context, db *sql.DB, source models.FileSource, index
 	return nil
 }
 
-func upsertFilesBatch(ctx context.Context, db *sql.DB, files []models.FileRecord) error {
+// upsertFilesBatch inserts files and counts every stored one in sizes. A
+// path that is already stored keeps its entry; the files dropped that way
+// are returned.
+func upsertFilesBatch(ctx context.Context, db *sql.DB, dirs *dirTree, sizes *dirSizeRollup, files []models.FileRecord) (int, error) {
 	if len(files) == 0 {
-		return nil
+		return 0, nil
 	}
 
 	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	committed := false
 	defer func() {
@@ -279,21 +376,44 @@ func upsertFilesBatch(ctx context.Context, db *sql.DB, files []models.FileRecord
 	}()
 
 	stmt, err := tx.PrepareContext(ctx, `
-        INSERT INTO files(path, name, dir, ext, size, mod_time, is_dir, is_searchable, index_name, dir_index)
-        VALUES (?, ?, ?, ?, ?, ?, ?, 1, ?, ?)
-		ON CONFLICT(path) DO NOTHING;
+        INSERT INTO files(parent_id, name, ext, size, mod_time, is_dir, is_searchable, index_name, link_target,
+                          device, inode, nlink, disk_size, uid, gid, owner_name, group_name, mode, origin)
+        VALUES (?, ?, ?, ?, ?, ?, 1, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(parent_id, name) DO NOTHING;
     `)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer stmt.Close()
 
+	duplicates := 0
 	progressInterval := 25000
 	for i, f := range files {
-		_, err = stmt.ExecContext(ctx,
-			f.Path, f.Name, f.Dir, f.Ext, f.Size, f.ModTime.Unix(), boolToInt(f.IsDir), f.IndexName, f.DirIndex)
+		// Only the parent id and the last path element are stored, the path
+		// is rebuilt from dirs on read
+		parentID, err := dirs.ensure(ctx, tx, filepath.Dir(f.Path), f.Dir)
 		if err != nil {
-			return err
+			return 0, fmt.Errorf("failed to register parent of %s: %w", f.Path, err)
+		}
+		if f.IsDir {
+			if _, err := dirs.ensure(ctx, tx, f.Path, f.Dir); err != nil {
+				return 0, fmt.Errorf("failed to register directory %s: %w", f.Path, err)
+			}
+		}
+
+		result, err := stmt.ExecContext(ctx,
+			parentID, filepath.Base(f.Path), f.Ext, f.Size, f.ModTime.Unix(), boolToInt(f.IsDir), f.IndexName, nullIfEmpty(f.LinkTarget),
+			nullIfNoInode(f, f.Device), nullIfNoInode(f, f.Inode), nullIfNoInode(f, f.Links), nullIfNoInode(f, f.DiskSize),
+			nullIfNoInode(f, f.UID), nullIfNoInode(f, f.GID), nullIfEmpty(f.Owner), nullIfEmpty(f.Group), nullIfZeroMode(f.Mode), nullIfEmpty(f.Origin))
+		if err != nil {
+			return 0, err
+		}
+		if inserted, err := result.RowsAffected(); err != nil {
+			return 0, err
+		} else if inserted > 0 {
+			sizes.add(f)
+		} else if !f.IsDir {
+			duplicates++
 		}
 		if (i+1)%progressInterval == 0 {
 			log.Printf("  Inserted %d/%d files...", i+1, len(files))
@@ -302,11 +422,11 @@ func upsertFilesBatch(ctx context.Context, db *sql.DB, files []models.FileRecord
 
 	log.Println("  Committing transaction...")
 	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
 	}
 	committed = true
 
-	return nil
+	return duplicates, nil
 }
 
 func resetSearchableFlag(db *sql.DB) error {
@@ -323,16 +443,33 @@ func finalizeIndex(db *sql.DB, indexName string) error {
 	if _, err := db.Exec(`DELETE FROM files WHERE is_searchable = 0`); err != nil {
 		return err
 	}
+	if err := rebuildFTS(db); err != nil {
+		return err
+	}
+
+	log.Println("  Calculating and caching statistics...")
+	if err := calculateAndCacheStats(db, indexName); err != nil {
+		log.Printf("Warning: failed to cache stats: %v", err)
+	}
+
+	return nil
+}
+
+// rebuildFTS indexes every searchable file again
+func rebuildFTS(db *sql.DB) error {
 	log.Println("  Clearing FTS index...")
-	if _, err := db.Exec(`DELETE FROM files_fts`); err != nil {
+	if _, err := db.Exec(`INSERT INTO files_fts(files_fts) VALUES('delete-all')`); err != nil {
 		return err
 	}
+	// The FTS table is contentless: it indexes the name and the parent
+	// directory's path components without storing either string again
 	log.Println("  Rebuilding FTS index...")
 	if _, err := db.Exec(`
-		INSERT INTO files_fts(rowid, name, path)
-		SELECT id, name, path
-		FROM files
-		WHERE is_searchable = 2
+		INSERT INTO files_fts(rowid, name, dir, link_target)
+		SELECT f.id, f.name, d.path, COALESCE(f.link_target, '')
+		FROM files f
+		JOIN dirs d ON d.id = f.parent_id
+		WHERE f.is_searchable = 2
 	`); err != nil {
 		return err
 	}
@@ -341,29 +478,39 @@ func finalizeIndex(db *sql.DB, indexName string) error {
 	if _, err := db.Exec(`INSERT INTO files_fts(files_fts) VALUES('optimize')`); err != nil {
 		return err
 	}
+	return nil
+}
 
-	log.Println("  Calculating and caching statistics...")
-	if err := calculateAndCacheStats(db, indexName); err != nil {
-		log.Printf("Warning: failed to cache stats: %v", err)
+func calculateAndCacheStats(db *sql.DB, indexName string) error {
+	jsonData, err := cacheStats(db, indexName, time.Now())
+	if err != nil {
+		return err
+	}
+
+	// Save to scan history
+	if err := saveScanHistory(db, jsonData); err != nil {
+		log.Printf("Warning: failed to save scan history: %v", err)
 	}
 
 	return nil
 }
 
-func calculateAndCacheStats(db *sql.DB, indexName string) error {
+// cacheStats calculates the statistics of the index and stores them as the
+// stats cache, returning the cached JSON
+func cacheStats(db *sql.DB, indexName string, lastScan time.Time) ([]byte, error) {
 	stats := &models.IndexStats{Name: indexName}
 
 	// Total files and dirs
 	if err := db.QueryRow(`SELECT COUNT(*) FROM files WHERE is_dir = 0`).Scan(&stats.TotalFiles); err != nil {
-		return err
+		return nil, err
 	}
 	if err := db.QueryRow(`SELECT COUNT(*) FROM files WHERE is_dir = 1`).Scan(&stats.TotalDirs); err != nil {
-		return err
+		return nil, err
 	}
 
 	// Total size
-	if err := db.QueryRow(`SELECT COALESCE(SUM(size), 0) FROM files WHERE is_dir = 0`).Scan(&stats.TotalSize); err != nil {
-		return err
+	if err := loadSizeTotals(db, stats); err != nil {
+		return nil, err
 	}
 
 	// Average file size
@@ -380,24 +527,18 @@ func calculateAndCacheStats(db *sql.DB, indexName string) error {
 		stats.NewestFile = time.Unix(newestMod, 0)
 	}
 
-	// Last scan time - set to now since we're caching stats at scan time
-	stats.LastScan = time.Now()
+	stats.LastScan = lastScan
 
 	// Top 10 largest files
 	rows, err := db.Query(`
-		SELECT id, path, name, dir, ext, size, mod_time, is_dir, index_name
-		FROM files WHERE is_dir = 0
-		ORDER BY size DESC LIMIT 10
+		SELECT ` + fileColumns + `
+		FROM ` + fileTables + ` WHERE f.is_dir = 0
+		ORDER BY f.size DESC LIMIT 10
 	`)
 	if err == nil {
 		defer rows.Close()
 		for rows.Next() {
-			var f models.FileRecord
-			var mod int64
-			var isDir int
-			if err := rows.Scan(&f.ID, &f.Path, &f.Name, &f.Dir, &f.Ext, &f.Size, &mod, &isDir, &f.IndexName); err == nil {
-				f.ModTime = time.Unix(mod, 0)
-				f.IsDir = isDir != 0
+			if f, err := scanFileRecord(rows); err == nil {
 				stats.LargestFiles = append(stats.LargestFiles, f)
 			}
 		}
@@ -483,21 +624,19 @@ func calculateAndCacheStats(db *sql.DB, indexName string) error {
 		}
 	}
 
+	// Owners and groups
+	loadOwnerStats(db, stats)
+
 	// Recent files
 	rows, err = db.Query(`
-		SELECT id, path, name, dir, ext, size, mod_time, is_dir, index_name
-		FROM files WHERE is_dir = 0
-		ORDER BY mod_time DESC LIMIT 10
+		SELECT ` + fileColumns + `
+		FROM ` + fileTables + ` WHERE f.is_dir = 0
+		ORDER BY f.mod_time DESC LIMIT 10
 	`)
 	if err == nil {
 		defer rows.Close()
 		for rows.Next() {
-			var f models.FileRecord
-			var mod int64
-			var isDir int
-			if err := rows.Scan(&f.ID, &f.Path, &f.Name, &f.Dir, &f.Ext, &f.Size, &mod, &isDir, &f.IndexName); err == nil {
-				f.ModTime = time.Unix(mod, 0)
-				f.IsDir = isDir != 0
+			if f, err := scanFileRecord(rows); err == nil {
 				stats.RecentFiles = append(stats.RecentFiles, f)
 			}
 		}
@@ -506,19 +645,13 @@ func calculateAndCacheStats(db *sql.DB, indexName string) error {
 	// Cache stats as JSON
 	jsonData, err := json.Marshal(stats)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if err := setMetadata(db, "stats_cache", string(jsonData)); err != nil {
-		return err
-	}
-
-	// Save to scan history
-	if err := saveScanHistory(db, jsonData); err != nil {
-		log.Printf("Warning: failed to save scan history: %v", err)
+		return nil, err
 	}
-
-	return nil
+	return jsonData, nil
 }
 
 func saveScanHistory(db *sql.DB, statsJSON []byte) error {
@@ -578,6 +711,30 @@ func getLastScan(db *sql.DB) (time.Time, error) {
 	return t, nil
 }
 
+// nullIfEmpty stores optional text columns as NULL instead of an empty string
+func nullIfEmpty(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// nullIfNoInode stores v only for records that carry on-disk identity, so
+// entries without it (zip contents, Windows) are never merged as hardlinks
+func nullIfNoInode(f models.FileRecord, v int64) any {
+	if f.Inode == 0 {
+		return nil
+	}
+	return v
+}
+
+func nullIfZeroMode(m uint32) any {
+	if m == 0 {
+		return nil
+	}
+	return m
+}
+
 func boolToInt(b bool) int {
 	if b {
 		return 1
@@ -27,7 +27,6 @@ func TestUpsertFilesBatch(t *testing.T) {
 			Size:      100,
 			ModTime:   time.Now(),
 			IsDir:     false,
-			DirIndex:  12345,
 		},
 		{
 			IndexName: "test-index",
@@ -38,12 +37,11 @@ func TestUpsertFilesBatch(t *testing.T) {
 			Size:      200,
 			ModTime:   time.Now(),
 			IsDir:     false,
-			DirIndex:  12345,
 		},
 	}
 
 	t.Run("insert new files", func(t *testing.T) {
-		err := upsertFilesBatch(context.Background(), db, files)
+		_, err := upsertFilesBatch(context.Background(), db, newDirTree(), newDirSizeRollup(), files)
 		if err != nil {
 			t.Fatalf("upsertFilesBatch failed: %v", err)
 		}
@@ -62,10 +60,14 @@ func TestUpsertFilesBatch(t *testing.T) {
 
 	t.Run("duplicate paths are ignored", func(t *testing.T) {
 		// Insert same files again
-		err := upsertFilesBatch(context.Background(), db, files)
+		sizes := newDirSizeRollup()
+		duplicates, err := upsertFilesBatch(context.Background(), db, newDirTree(), sizes, files)
 		if err != nil {
 			t.Fatalf("upsertFilesBatch failed: %v", err)
 		}
+		if duplicates != 2 || len(sizes.dirs) != 0 {
+			t.Errorf("expected 2 duplicates left out of the sizes, got %d and %d directories", duplicates, len(sizes.dirs))
+		}
 
 		// Count should still be 2 (ON CONFLICT DO NOTHING)
 		var count int
@@ -80,7 +82,7 @@ func TestUpsertFilesBatch(t *testing.T) {
 	})
 
 	t.Run("empty batch", func(t *testing.T) {
-		err := upsertFilesBatch(context.Background(), db, []models.FileRecord{})
+		_, err := upsertFilesBatch(context.Background(), db, newDirTree(), newDirSizeRollup(), []models.FileRecord{})
 		if err != nil {
 			t.Errorf("empty batch should not error: %v", err)
 		}
@@ -92,12 +94,13 @@ func TestResetSearchableFlag(t *testing.T) {
 	defer cleanup()
 
 	// Insert files with is_searchable = 2
+	root := ensureTestDir(t, db, ".")
 	_, err := db.Exec(`
-		INSERT INTO files(path, name, dir, ext, size, mod_time, is_dir, is_searchable, index_name, dir_index)
+		INSERT INTO files(parent_id, name, ext, size, mod_time, is_dir, is_searchable, index_name)
 		VALUES
-			('file1.txt', 'file1.txt', '', '.txt', 100, 0, 0, 2, 'test', 0),
-			('file2.txt', 'file2.txt', '', '.txt', 200, 0, 0, 2, 'test', 0)
-	`)
+			(?, 'file1.txt', '.txt', 100, 0, 0, 2, 'test'),
+			(?, 'file2.txt', '.txt', 200, 0, 0, 2, 'test')
+	`, root, root)
 	if err != nil {
 		t.Fatalf("failed to insert test files: %v", err)
 	}
@@ -124,13 +127,14 @@ func TestFinalizeIndex(t *testing.T) {
 	defer cleanup()
 
 	// Insert files with different searchable states
+	root := ensureTestDir(t, db, ".")
 	_, err := db.Exec(`
-		INSERT INTO files(path, name, dir, ext, size, mod_time, is_dir, is_searchable, index_name, dir_index)
+		INSERT INTO files(parent_id, name, ext, size, mod_time, is_dir, is_searchable, index_name)
 		VALUES
-			('old_file.txt', 'old_file.txt', '', '.txt', 100, 0, 0, 0, 'test', 0),
-			('new_file.txt', 'new_file.txt', '', '.txt', 200, 0, 0, 1, 'test', 0),
-			('another_new.txt', 'another_new.txt', '', '.txt', 300, 0, 0, 1, 'test', 0)
-	`)
+			(?, 'old_file.txt', '.txt', 100, 0, 0, 0, 'test'),
+			(?, 'new_file.txt', '.txt', 200, 0, 0, 1, 'test'),
+			(?, 'another_new.txt', '.txt', 300, 0, 0, 1, 'test')
+	`, root, root, root)
 	if err != nil {
 		t.Fatalf("failed to insert test files: %v", err)
 	}
@@ -142,7 +146,7 @@ func TestFinalizeIndex(t *testing.T) {
 
 	t.Run("old files are deleted", func(t *testing.T) {
 		var count int
-		err = db.QueryRow("SELECT COUNT(*) FROM files WHERE path = 'old_file.txt'").Scan(&count)
+		err = db.QueryRow("SELECT COUNT(*) FROM files WHERE name = 'old_file.txt'").Scan(&count)
 		if err != nil {
 			t.Fatalf("failed to count: %v", err)
 		}
@@ -724,7 +728,7 @@ func TestMultipleRootPaths(t *testing.T) {
 		db, _, cleanup := setupTestDB(t)
 		defer cleanup()
 
-		err := upsertFilesBatch(context.Background(), db, allFiles)
+		_, err := upsertFilesBatch(context.Background(), db, newDirTree(), newDirSizeRollup(), allFiles)
 		if err != nil {
 			t.Fatalf("upsertFilesBatch failed: %v", err)
 		}
@@ -0,0 +1,226 @@
+package app
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ogefest/findex/models"
+)
+
+// Actions of findex maintain
+const (
+	MaintainCheck        = "check"
+	MaintainVacuum       = "vacuum"
+	MaintainRebuildFTS   = "rebuild-fts"
+	MaintainRebuildStats = "rebuild-stats"
+)
+
+// ErrIndexDamaged is returned by Maintain when a check finds problems
+var ErrIndexDamaged = errors.New("index check found problems")
+
+// CheckResult is what a check found in one index database. Missing and stale
+// FTS rows are fixed by rebuild-fts, orphaned directory sizes by the next
+// scan; integrity errors need a fresh scan.
+type CheckResult struct {
+	Integrity        []string // messages of PRAGMA integrity_check, empty when sound
+	FTSIntegrity     string   // error of the FTS5 integrity-check, empty when sound
+	MissingFromFTS   int64    // searchable files the full-text index does not know
+	StaleInFTS       int64    // full-text rows without a file
+	OrphanedDirSizes int64    // dir_sizes rows without a directory
+}
+
+// OK reports whether the check found no problem
+func (c CheckResult) OK() bool {
+	return len(c.Integrity) == 0 && c.FTSIntegrity == "" && c.MissingFromFTS == 0 && c.StaleInFTS == 0 &&
+		c.OrphanedDirSizes == 0
+}
+
+// checkIndex runs the consistency checks on an index database
+func checkIndex(db *sql.DB) (CheckResult, error) {
+	var result CheckResult
+
+	rows, err := db.Query(`PRAGMA integrity_check`)
+	if err != nil {
+		return result, err
+	}
+	for rows.Next() {
+		var msg string
+		if err := rows.Scan(&msg); err != nil {
+			rows.Close()
+			return result, err
+		}
+		if msg != "ok" {
+			result.Integrity = append(result.Integrity, msg)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return result, err
+	}
+
+	// The FTS table is contentless, its own check only covers its structure;
+	// whether it matches files is compared by rowid below
+	if _, err := db.Exec(`INSERT INTO files_fts(files_fts, rank) VALUES('integrity-check', 0)`); err != nil {
+		result.FTSIntegrity = err.Error()
+	}
+
+	for _, check := range []struct {
+		query string
+		dest  *int64
+	}{
+		{`SELECT COUNT(*) FROM files WHERE is_searchable = 2 AND id NOT IN (SELECT rowid FROM files_fts)`, &result.MissingFromFTS},
+		{`SELECT COUNT(*) FROM files_fts WHERE rowid NOT IN (SELECT id FROM files WHERE is_searchable = 2)`, &result.StaleInFTS},
+		{`SELECT COUNT(*) FROM dir_sizes s WHERE NOT EXISTS (SELECT 1 FROM dirs d WHERE d.path = s.path)`, &result.OrphanedDirSizes},
+	} {
+		if err := db.QueryRow(check.query).Scan(check.dest); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// vacuumIndex compacts an index database and returns its size in bytes
+// before and after
+func vacuumIndex(db *sql.DB, path string) (int64, int64, error) {
+	if _, err := db.Exec(`PRAGMA wal_checkpoint(TRUNCATE)`); err != nil {
+		return 0, 0, err
+	}
+	before := fileSize(path)
+	if _, err := db.Exec(`VACUUM`); err != nil {
+		return before, 0, err
+	}
+	if _, err := db.Exec(`PRAGMA wal_checkpoint(TRUNCATE)`); err != nil {
+		return before, 0, err
+	}
+	return before, fileSize(path), nil
+}
+
+func fileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// rebuildStats refreshes the cached statistics without adding a scan to the
+// scan history
+func rebuildStats(db *sql.DB, indexName string) error {
+	lastScan, err := getLastScan(db)
+	if err != nil {
+		return err
+	}
+	_, err = cacheStats(db, indexName, lastScan)
+	return err
+}
+
+// Maintain runs action on the indexes named in indexNames, all configured
+// indexes when empty, and writes a report per index to w. A check that finds
+// problems returns ErrIndexDamaged after every index was checked.
+func Maintain(w io.Writer, configPath string, indexNames []string, action string) error {
+	switch action {
+	case MaintainCheck, MaintainVacuum, MaintainRebuildFTS, MaintainRebuildStats:
+	default:
+		return fmt.Errorf("unknown maintenance action %q, use check, vacuum, rebuild-fts or rebuild-stats", action)
+	}
+
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		return err
+	}
+	indexes, err := configIndexes(cfg, indexNames)
+	if err != nil {
+		return err
+	}
+
+	damaged := false
+	for _, idx := range indexes {
+		ok, err := maintainIndex(w, idx, action)
+		if err != nil {
+			return fmt.Errorf("index %s: %w", idx.Name, err)
+		}
+		if !ok {
+			damaged = true
+		}
+	}
+	if damaged {
+		return ErrIndexDamaged
+	}
+	return nil
+}
+
+func maintainIndex(w io.Writer, idx *models.IndexConfig, action string) (bool, error) {
+	// sql.Open would create a missing database
+	if _, err := os.Stat(idx.DBPath); err != nil {
+		return false, err
+	}
+	db, err := sql.Open("sqlite", idx.DBPath)
+	if err != nil {
+		return false, err
+	}
+	defer db.Close()
+	db.Exec(`PRAGMA busy_timeout = 5000`)
+
+	if err := RunMigrations(db); err != nil {
+		return false, fmt.Errorf("failed to migrate: %w", err)
+	}
+
+	switch action {
+	case MaintainCheck:
+		result, err := checkIndex(db)
+		if err != nil {
+			return false, err
+		}
+		writeCheckResult(w, idx.Name, result)
+		return result.OK(), nil
+
+	case MaintainVacuum:
+		before, after, err := vacuumIndex(db, idx.DBPath)
+		if err != nil {
+			return false, err
+		}
+		fmt.Fprintf(w, "%s: vacuumed, %d -> %d bytes\n", idx.Name, before, after)
+
+	case MaintainRebuildFTS:
+		if err := rebuildFTS(db); err != nil {
+			return false, err
+		}
+		if err := rebuildTrigram(db, idx.TrigramIndex); err != nil {
+			return false, err
+		}
+		fmt.Fprintf(w, "%s: full-text index rebuilt\n", idx.Name)
+
+	case MaintainRebuildStats:
+		if err := rebuildStats(db, idx.Name); err != nil {
+			return false, err
+		}
+		fmt.Fprintf(w, "%s: statistics rebuilt\n", idx.Name)
+	}
+	return true, nil
+}
+
+func writeCheckResult(w io.Writer, indexName string, result CheckResult) {
+	if result.OK() {
+		fmt.Fprintf(w, "%s: ok\n", indexName)
+		return
+	}
+	fmt.Fprintf(w, "%s: problems found\n", indexName)
+	for _, msg := range result.Integrity {
+		fmt.Fprintf(w, "  integrity: %s\n", msg)
+	}
+	if result.FTSIntegrity != "" {
+		fmt.Fprintf(w, "  full-text index: %s\n", result.FTSIntegrity)
+	}
+	if result.MissingFromFTS > 0 {
+		fmt.Fprintf(w, "  %d files missing from the full-text index, run rebuild-fts\n", result.MissingFromFTS)
+	}
+	if result.StaleInFTS > 0 {
+		fmt.Fprintf(w, "  %d full-text rows without a file, run rebuild-fts\n", result.StaleInFTS)
+	}
+	if result.OrphanedDirSizes > 0 {
+		fmt.Fprintf(w, "  %d directory sizes without a directory, fixed by the next scan\n", result.OrphanedDirSizes)
+	}
+}
@@ -0,0 +1,108 @@
+package app
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestMaintain(t *testing.T) {
+	fx := setupScanFixture(t, map[string]string{
+		"docs/report.pdf": "content",
+		"notes.txt":       "content",
+	})
+	dbPath, configPath := fx.dbPath, fx.configPath
+	fx.scan(t)
+
+	maintain := func(action string) (string, error) {
+		var out bytes.Buffer
+		err := Maintain(&out, configPath, nil, action)
+		return out.String(), err
+	}
+
+	t.Run("fresh index is ok", func(t *testing.T) {
+		out, err := maintain(MaintainCheck)
+		if err != nil || out != "test-index: ok\n" {
+			t.Errorf("expected ok, got %q and %v", out, err)
+		}
+	})
+
+	t.Run("check finds damage and rebuild-fts repairs it", func(t *testing.T) {
+		db, err := openDB(dbPath)
+		if err != nil {
+			t.Fatalf("failed to open db: %v", err)
+		}
+		if _, err := db.Exec(`DELETE FROM files_fts WHERE rowid = (SELECT id FROM files WHERE name = 'notes.txt')`); err != nil {
+			t.Fatalf("failed to damage fts: %v", err)
+		}
+		if _, err := db.Exec(`INSERT INTO dir_sizes (path, total_size, file_count) VALUES ('/gone', 1, 1)`); err != nil {
+			t.Fatalf("failed to add dir size: %v", err)
+		}
+		db.Close()
+
+		out, err := maintain(MaintainCheck)
+		if err != ErrIndexDamaged {
+			t.Fatalf("expected ErrIndexDamaged, got %v", err)
+		}
+		for _, expected := range []string{"1 files missing from the full-text index", "1 directory sizes without a directory"} {
+			if !strings.Contains(out, expected) {
+				t.Errorf("report should contain %q, got:\n%s", expected, out)
+			}
+		}
+
+		if _, err := maintain(MaintainRebuildFTS); err != nil {
+			t.Fatalf("rebuild-fts failed: %v", err)
+		}
+		result := checkTestIndex(t, dbPath)
+		if result.MissingFromFTS != 0 || result.StaleInFTS != 0 || result.OrphanedDirSizes != 1 {
+			t.Errorf("expected only the orphaned dir size left, got %+v", result)
+		}
+	})
+
+	t.Run("rebuild-stats does not add a scan", func(t *testing.T) {
+		countScans := func() int {
+			db, err := openDB(dbPath)
+			if err != nil {
+				t.Fatalf("failed to open db: %v", err)
+			}
+			defer db.Close()
+			var n int
+			db.QueryRow(`SELECT COUNT(*) FROM scan_history`).Scan(&n)
+			return n
+		}
+		before := countScans()
+		if _, err := maintain(MaintainRebuildStats); err != nil {
+			t.Fatalf("rebuild-stats failed: %v", err)
+		}
+		if after := countScans(); after != before {
+			t.Errorf("expected %d scans, got %d", before, after)
+		}
+	})
+
+	t.Run("vacuum", func(t *testing.T) {
+		out, err := maintain(MaintainVacuum)
+		if err != nil || !strings.HasPrefix(out, "test-index: vacuumed") {
+			t.Errorf("unexpected vacuum result %q and %v", out, err)
+		}
+	})
+
+	t.Run("unknown action", func(t *testing.T) {
+		if _, err := maintain("defrag"); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
+
+func checkTestIndex(t *testing.T, dbPath string) CheckResult {
+	t.Helper()
+	db, err := openDB(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	defer db.Close()
+	result, err := checkIndex(db)
+	if err != nil {
+		t.Fatalf("checkIndex failed: %v", err)
+	}
+	return result
+}
@@ -2,20 +2,216 @@ package app
 
 import (
 	"database/sql"
-	_ "embed"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
 	"log"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
 
 	_ "modernc.org/sqlite"
 )
 
-//go:embed init.sql
-var initSQL string
+// Migrations are embedded SQL files named NNNN_description.sql, numbered
+// from 0001 without gaps. They are forward-only: a released file is never
+// edited, schema changes always go into a new file. Statements are split on
+// lines ending with ";" and lines starting with "--" are comments.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
 
+// ErrSchemaTooNew is returned when a database was upgraded by a newer
+// findex than the one opening it
+var ErrSchemaTooNew = errors.New("database schema is newer than this binary supports")
+
+// schemaVersionKey is the metadata key holding the applied migration number
+const schemaVersionKey = "schema_version"
+
+type migration struct {
+	version    int
+	name       string
+	statements []string
+}
+
+var migrations = mustLoadMigrations(migrationFiles)
+
+var (
+	migrationName = regexp.MustCompile(`^(\d{4})_([a-z0-9_]+)\.sql$`)
+	addColumnStmt = regexp.MustCompile(`(?is)^ALTER\s+TABLE\s+(\w+)\s+ADD\s+(?:COLUMN\s+)?(\w+)`)
+)
+
+func mustLoadMigrations(fsys fs.FS) []migration {
+	m, err := loadMigrations(fsys)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// loadMigrations reads and orders the migration files
+func loadMigrations(fsys fs.FS) ([]migration, error) {
+	paths, err := fs.Glob(fsys, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	// fs.Glob returns names in lexical order, which is numeric order here
+	var result []migration
+	for i, p := range paths {
+		match := migrationName.FindStringSubmatch(path.Base(p))
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name %s", p)
+		}
+		version, _ := strconv.Atoi(match[1])
+		if version != i+1 {
+			return nil, fmt.Errorf("migration %s out of sequence, expected version %d", p, i+1)
+		}
+		content, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, migration{
+			version:    version,
+			name:       match[2],
+			statements: splitStatements(string(content)),
+		})
+	}
+	return result, nil
+}
+
+// splitStatements splits a migration script into single statements
+func splitStatements(script string) []string {
+	var statements []string
+	var current strings.Builder
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		current.WriteString(line)
+		current.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			statements = append(statements, strings.TrimSpace(current.String()))
+			current.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(current.String()); rest != "" {
+		statements = append(statements, rest)
+	}
+	return statements
+}
+
+// LatestSchemaVersion returns the schema version this binary upgrades to
+func LatestSchemaVersion() int {
+	return len(migrations)
+}
+
+// SchemaVersion returns the migration number recorded in db, 0 for an empty
+// database or one created before versioned migrations existed
+func SchemaVersion(db *sql.DB) (int, error) {
+	return schemaVersion(db)
+}
+
+type queryRower interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+func schemaVersion(q queryRower) (int, error) {
+	var table string
+	err := q.QueryRow(`SELECT name FROM sqlite_master WHERE type = 'table' AND name = 'metadata'`).Scan(&table)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var value string
+	err = q.QueryRow(`SELECT value FROM metadata WHERE key = ?`, schemaVersionKey).Scan(&value)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	version, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", schemaVersionKey, value, err)
+	}
+	return version, nil
+}
+
+// RunMigrations upgrades db to the latest schema version. Databases without
+// a recorded version (created by older releases) start from the baseline,
+// whose statements are all idempotent.
 func RunMigrations(db *sql.DB) error {
-	_, err := db.Exec(initSQL)
+	current, err := schemaVersion(db)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	latest := LatestSchemaVersion()
+	if current > latest {
+		return fmt.Errorf("%w: database is at version %d, this binary supports up to %d", ErrSchemaTooNew, current, latest)
+	}
+
+	for _, m := range migrations[current:] {
+		applied, err := applyMigration(db, m)
+		if err != nil {
+			return fmt.Errorf("migration %04d_%s failed: %w", m.version, m.name, err)
+		}
+		if applied {
+			log.Printf("Applied migration %04d_%s", m.version, m.name)
+		}
 	}
-	log.Println("Migrations applied successfully")
 	return nil
 }
+
+// applyMigration runs one migration in its own transaction. It reports false
+// when another process applied it first.
+func applyMigration(db *sql.DB, m migration) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	current, err := schemaVersion(tx)
+	if err != nil {
+		return false, err
+	}
+	if current >= m.version {
+		return false, nil
+	}
+
+	for _, stmt := range m.statements {
+		// Columns may already exist in databases created from an unversioned
+		// schema that included them
+		if match := addColumnStmt.FindStringSubmatch(stmt); match != nil {
+			exists, err := columnExists(tx, match[1], match[2])
+			if err != nil {
+				return false, err
+			}
+			if exists {
+				continue
+			}
+		}
+		if _, err := tx.Exec(stmt); err != nil {
+			return false, fmt.Errorf("%w in statement: %s", err, stmt)
+		}
+	}
+
+	if _, err := tx.Exec(`INSERT OR REPLACE INTO metadata (key, value) VALUES (?, ?)`, schemaVersionKey, strconv.Itoa(m.version)); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+func columnExists(tx *sql.Tx, table, column string) (bool, error) {
+	var count int
+	err := tx.QueryRow(`SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`, table, column).Scan(&count)
+	return count > 0, err
+}
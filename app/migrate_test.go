@@ -0,0 +1,130 @@
+package app
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	_ "modernc.org/sqlite"
+)
+
+func openMigrationTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestRunMigrations_FreshDatabase(t *testing.T) {
+	db := openMigrationTestDB(t)
+
+	if err := RunMigrations(db); err != nil {
+		t.Fatalf("RunMigrations failed: %v", err)
+	}
+
+	version, err := SchemaVersion(db)
+	if err != nil {
+		t.Fatalf("SchemaVersion failed: %v", err)
+	}
+	if version != LatestSchemaVersion() {
+		t.Errorf("expected version %d, got %d", LatestSchemaVersion(), version)
+	}
+
+	// Running again is a no-op
+	if err := RunMigrations(db); err != nil {
+		t.Fatalf("second RunMigrations failed: %v", err)
+	}
+}
+
+func TestRunMigrations_UpgradesLegacyDatabase(t *testing.T) {
+	db := openMigrationTestDB(t)
+
+	// A database created by a release that executed the baseline schema
+	// directly, without recording a version
+	for _, stmt := range migrations[0].statements {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("failed to create legacy schema: %v", err)
+		}
+	}
+	if _, err := db.Exec(`INSERT INTO files(id, path, name, dir, is_dir, is_searchable) VALUES (1, '/data/report.pdf', 'report.pdf', '/data', 0, 2)`); err != nil {
+		t.Fatalf("failed to insert: %v", err)
+	}
+	if _, err := db.Exec(`INSERT INTO files_fts(rowid, name, path) VALUES (1, 'report.pdf', '/data/report.pdf')`); err != nil {
+		t.Fatalf("failed to insert fts: %v", err)
+	}
+	// Some columns may exist already from an unversioned schema
+	if _, err := db.Exec(`ALTER TABLE files ADD COLUMN device INTEGER`); err != nil {
+		t.Fatalf("failed to add column: %v", err)
+	}
+
+	if err := RunMigrations(db); err != nil {
+		t.Fatalf("RunMigrations failed: %v", err)
+	}
+
+	for _, col := range []string{"link_target", "device", "inode", "owner_name", "mode"} {
+		var count int
+		db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('files') WHERE name = ?`, col).Scan(&count)
+		if count != 1 {
+			t.Errorf("expected column %s after upgrade", col)
+		}
+	}
+
+	// Existing rows stay searchable after the FTS table is rebuilt
+	var id int64
+	if err := db.QueryRow(`SELECT rowid FROM files_fts WHERE files_fts MATCH 'report'`).Scan(&id); err != nil {
+		t.Errorf("expected existing file to remain searchable: %v", err)
+	}
+}
+
+func TestRunMigrations_DatabaseNewerThanBinary(t *testing.T) {
+	db := openMigrationTestDB(t)
+
+	if err := RunMigrations(db); err != nil {
+		t.Fatalf("RunMigrations failed: %v", err)
+	}
+	if _, err := db.Exec(`UPDATE metadata SET value = ? WHERE key = 'schema_version'`, LatestSchemaVersion()+1); err != nil {
+		t.Fatalf("failed to bump version: %v", err)
+	}
+
+	err := RunMigrations(db)
+	if !errors.Is(err, ErrSchemaTooNew) {
+		t.Errorf("expected ErrSchemaTooNew, got %v", err)
+	}
+}
+
+func TestLoadMigrations_Validation(t *testing.T) {
+	valid := fstest.MapFS{
+		"migrations/0001_base.sql": {Data: []byte("CREATE TABLE a (x);\n")},
+		"migrations/0002_more.sql": {Data: []byte("-- comment\nALTER TABLE a\n  ADD COLUMN y;\nCREATE INDEX i ON a(y);\n")},
+	}
+	m, err := loadMigrations(valid)
+	if err != nil {
+		t.Fatalf("loadMigrations failed: %v", err)
+	}
+	if len(m) != 2 || m[1].name != "more" {
+		t.Fatalf("unexpected migrations %+v", m)
+	}
+	if len(m[1].statements) != 2 || m[1].statements[0] != "ALTER TABLE a\n  ADD COLUMN y;" {
+		t.Errorf("unexpected statements %q", m[1].statements)
+	}
+
+	gap := fstest.MapFS{
+		"migrations/0001_base.sql": {Data: []byte("SELECT 1;")},
+		"migrations/0003_skip.sql": {Data: []byte("SELECT 1;")},
+	}
+	if _, err := loadMigrations(gap); err == nil {
+		t.Error("expected error for gap in migration sequence")
+	}
+
+	badName := fstest.MapFS{
+		"migrations/1_base.sql": {Data: []byte("SELECT 1;")},
+	}
+	if _, err := loadMigrations(badName); err == nil {
+		t.Error("expected error for invalid migration name")
+	}
+}
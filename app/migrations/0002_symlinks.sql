@@ -0,0 +1,7 @@
+ALTER TABLE files ADD COLUMN link_target TEXT;
+
+-- link_target becomes searchable, the FTS table is rebuilt with the new column
+DROP TABLE IF EXISTS files_fts;
+CREATE VIRTUAL TABLE files_fts USING fts5(name, path, link_target, tokenize = 'unicode61');
+INSERT INTO files_fts(rowid, name, path, link_target)
+SELECT id, name, path, COALESCE(link_target, '') FROM files WHERE is_searchable = 2;
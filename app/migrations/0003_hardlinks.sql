@@ -0,0 +1,9 @@
+ALTER TABLE files ADD COLUMN device INTEGER;
+ALTER TABLE files ADD COLUMN inode INTEGER;
+ALTER TABLE files ADD COLUMN nlink INTEGER;
+ALTER TABLE files ADD COLUMN disk_size INTEGER;
+
+ALTER TABLE dir_sizes ADD COLUMN unique_size INTEGER;
+ALTER TABLE dir_sizes ADD COLUMN disk_size INTEGER;
+
+CREATE INDEX IF NOT EXISTS idx_files_inode ON files(device, inode);
@@ -0,0 +1,7 @@
+ALTER TABLE files ADD COLUMN uid INTEGER;
+ALTER TABLE files ADD COLUMN gid INTEGER;
+ALTER TABLE files ADD COLUMN owner_name TEXT;
+ALTER TABLE files ADD COLUMN group_name TEXT;
+ALTER TABLE files ADD COLUMN mode INTEGER;
+
+CREATE INDEX IF NOT EXISTS idx_files_uid ON files(uid);
@@ -0,0 +1,29 @@
+-- Directories get integer ids; files point at their parent directory instead
+-- of carrying a crc32 hash of the parent path. Roots have no parent.
+CREATE TABLE dirs (
+  id INTEGER PRIMARY KEY,
+  parent_id INTEGER REFERENCES dirs(id),
+  path TEXT NOT NULL UNIQUE,
+  name TEXT NOT NULL
+);
+CREATE INDEX idx_dirs_parent ON dirs(parent_id);
+
+ALTER TABLE files ADD COLUMN parent_id INTEGER REFERENCES dirs(id);
+
+-- Backfill existing databases: the dir column holds the root of every entry,
+-- directories are inserted shortest path first
+INSERT OR IGNORE INTO dirs (path, name)
+SELECT DISTINCT dir, dir FROM files WHERE dir IS NOT NULL AND dir != '';
+INSERT OR IGNORE INTO dirs (path, name)
+SELECT path, name FROM files WHERE is_dir = 1 ORDER BY length(path);
+UPDATE dirs SET parent_id = (
+  SELECT p.id FROM dirs p WHERE p.path = rtrim(substr(dirs.path, 1, length(dirs.path) - length(dirs.name)), '/')
+) WHERE path NOT IN (SELECT DISTINCT dir FROM files WHERE dir IS NOT NULL);
+UPDATE files SET parent_id = (
+  SELECT d.id FROM dirs d WHERE d.path = rtrim(substr(files.path, 1, length(files.path) - length(files.name)), '/')
+);
+
+CREATE INDEX idx_files_parent ON files(parent_id, is_dir, name);
+
+DROP INDEX IF EXISTS idx_dir_index;
+ALTER TABLE files DROP COLUMN dir_index;
@@ -0,0 +1,62 @@
+-- Files are stored as (parent_id, name); the full path is rebuilt from dirs
+-- on read. The path and dir columns and both path indexes go away, and the
+-- FTS table becomes contentless so it keeps tokens instead of string copies.
+
+-- Every directory below a root records it, which replaces the per-file dir
+-- column. Roots keep a NULL root_id like their NULL parent_id.
+ALTER TABLE dirs ADD COLUMN root_id INTEGER REFERENCES dirs(id);
+CREATE TEMP TABLE dir_roots (id INTEGER PRIMARY KEY, root_id INTEGER);
+INSERT INTO dir_roots (id, root_id)
+WITH RECURSIVE tree(id, root_id) AS (
+  SELECT id, id FROM dirs WHERE parent_id IS NULL
+  UNION ALL
+  SELECT d.id, t.root_id FROM dirs d JOIN tree t ON d.parent_id = t.id
+)
+SELECT id, root_id FROM tree;
+UPDATE dirs SET root_id = (SELECT r.root_id FROM dir_roots r WHERE r.id = dirs.id) WHERE parent_id IS NOT NULL;
+DROP TABLE dir_roots;
+
+CREATE TABLE files_compact (
+  id INTEGER PRIMARY KEY,
+  parent_id INTEGER NOT NULL REFERENCES dirs(id),
+  name TEXT NOT NULL,
+  index_name TEXT,
+  ext TEXT,
+  size INTEGER,
+  mod_time INTEGER,
+  is_dir INTEGER,
+  is_searchable INTEGER DEFAULT 0,
+  link_target TEXT,
+  device INTEGER,
+  inode INTEGER,
+  nlink INTEGER,
+  disk_size INTEGER,
+  uid INTEGER,
+  gid INTEGER,
+  owner_name TEXT,
+  group_name TEXT,
+  mode INTEGER,
+  UNIQUE (parent_id, name)
+);
+
+-- Rows whose parent could not be resolved by 0005 cannot be addressed in the
+-- new layout and are dropped; the next scan adds them again
+INSERT INTO files_compact (id, parent_id, name, index_name, ext, size, mod_time, is_dir, is_searchable, link_target,
+                           device, inode, nlink, disk_size, uid, gid, owner_name, group_name, mode)
+SELECT id, parent_id, name, index_name, ext, size, mod_time, is_dir, is_searchable, link_target,
+       device, inode, nlink, disk_size, uid, gid, owner_name, group_name, mode
+FROM files
+WHERE parent_id IS NOT NULL AND name IS NOT NULL;
+
+DROP TABLE files;
+ALTER TABLE files_compact RENAME TO files;
+
+CREATE INDEX idx_files_inode ON files(device, inode);
+CREATE INDEX idx_files_uid ON files(uid);
+
+DROP TABLE IF EXISTS files_fts;
+CREATE VIRTUAL TABLE files_fts USING fts5(name, dir, link_target, content = '', contentless_delete = 1, tokenize = 'unicode61');
+INSERT INTO files_fts(rowid, name, dir, link_target)
+SELECT f.id, f.name, d.path, COALESCE(f.link_target, '')
+FROM files f JOIN dirs d ON d.id = f.parent_id
+WHERE f.is_searchable = 2;
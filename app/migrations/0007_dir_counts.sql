@@ -0,0 +1,3 @@
+-- Directory totals are computed during the scan and include the number of
+-- directories below each one
+ALTER TABLE dir_sizes ADD COLUMN dir_count INTEGER;
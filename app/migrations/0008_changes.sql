@@ -0,0 +1,15 @@
+-- Journal of the files each scan added, removed, modified or moved compared
+-- to the previous scan. Like files, entries store directory and name.
+CREATE TABLE changes (
+  id INTEGER PRIMARY KEY,
+  scan_id INTEGER NOT NULL REFERENCES scan_history(id),
+  kind TEXT NOT NULL,
+  dir TEXT NOT NULL,
+  name TEXT NOT NULL,
+  old_dir TEXT,
+  size INTEGER,
+  old_size INTEGER,
+  mod_time INTEGER,
+  old_mod_time INTEGER
+);
+CREATE INDEX idx_changes_scan ON changes(scan_id, kind);
@@ -0,0 +1,21 @@
+-- Lifecycle history, filled only for indexes with keep_history. Files record
+-- the time of the first scan that saw them; tombstones keep the last known
+-- state of files that disappeared.
+ALTER TABLE files ADD COLUMN first_seen INTEGER;
+
+CREATE TABLE tombstones (
+  id INTEGER PRIMARY KEY,
+  index_name TEXT,
+  root TEXT,
+  dir TEXT NOT NULL,
+  name TEXT NOT NULL,
+  ext TEXT,
+  size INTEGER,
+  mod_time INTEGER,
+  first_seen INTEGER,
+  last_seen INTEGER NOT NULL,
+  UNIQUE (dir, name)
+);
+CREATE INDEX idx_tombstones_last_seen ON tombstones(last_seen);
+
+CREATE VIRTUAL TABLE tombstones_fts USING fts5(name, dir, content = '', contentless_delete = 1, tokenize = 'unicode61');
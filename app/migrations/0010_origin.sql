@@ -0,0 +1,3 @@
+-- Provenance of entries loaded by findex import or merge: the name of the
+-- index that scanned them. NULL for files scanned into this index.
+ALTER TABLE files ADD COLUMN origin TEXT;
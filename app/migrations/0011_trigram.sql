@@ -0,0 +1,3 @@
+-- Every three characters of the file names, for substring and fuzzy
+-- search. Filled only for indexes with trigram_index.
+CREATE VIRTUAL TABLE files_trigram USING fts5(name, content = '', contentless_delete = 1, tokenize = 'trigram');
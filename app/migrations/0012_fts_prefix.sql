@@ -0,0 +1,9 @@
+-- Prefix indexes for the prefix match of the last typed word. The options
+-- of a contentless FTS table cannot be changed, it is created and filled
+-- again.
+DROP TABLE IF EXISTS files_fts;
+CREATE VIRTUAL TABLE files_fts USING fts5(name, dir, link_target, content = '', contentless_delete = 1, prefix = '2 3', tokenize = 'unicode61');
+INSERT INTO files_fts(rowid, name, dir, link_target)
+SELECT f.id, f.name, d.path, COALESCE(f.link_target, '')
+FROM files f JOIN dirs d ON d.id = f.parent_id
+WHERE f.is_searchable = 2;
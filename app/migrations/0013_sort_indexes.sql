@@ -0,0 +1,5 @@
+-- Indexes on the sort keys of search results, so a page deep into a sort
+-- by size, date or name seeks to its cursor instead of sorting every match
+CREATE INDEX idx_files_size ON files(size);
+CREATE INDEX idx_files_mod_time ON files(mod_time);
+CREATE INDEX idx_files_name ON files(name COLLATE NOCASE);
@@ -0,0 +1,101 @@
+package app
+
+import (
+	"database/sql/driver"
+	"regexp"
+	"strings"
+	"sync"
+
+	"modernc.org/sqlite"
+)
+
+// namePattern is a glob term or a re: qualifier, matched against the whole
+// file name instead of the full-text index
+type namePattern struct {
+	glob    string // * and ? wildcards, case-insensitive
+	re      string // Go regular expression, searched anywhere in the name
+	negated bool
+}
+
+func init() {
+	// X REGEXP Y calls regexp(Y, X)
+	sqlite.MustRegisterDeterministicScalarFunction("regexp", 2, sqlRegexp)
+}
+
+// isGlobPattern reports whether a term is a name pattern: it holds a ? or a
+// * other than a single trailing one, which is a word prefix
+func isGlobPattern(term string) bool {
+	return strings.ContainsRune(term, '?') || strings.Contains(strings.TrimSuffix(term, "*"), "*")
+}
+
+// nameConditions adds the name patterns to where, on files or tombstones
+// aliased f. Both scan every name the other conditions leave.
+func nameConditions(where *sqlWhere, patterns []namePattern) {
+	for _, p := range patterns {
+		cond, arg := "f.name REGEXP ?", p.re
+		if p.re == "" {
+			// lower() of SQLite only folds ASCII, so does the pattern
+			cond, arg = "lower(f.name) GLOB ?", asciiLower(p.glob)
+		}
+		if p.negated {
+			cond = "NOT " + cond
+		}
+		where.add(cond, arg)
+	}
+}
+
+func asciiLower(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'A' && r <= 'Z' {
+			return r + 'a' - 'A'
+		}
+		return r
+	}, s)
+}
+
+// maxCachedRegexps bounds the compiled patterns kept for REGEXP, the cache
+// starts over when it is full
+const maxCachedRegexps = 64
+
+var regexpCache = struct {
+	sync.Mutex
+	m map[string]*regexp.Regexp
+}{m: map[string]*regexp.Regexp{}}
+
+func cachedRegexp(pattern string) (*regexp.Regexp, error) {
+	regexpCache.Lock()
+	defer regexpCache.Unlock()
+	if re, ok := regexpCache.m[pattern]; ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if len(regexpCache.m) >= maxCachedRegexps {
+		regexpCache.m = map[string]*regexp.Regexp{}
+	}
+	regexpCache.m[pattern] = re
+	return re, nil
+}
+
+// sqlRegexp implements the REGEXP operator for SQLite, NULL operands give
+// NULL
+func sqlRegexp(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+	pattern, ok := args[0].(string)
+	if !ok {
+		return nil, nil
+	}
+	text, ok := args[1].(string)
+	if !ok {
+		return nil, nil
+	}
+	re, err := cachedRegexp(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if re.MatchString(text) {
+		return int64(1), nil
+	}
+	return int64(0), nil
+}
@@ -0,0 +1,71 @@
+package app
+
+import (
+	"os"
+	"os/user"
+	"strconv"
+	"sync"
+)
+
+// ownerNames resolves uids and gids to names during a scan. Lookups go
+// through os/user, which reads /etc/passwd and /etc/group (or NSS when built
+// with cgo); results are cached because every file of an owner repeats them.
+// Ids without an entry resolve to an empty name.
+type ownerNames struct {
+	mu     sync.Mutex
+	users  map[uint32]string
+	groups map[uint32]string
+}
+
+func newOwnerNames() *ownerNames {
+	return &ownerNames{
+		users:  make(map[uint32]string),
+		groups: make(map[uint32]string),
+	}
+}
+
+// user returns the login name of uid
+func (o *ownerNames) user(uid uint32) string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if name, ok := o.users[uid]; ok {
+		return name
+	}
+	var name string
+	if u, err := user.LookupId(strconv.FormatUint(uint64(uid), 10)); err == nil {
+		name = u.Username
+	}
+	o.users[uid] = name
+	return name
+}
+
+// group returns the name of gid
+func (o *ownerNames) group(gid uint32) string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if name, ok := o.groups[gid]; ok {
+		return name
+	}
+	var name string
+	if g, err := user.LookupGroupId(strconv.FormatUint(uint64(gid), 10)); err == nil {
+		name = g.Name
+	}
+	o.groups[gid] = name
+	return name
+}
+
+// unixMode converts Go file mode bits to the st_mode permission layout
+// (including setuid, setgid and sticky), e.g. 0755 or 04755.
+func unixMode(m os.FileMode) uint32 {
+	mode := uint32(m.Perm())
+	if m&os.ModeSetuid != 0 {
+		mode |= 0o4000
+	}
+	if m&os.ModeSetgid != 0 {
+		mode |= 0o2000
+	}
+	if m&os.ModeSticky != 0 {
+		mode |= 0o1000
+	}
+	return mode
+}
@@ -0,0 +1,240 @@
+package app
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ogefest/findex/models"
+)
+
+// Index databases in a data directory that no index points to are moved to
+// its quarantine directory instead of being deleted, so a typo in the config
+// cannot destroy an index. findex prune deletes them once they are older than
+// the retention.
+const (
+	quarantineDirName          = ".quarantine"
+	quarantineTimeFormat       = "2006-01-02_15-04-05"
+	defaultQuarantineRetention = 30 // days
+)
+
+// dbSidecars are the files SQLite keeps next to a database
+var dbSidecars = []string{"", "-wal", "-shm"}
+
+// DataDirs returns the absolute directories that hold index databases:
+// data_dir when set, otherwise the directory of every db_path
+func DataDirs(cfg *models.AppConfig) ([]string, error) {
+	seen := map[string]bool{}
+	var dirs []string
+	add := func(dir string) error {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return fmt.Errorf("failed to get absolute path for data dir %s: %w", dir, err)
+		}
+		if !seen[abs] {
+			seen[abs] = true
+			dirs = append(dirs, abs)
+		}
+		return nil
+	}
+
+	if cfg.DataDir != "" {
+		return dirs, add(cfg.DataDir)
+	}
+	for _, idx := range cfg.Indexes {
+		if err := add(filepath.Dir(idx.DBPath)); err != nil {
+			return nil, err
+		}
+	}
+	return dirs, nil
+}
+
+// isIndexDB reports whether path is a findex database, other SQLite files
+// sharing the directory are left alone
+func isIndexDB(path string) bool {
+	db, err := sql.Open("sqlite", "file:"+path+"?mode=ro")
+	if err != nil {
+		return false
+	}
+	defer db.Close()
+
+	var count int
+	err = db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name IN ('files', 'metadata')`).Scan(&count)
+	return err == nil && count == 2
+}
+
+// quarantineUnknownDBs moves the index databases of the data directories that
+// are not in defined, keyed by absolute path, to the quarantine directory
+func quarantineUnknownDBs(cfg *models.AppConfig, defined map[string]bool) error {
+	dirs, err := DataDirs(cfg)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, dir := range dirs {
+		files, err := filepath.Glob(filepath.Join(dir, "*.db"))
+		if err != nil {
+			return fmt.Errorf("failed to glob data dir: %w", err)
+		}
+
+		for _, f := range files {
+			if defined[f] || !isIndexDB(f) {
+				continue
+			}
+			target, err := quarantineDB(f, now)
+			if err != nil {
+				return fmt.Errorf("failed to quarantine unused index %s: %w", f, err)
+			}
+			log.Printf("Moved unused index %s to %s, delete it with findex prune\n", f, target)
+		}
+	}
+
+	expired, err := ListQuarantine(cfg)
+	if err != nil {
+		return err
+	}
+	count := 0
+	for _, q := range expired {
+		if q.Expired {
+			count++
+		}
+	}
+	if count > 0 {
+		log.Printf("%d quarantined databases are past their retention, delete them with findex prune\n", count)
+	}
+	return nil
+}
+
+// quarantineDB moves a database and its sidecar files to the quarantine
+// directory next to it, prefixed with the time of the move
+func quarantineDB(path string, now time.Time) (string, error) {
+	dir := filepath.Join(filepath.Dir(path), quarantineDirName)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	target := filepath.Join(dir, now.Format(quarantineTimeFormat)+"_"+filepath.Base(path))
+	if _, err := os.Stat(target); err == nil {
+		return "", fmt.Errorf("%s already exists", target)
+	}
+	for _, suffix := range dbSidecars {
+		if err := os.Rename(path+suffix, target+suffix); err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+	return target, nil
+}
+
+// QuarantinedDB is a database waiting in a quarantine directory
+type QuarantinedDB struct {
+	Path          string // path inside the quarantine directory
+	OriginalPath  string // where the database was found
+	QuarantinedAt time.Time
+	Size          int64
+	Expired       bool // older than the retention, findex prune deletes it
+}
+
+// ListQuarantine returns the quarantined databases of every data directory,
+// oldest first
+func ListQuarantine(cfg *models.AppConfig) ([]QuarantinedDB, error) {
+	dirs, err := DataDirs(cfg)
+	if err != nil {
+		return nil, err
+	}
+	retention := cfg.QuarantineRetention
+	if retention == 0 {
+		retention = defaultQuarantineRetention
+	}
+	cutoff := time.Now().AddDate(0, 0, -retention)
+
+	var result []QuarantinedDB
+	for _, dir := range dirs {
+		files, err := filepath.Glob(filepath.Join(dir, quarantineDirName, "*.db"))
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			name := filepath.Base(f)
+			if len(name) <= len(quarantineTimeFormat)+1 {
+				continue
+			}
+			at, err := time.ParseInLocation(quarantineTimeFormat, name[:len(quarantineTimeFormat)], time.Local)
+			if err != nil {
+				continue
+			}
+			q := QuarantinedDB{
+				Path:          f,
+				OriginalPath:  filepath.Join(dir, name[len(quarantineTimeFormat)+1:]),
+				QuarantinedAt: at,
+				Expired:       at.Before(cutoff),
+			}
+			if info, err := os.Stat(f); err == nil {
+				q.Size = info.Size()
+			}
+			result = append(result, q)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].QuarantinedAt.Before(result[j].QuarantinedAt)
+	})
+	return result, nil
+}
+
+// Prune lists the quarantined databases to w and deletes the expired ones,
+// or all of them with all, once confirmed on r. yes skips the confirmation.
+func Prune(w io.Writer, r io.Reader, configPath string, all, yes bool) error {
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		return err
+	}
+	entries, err := ListQuarantine(cfg)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		fmt.Fprintln(w, "No quarantined databases")
+		return nil
+	}
+
+	var doomed []QuarantinedDB
+	for _, q := range entries {
+		state := "kept"
+		if q.Expired || all {
+			state = "delete"
+			doomed = append(doomed, q)
+		}
+		fmt.Fprintf(w, "%-6s %s  %d bytes  from %s\n", state, q.QuarantinedAt.Format("2006-01-02 15:04"), q.Size, q.OriginalPath)
+	}
+	if len(doomed) == 0 {
+		fmt.Fprintln(w, "Nothing is past the retention, use -all to delete everything")
+		return nil
+	}
+
+	if !yes {
+		fmt.Fprintf(w, "Delete %d databases? [y/N] ", len(doomed))
+		answer, _ := bufio.NewReader(r).ReadString('\n')
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		if answer != "y" && answer != "yes" {
+			fmt.Fprintln(w, "Nothing deleted")
+			return nil
+		}
+	}
+
+	for _, q := range doomed {
+		for _, suffix := range dbSidecars {
+			if err := os.Remove(q.Path + suffix); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	fmt.Fprintf(w, "Deleted %d databases\n", len(doomed))
+	return nil
+}
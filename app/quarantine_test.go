@@ -0,0 +1,86 @@
+package app
+
+import (
+	"bytes"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ogefest/findex/models"
+)
+
+func TestInitIndexes_QuarantinesUnknownDatabases(t *testing.T) {
+	fx := setupScanFixture(t, nil)
+	dataDir, configPath, cfg := filepath.Dir(fx.dbPath), fx.configPath, fx.cfg
+
+	// An index that is no longer configured and a database of another program
+	if err := ensureIndex(models.IndexConfig{DBPath: filepath.Join(dataDir, "old.db")}); err != nil {
+		t.Fatalf("failed to create index: %v", err)
+	}
+	other, err := sql.Open("sqlite", filepath.Join(dataDir, "other.db"))
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	if _, err := other.Exec(`CREATE TABLE notes (text TEXT)`); err != nil {
+		t.Fatalf("failed to create table: %v", err)
+	}
+	other.Close()
+
+	if err := InitIndexes(cfg); err != nil {
+		t.Fatalf("InitIndexes failed: %v", err)
+	}
+
+	for name, exists := range map[string]bool{"test.db": true, "other.db": true, "old.db": false} {
+		if _, err := os.Stat(filepath.Join(dataDir, name)); (err == nil) != exists {
+			t.Errorf("%s: expected exists=%v, got %v", name, exists, err)
+		}
+	}
+
+	entries, err := ListQuarantine(cfg)
+	if err != nil {
+		t.Fatalf("ListQuarantine failed: %v", err)
+	}
+	if len(entries) != 1 || entries[0].OriginalPath != filepath.Join(dataDir, "old.db") || entries[0].Expired {
+		t.Fatalf("expected old.db in quarantine, got %+v", entries)
+	}
+
+	prune := func(answer string, all bool) string {
+		t.Helper()
+		var out bytes.Buffer
+		if err := Prune(&out, strings.NewReader(answer), configPath, all, false); err != nil {
+			t.Fatalf("Prune failed: %v", err)
+		}
+		return out.String()
+	}
+
+	t.Run("recent databases are kept", func(t *testing.T) {
+		if out := prune("y\n", false); !strings.Contains(out, "Nothing is past the retention") {
+			t.Errorf("unexpected output:\n%s", out)
+		}
+	})
+
+	t.Run("expired databases need confirmation", func(t *testing.T) {
+		expired := filepath.Join(filepath.Dir(entries[0].Path),
+			time.Now().AddDate(0, 0, -31).Format(quarantineTimeFormat)+"_old.db")
+		if err := os.Rename(entries[0].Path, expired); err != nil {
+			t.Fatalf("failed to rename: %v", err)
+		}
+
+		if out := prune("n\n", false); !strings.Contains(out, "Nothing deleted") {
+			t.Errorf("unexpected output:\n%s", out)
+		}
+		if _, err := os.Stat(expired); err != nil {
+			t.Fatalf("database should still exist: %v", err)
+		}
+
+		if out := prune("y\n", false); !strings.Contains(out, "Deleted 1 databases") {
+			t.Errorf("unexpected output:\n%s", out)
+		}
+		if _, err := os.Stat(expired); !os.IsNotExist(err) {
+			t.Errorf("database should be deleted, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,707 @@
+package app
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Query is a search box query compiled by ParseQuery. Terms become an FTS5
+// expression in which every word is quoted, so user input can never be read
+// as FTS5 syntax; field qualifiers become a FileFilter. Name patterns, globs
+// and re:, are matched against names outside of the full-text index.
+//
+//	report "annual review" (pdf OR docx) -draft invo
+//	ext:pdf,docx size:>100MB modified:2024 path:reports/ in:/mnt/media type:dir
+//	match:substring IMG_????.jpg -*.tmp re:"^\d{4}-\d{2}"
+type Query struct {
+	Match   string     // FTS5 expression results must match, empty to match all
+	Exclude string     // FTS5 expression results must not match
+	Path    string     // FTS5 expression of the path: qualifiers outside of word matching
+	Filter  FileFilter // from field qualifiers
+
+	names      []namePattern
+	nodes      []queryNode // top level terms, to compile the match modes
+	shortTerm  int         // offset of the first term shorter than a trigram, -1 if none
+	fuzzyTerms [][]rune    // lower case terms of fuzzy matching
+	marks      []markTerm  // terms to mark in the results
+}
+
+// QueryError is a query that cannot be parsed, Pos is the byte offset of the
+// offending part
+type QueryError struct {
+	Pos int
+	Msg string
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("%s (at character %d)", e.Msg, e.Pos+1)
+}
+
+// queryFields are the field qualifiers, field:value
+var queryFields = map[string]func(q *Query, value string) error{
+	"ext":      parseExtField,
+	"size":     parseSizeField,
+	"modified": parseModifiedField,
+	"path":     parsePathField,
+	"in":       parseInField,
+	"type":     parseTypeField,
+	"owner":    func(q *Query, value string) error { q.Filter.Owner = value; return nil },
+	"group":    func(q *Query, value string) error { q.Filter.Group = value; return nil },
+	"match":    parseMatchField,
+	"re":       parseRegexField,
+}
+
+type queryTokenKind int
+
+const (
+	tokenWord queryTokenKind = iota
+	tokenPhrase
+	tokenField
+	tokenOpen
+	tokenClose
+	tokenOr
+)
+
+type queryToken struct {
+	kind    queryTokenKind
+	pos     int
+	text    string // word, phrase or field value
+	field   string
+	negated bool
+	last    bool // a word that ends the input, the term still being typed
+}
+
+// tokenizeQuery splits a query into words, "phrases", field:value pairs,
+// parentheses and OR. A leading - negates the following word, phrase or
+// group.
+func tokenizeQuery(input string) ([]queryToken, error) {
+	var tokens []queryToken
+	i := 0
+	for i < len(input) {
+		c := input[i]
+		if c == ' ' || c == '\t' || c == '\n' || c == '\r' {
+			i++
+			continue
+		}
+
+		start := i
+		negated := false
+		if c == '-' && i+1 < len(input) && !unicode.IsSpace(rune(input[i+1])) {
+			negated = true
+			i++
+			c = input[i]
+		}
+
+		switch c {
+		case '(':
+			tokens = append(tokens, queryToken{kind: tokenOpen, pos: start, negated: negated})
+			i++
+			continue
+		case ')':
+			if negated {
+				return nil, &QueryError{start, "- must be followed by a term"}
+			}
+			tokens = append(tokens, queryToken{kind: tokenClose, pos: start})
+			i++
+			continue
+		case '"':
+			text, end, err := readQuoted(input, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, queryToken{kind: tokenPhrase, pos: start, text: text, negated: negated})
+			i = end
+			continue
+		}
+
+		end := i
+		for end < len(input) && !strings.ContainsRune(" \t\n\r()\"", rune(input[end])) {
+			end++
+		}
+		// A regular expression may hold parentheses and quotes, it ends at
+		// white space
+		if strings.HasPrefix(input[i:], "re:") && !strings.HasPrefix(input[i:], `re:"`) {
+			for end < len(input) && !strings.ContainsRune(" \t\n\r", rune(input[end])) {
+				end++
+			}
+		}
+		word := input[i:end]
+		i = end
+
+		if field, value, ok := strings.Cut(word, ":"); ok && isFieldName(field) {
+			if _, known := queryFields[field]; !known {
+				return nil, &QueryError{start, fmt.Sprintf("unknown field %q, use ext, size, modified, path, in, type, owner, group, match or re", field)}
+			}
+			if negated {
+				return nil, &QueryError{start, fmt.Sprintf("%s: cannot be negated", field)}
+			}
+			// field:"quoted value"
+			if value == "" && i < len(input) && input[i] == '"' {
+				text, end, err := readQuoted(input, i)
+				if err != nil {
+					return nil, err
+				}
+				value, i = text, end
+			}
+			if value == "" {
+				return nil, &QueryError{start, fmt.Sprintf("%s: needs a value", field)}
+			}
+			tokens = append(tokens, queryToken{kind: tokenField, pos: start, field: field, text: value})
+			continue
+		}
+
+		switch {
+		case word == "OR" && !negated:
+			tokens = append(tokens, queryToken{kind: tokenOr, pos: start})
+		case word == "AND" && !negated:
+			// Terms are combined with AND anyway
+		default:
+			tokens = append(tokens, queryToken{kind: tokenWord, pos: start, text: word, negated: negated, last: end == len(input)})
+		}
+	}
+	return tokens, nil
+}
+
+// readQuoted reads a "quoted string" starting at input[start], returning its
+// contents and the offset after the closing quote
+func readQuoted(input string, start int) (string, int, error) {
+	end := strings.IndexByte(input[start+1:], '"')
+	if end < 0 {
+		return "", 0, &QueryError{start, "missing closing quote"}
+	}
+	return input[start+1 : start+1+end], start + end + 2, nil
+}
+
+func isFieldName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < 'a' || r > 'z' {
+			return false
+		}
+	}
+	return true
+}
+
+// queryNode is a parsed term or group, fts is its FTS5 expression
+type queryNode struct {
+	fts     string
+	negated bool
+	pos     int
+	term    string // text of a single word or phrase, empty for groups
+	path    bool   // from a path: qualifier
+	glob    string // a name pattern instead of a full-text term
+}
+
+type queryParser struct {
+	tokens  []queryToken
+	next    int
+	query   *Query
+	negated int // depth of the negated groups around the next token
+}
+
+// ParseQuery compiles a search box query. Terms next to each other must all
+// match, OR offers alternatives and binds tighter than the implied AND,
+// -term excludes, "quoted words" match as a phrase and word* matches a
+// prefix. Field qualifiers narrow the result and may only appear outside of
+// parentheses.
+func ParseQuery(input string) (*Query, error) {
+	tokens, err := tokenizeQuery(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &queryParser{tokens: tokens, query: &Query{shortTerm: -1}}
+	nodes, err := p.parseSequence(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.next < len(p.tokens) {
+		return nil, &QueryError{p.tokens[p.next].pos, "unmatched )"}
+	}
+
+	p.query.nodes = nodes
+	p.query.Match, p.query.Exclude = combineNodes(nodes)
+	return p.query, nil
+}
+
+// combineNodes returns the FTS5 expressions of the top level terms. FTS5
+// cannot match only a NOT, so without a term to include exclude is set for
+// the caller to drop these rows instead.
+func combineNodes(nodes []queryNode) (match, exclude string) {
+	var include, excluded []string
+	for _, n := range nodes {
+		if n.negated {
+			excluded = append(excluded, n.fts)
+		} else {
+			include = append(include, n.fts)
+		}
+	}
+	switch {
+	case len(include) > 0:
+		return joinMatch(include, excluded), ""
+	case len(excluded) > 0:
+		return "", strings.Join(excluded, " OR ")
+	}
+	return "", ""
+}
+
+// joinMatch combines the terms of one level, (a AND b) NOT c NOT d
+func joinMatch(include, exclude []string) string {
+	match := strings.Join(include, " AND ")
+	if len(include) > 1 && len(exclude) > 0 {
+		match = "(" + match + ")"
+	}
+	for _, e := range exclude {
+		match += " NOT " + e
+	}
+	return match
+}
+
+// parseSequence reads terms combined with AND up to a closing parenthesis or
+// the end. depth is 0 outside of parentheses.
+func (p *queryParser) parseSequence(depth int) ([]queryNode, error) {
+	var nodes []queryNode
+	for p.next < len(p.tokens) {
+		tok := p.tokens[p.next]
+		switch tok.kind {
+		case tokenClose:
+			return nodes, nil
+		case tokenOr:
+			return nil, &QueryError{tok.pos, "OR needs a term on both sides"}
+		case tokenField:
+			if depth > 0 {
+				return nil, &QueryError{tok.pos, fmt.Sprintf("%s: cannot be used inside parentheses", tok.field)}
+			}
+			p.next++
+			if p.peekOr() {
+				return nil, &QueryError{tok.pos, fmt.Sprintf("%s: cannot be combined with OR", tok.field)}
+			}
+			if err := queryFields[tok.field](p.query, tok.text); err != nil {
+				return nil, &QueryError{tok.pos, fmt.Sprintf("%s: %v", tok.field, err)}
+			}
+			if tok.field == "path" {
+				nodes = append(nodes, queryNode{fts: pathMatch(tok.text), pos: tok.pos, path: true})
+				p.query.marks = append(p.query.marks, markTerm{text: tok.text, path: true})
+			}
+		default:
+			node, ok, err := p.parseOr(depth)
+			if err != nil {
+				return nil, err
+			}
+			if node.glob != "" {
+				p.query.names = append(p.query.names, namePattern{glob: node.glob, negated: node.negated})
+			} else if ok {
+				nodes = append(nodes, node)
+			}
+		}
+	}
+	return nodes, nil
+}
+
+func (p *queryParser) peekOr() bool {
+	return p.next < len(p.tokens) && p.tokens[p.next].kind == tokenOr
+}
+
+// parseOr reads term (OR term)*. ok is false for terms without letters or
+// digits, which match nothing the index knows.
+func (p *queryParser) parseOr(depth int) (queryNode, bool, error) {
+	first, ok, err := p.parseTerm(depth)
+	if err != nil || !p.peekOr() {
+		return first, ok, err
+	}
+	if first.glob != "" {
+		return first, false, &QueryError{first.pos, "name patterns cannot be combined with OR"}
+	}
+
+	alternatives := []string{}
+	if ok {
+		alternatives = append(alternatives, first.fts)
+	}
+	terms := []queryNode{first}
+	for p.peekOr() {
+		orPos := p.tokens[p.next].pos
+		p.next++
+		if p.next >= len(p.tokens) || p.tokens[p.next].kind == tokenClose || p.tokens[p.next].kind == tokenOr {
+			return first, false, &QueryError{orPos, "OR needs a term on both sides"}
+		}
+		if p.tokens[p.next].kind == tokenField {
+			return first, false, &QueryError{p.tokens[p.next].pos, fmt.Sprintf("%s: cannot be combined with OR", p.tokens[p.next].field)}
+		}
+		node, ok, err := p.parseTerm(depth)
+		if err != nil {
+			return first, false, err
+		}
+		if node.glob != "" {
+			return first, false, &QueryError{node.pos, "name patterns cannot be combined with OR"}
+		}
+		terms = append(terms, node)
+		if ok {
+			alternatives = append(alternatives, node.fts)
+		}
+	}
+	for _, t := range terms {
+		if t.negated {
+			return first, false, &QueryError{t.pos, "OR cannot combine exclusions"}
+		}
+	}
+	if len(alternatives) == 0 {
+		return first, false, nil
+	}
+	if len(alternatives) == 1 {
+		return queryNode{fts: alternatives[0], pos: first.pos}, true, nil
+	}
+	return queryNode{fts: "(" + strings.Join(alternatives, " OR ") + ")", pos: first.pos}, true, nil
+}
+
+// parseTerm reads a word, a phrase or a parenthesized group
+func (p *queryParser) parseTerm(depth int) (queryNode, bool, error) {
+	tok := p.tokens[p.next]
+	p.next++
+	node := queryNode{negated: tok.negated, pos: tok.pos}
+
+	switch tok.kind {
+	case tokenWord:
+		if isGlobPattern(tok.text) {
+			if !hasWordChars(tok.text) {
+				return node, false, nil
+			}
+			if depth > 0 {
+				return node, false, &QueryError{tok.pos, "name patterns cannot be used inside parentheses"}
+			}
+			node.glob = tok.text
+			return node, true, nil
+		}
+		word, prefix := strings.CutSuffix(tok.text, "*")
+		if !hasWordChars(word) {
+			return node, false, nil
+		}
+		node.fts = quoteFTS(word)
+		// The last word is matched as a prefix while it is being typed,
+		// white space after it or quotes match the whole word
+		if prefix || (tok.last && !tok.negated) {
+			node.fts += " *"
+		}
+		node.term = word
+		p.checkLength(word, tok.pos)
+		p.mark(tok, word, strings.HasSuffix(node.fts, "*"))
+		return node, true, nil
+
+	case tokenPhrase:
+		if !hasWordChars(tok.text) {
+			return node, false, nil
+		}
+		node.fts = quoteFTS(tok.text)
+		node.term = tok.text
+		p.checkLength(tok.text, tok.pos)
+		p.mark(tok, tok.text, false)
+		return node, true, nil
+
+	case tokenOpen:
+		if tok.negated {
+			p.negated++
+		}
+		nodes, err := p.parseSequence(depth + 1)
+		if tok.negated {
+			p.negated--
+		}
+		if err != nil {
+			return node, false, err
+		}
+		if p.next >= len(p.tokens) {
+			return node, false, &QueryError{tok.pos, "missing closing )"}
+		}
+		p.next++
+
+		var include, exclude []string
+		for _, n := range nodes {
+			if n.negated {
+				exclude = append(exclude, n.fts)
+			} else {
+				include = append(include, n.fts)
+			}
+		}
+		if len(include) == 0 {
+			if len(exclude) > 0 {
+				return node, false, &QueryError{tok.pos, "a group needs a term besides exclusions"}
+			}
+			return node, false, nil
+		}
+		node.fts = joinMatch(include, exclude)
+		if len(include)+len(exclude) > 1 {
+			node.fts = "(" + node.fts + ")"
+		}
+		return node, true, nil
+	}
+	return node, false, &QueryError{tok.pos, "unexpected " + tokenName(tok)}
+}
+
+// mark notes a word or phrase to mark in the results, unless it excludes
+func (p *queryParser) mark(tok queryToken, text string, prefix bool) {
+	if !tok.negated && p.negated == 0 {
+		p.query.marks = append(p.query.marks, markTerm{text: text, prefix: prefix})
+	}
+}
+
+// checkLength notes the first term too short for the trigram index
+func (p *queryParser) checkLength(term string, pos int) {
+	if p.query.shortTerm < 0 && utf8.RuneCountInString(term) < 3 {
+		p.query.shortTerm = pos
+	}
+}
+
+func tokenName(tok queryToken) string {
+	switch tok.kind {
+	case tokenClose:
+		return ")"
+	case tokenOr:
+		return "OR"
+	}
+	return tok.text
+}
+
+// hasWordChars reports whether s holds anything the FTS tokenizer indexes
+func hasWordChars(s string) bool {
+	for _, r := range s {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// quoteFTS makes s an FTS5 string, which matches its words as a phrase. The
+// FTS5 query parser ends a string at a NUL byte, the tokenizer would split
+// words there anyway.
+func quoteFTS(s string) string {
+	s = strings.ReplaceAll(s, "\x00", " ")
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
+
+// pathMatch matches value as a phrase in the directory path column
+func pathMatch(value string) string {
+	return "dir : " + quoteFTS(value)
+}
+
+func parseExtField(q *Query, value string) error {
+	q.Filter.Exts = nil
+	for _, ext := range strings.Split(value, ",") {
+		ext = strings.TrimPrefix(strings.TrimSpace(ext), ".")
+		if ext != "" {
+			q.Filter.Exts = append(q.Filter.Exts, ext)
+		}
+	}
+	if len(q.Filter.Exts) == 0 {
+		return fmt.Errorf("needs an extension")
+	}
+	return nil
+}
+
+// parseSizeField reads >N, >=N, <N, <=N, N..M (either end may be left
+// out) or N for an exact size
+func parseSizeField(q *Query, value string) error {
+	low, high, err := parseRange(value, func(s string) (int64, int64, error) {
+		n, err := ParseSize(s)
+		return n, n, err
+	})
+	if err != nil {
+		return err
+	}
+	if low.set {
+		q.Filter.MinSize = low.value
+	}
+	if high.set {
+		if high.value < 0 {
+			return fmt.Errorf("the upper limit cannot be negative")
+		}
+		q.Filter.MaxSize = high.value
+		q.Filter.HasMaxSize = true
+	}
+	return nil
+}
+
+// parseModifiedField reads a date as YYYY, YYYY-MM or YYYY-MM-DD, in UTC
+// like the date filters of the search form, with the operators of size.
+// A date covers its whole year, month or day.
+func parseModifiedField(q *Query, value string) error {
+	low, high, err := parseRange(value, parseDatePeriod)
+	if err != nil {
+		return err
+	}
+	if low.set {
+		q.Filter.ModTimeFrom = low.value
+	}
+	if high.set {
+		q.Filter.ModTimeTo = high.value
+	}
+	return nil
+}
+
+// parseDatePeriod returns the first and last second of a year, month or day
+func parseDatePeriod(s string) (int64, int64, error) {
+	for _, layout := range []struct {
+		format string
+		next   func(time.Time) time.Time
+	}{
+		{"2006", func(t time.Time) time.Time { return t.AddDate(1, 0, 0) }},
+		{"2006-01", func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }},
+		{"2006-01-02", func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }},
+	} {
+		if len(s) != len(layout.format) {
+			continue
+		}
+		if t, err := time.Parse(layout.format, s); err == nil {
+			return t.Unix(), layout.next(t).Unix() - 1, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("invalid date %q, use YYYY, YYYY-MM or YYYY-MM-DD", s)
+}
+
+type rangeBound struct {
+	value int64
+	set   bool
+}
+
+// parseRange reads the comparison operators shared by size and modified.
+// bounds returns the lowest and highest value a single operand stands for.
+func parseRange(value string, bounds func(string) (int64, int64, error)) (low, high rangeBound, err error) {
+	operand := func(s string) (int64, int64, error) {
+		if s == "" {
+			return 0, 0, fmt.Errorf("needs a value after the operator")
+		}
+		return bounds(s)
+	}
+
+	switch {
+	case strings.HasPrefix(value, ">="):
+		lo, _, err := operand(value[2:])
+		return rangeBound{lo, true}, high, err
+	case strings.HasPrefix(value, "<="):
+		_, hi, err := operand(value[2:])
+		return low, rangeBound{hi, true}, err
+	case strings.HasPrefix(value, ">"):
+		_, hi, err := operand(value[1:])
+		return rangeBound{hi + 1, true}, high, err
+	case strings.HasPrefix(value, "<"):
+		lo, _, err := operand(value[1:])
+		return low, rangeBound{lo - 1, true}, err
+	}
+
+	if from, to, ok := strings.Cut(value, ".."); ok {
+		if from == "" && to == "" {
+			return low, high, fmt.Errorf("needs at least one end of the range")
+		}
+		if from != "" {
+			lo, _, err := bounds(from)
+			if err != nil {
+				return low, high, err
+			}
+			low = rangeBound{lo, true}
+		}
+		if to != "" {
+			_, hi, err := bounds(to)
+			if err != nil {
+				return low, high, err
+			}
+			high = rangeBound{hi, true}
+		}
+		return low, high, nil
+	}
+
+	lo, hi, err := bounds(value)
+	return rangeBound{lo, true}, rangeBound{hi, true}, err
+}
+
+// parsePathField only checks the value, the path is matched with an FTS5
+// column filter
+func parsePathField(q *Query, value string) error {
+	if !hasWordChars(value) {
+		return fmt.Errorf("needs a directory name")
+	}
+	return nil
+}
+
+func parseInField(q *Query, value string) error {
+	q.Filter.InDir = filepath.Clean(value)
+	return nil
+}
+
+func parseTypeField(q *Query, value string) error {
+	q.Filter.OnlyFiles, q.Filter.OnlyDirs, q.Filter.OnlyLinks = false, false, false
+	switch value {
+	case "file", "files":
+		q.Filter.OnlyFiles = true
+	case "dir", "dirs", "directory", "folder":
+		q.Filter.OnlyDirs = true
+	case "link", "links", "symlink":
+		q.Filter.OnlyLinks = true
+	default:
+		return fmt.Errorf("unknown type %q, use file, dir or link", value)
+	}
+	return nil
+}
+
+func parseRegexField(q *Query, value string) error {
+	if _, err := regexp.Compile(value); err != nil {
+		return err
+	}
+	q.names = append(q.names, namePattern{re: value})
+	return nil
+}
+
+func parseMatchField(q *Query, value string) error {
+	switch value {
+	case MatchWords, MatchSubstring, MatchFuzzy:
+		q.Filter.MatchMode = value
+	default:
+		return fmt.Errorf("unknown mode %q, use words, substring or fuzzy", value)
+	}
+	return nil
+}
+
+// compileSearch parses query and applies its qualifiers over filter, the
+// fields of the search form. A qualifier replaces the form field it
+// corresponds to.
+func compileSearch(query string, filter *FileFilter) (*Query, error) {
+	q, err := ParseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	if filter == nil {
+		return q, q.compileMatchMode()
+	}
+
+	merged := *filter
+	f := q.Filter
+	if f.MinSize > 0 || f.HasMaxSize {
+		merged.MinSize, merged.MaxSize, merged.HasMaxSize = f.MinSize, f.MaxSize, f.HasMaxSize
+	}
+	if len(f.Exts) > 0 {
+		merged.Exts = f.Exts
+	}
+	if f.ModTimeFrom != 0 || f.ModTimeTo != 0 {
+		merged.ModTimeFrom, merged.ModTimeTo = f.ModTimeFrom, f.ModTimeTo
+	}
+	if f.OnlyFiles || f.OnlyDirs || f.OnlyLinks {
+		merged.OnlyFiles, merged.OnlyDirs, merged.OnlyLinks = f.OnlyFiles, f.OnlyDirs, f.OnlyLinks
+	}
+	if f.Owner != "" {
+		merged.Owner = f.Owner
+	}
+	if f.Group != "" {
+		merged.Group = f.Group
+	}
+	if f.InDir != "" {
+		merged.InDir = f.InDir
+	}
+	if f.MatchMode != "" {
+		merged.MatchMode = f.MatchMode
+	}
+	q.Filter = merged
+	return q, q.compileMatchMode()
+}
@@ -0,0 +1,197 @@
+package app
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestParseQuery(t *testing.T) {
+	year2024 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).Unix()
+	year2025 := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC).Unix()
+
+	tests := []struct {
+		input   string
+		match   string
+		exclude string
+		filter  FileFilter
+	}{
+		{input: "hello world", match: `"hello" AND "world" *`},
+		{input: "hello world ", match: `"hello" AND "world"`},
+		{input: "hello -world", match: `"hello" NOT "world"`},
+		{input: "foo bar -baz", match: `("foo" AND "bar") NOT "baz"`},
+		{input: "-excluded", exclude: `"excluded"`},
+		{input: "single", match: `"single" *`},
+		{input: "  spaced   terms  ", match: `"spaced" AND "terms"`},
+		{input: "report.pdf", match: `"report.pdf" *`},
+		{input: `"exact phrase" other`, match: `"exact phrase" AND "other" *`},
+		{input: `other "exact phrase"`, match: `"other" AND "exact phrase"`},
+		{input: "(a OR b) c", match: `("a" OR "b") AND "c" *`},
+		{input: "a OR b OR c", match: `("a" OR "b" OR "c" *)`},
+		{input: "a AND b", match: `"a" AND "b" *`},
+		{input: "rep*", match: `"rep" *`},
+		{input: "-(a b) c", match: `"c" * NOT ("a" AND "b")`},
+		{input: "NEAR(a b) x^y", match: `"NEAR" AND ("a" AND "b") AND "x^y" *`},
+		{input: "... ---", match: ""},
+		{input: "ext:pdf,.docx", filter: FileFilter{Exts: []string{"pdf", "docx"}}},
+		{input: "size:>100MB", filter: FileFilter{MinSize: 100*1024*1024 + 1}},
+		{input: "size:<=1KB", filter: FileFilter{MaxSize: 1024, HasMaxSize: true}},
+		{input: "size:1KB..2KB", filter: FileFilter{MinSize: 1024, MaxSize: 2048, HasMaxSize: true}},
+		{input: "size:10", filter: FileFilter{MinSize: 10, MaxSize: 10, HasMaxSize: true}},
+		{input: "size:0", filter: FileFilter{HasMaxSize: true}},
+		{input: "size:<1", filter: FileFilter{HasMaxSize: true}},
+		{input: "size:0..0", filter: FileFilter{HasMaxSize: true}},
+		{input: "modified:2024", filter: FileFilter{ModTimeFrom: year2024, ModTimeTo: year2025 - 1}},
+		{input: "modified:>2024", filter: FileFilter{ModTimeFrom: year2025}},
+		{input: "modified:2024-03..", filter: FileFilter{ModTimeFrom: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC).Unix()}},
+		{input: "path:reports/ q4", match: `dir : "reports/" AND "q4" *`},
+		{input: `in:/mnt/media/ type:dir`, filter: FileFilter{InDir: "/mnt/media", OnlyDirs: true}},
+		{input: `in:"/mnt/my media"`, filter: FileFilter{InDir: "/mnt/my media"}},
+		{input: "owner:alice group:1000 x", match: `"x" *`, filter: FileFilter{Owner: "alice", Group: "1000"}},
+		{input: "10:30", match: `"10:30" *`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			q, err := ParseQuery(tt.input)
+			if err != nil {
+				t.Fatalf("ParseQuery(%q) failed: %v", tt.input, err)
+			}
+			if q.Match != tt.match || q.Exclude != tt.exclude {
+				t.Errorf("ParseQuery(%q) = match %q exclude %q, expected %q and %q", tt.input, q.Match, q.Exclude, tt.match, tt.exclude)
+			}
+			if !reflect.DeepEqual(q.Filter, tt.filter) {
+				t.Errorf("ParseQuery(%q) filter = %+v, expected %+v", tt.input, q.Filter, tt.filter)
+			}
+		})
+	}
+}
+
+func TestParseQuery_Errors(t *testing.T) {
+	tests := []struct {
+		input string
+		pos   int
+	}{
+		{`"unclosed`, 0},
+		{"(a b", 0},
+		{"a b)", 3},
+		{"a OR", 2},
+		{"OR a", 0},
+		{"a OR -b", 5},
+		{"(-a)", 0},
+		{"color:red", 0},
+		{"x -ext:pdf", 2},
+		{"(ext:pdf)", 1},
+		{"ext:pdf OR x", 0},
+		{"size:>lots", 0},
+		{"size:<0", 0},
+		{"modified:yesterday", 0},
+		{"type:socket", 0},
+		{"ext:", 0},
+		{"(a *.pdf)", 3},
+		{"a OR *.pdf", 5},
+		{"*.pdf OR a", 0},
+		{"re:(", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			_, err := ParseQuery(tt.input)
+			var qe *QueryError
+			if !errors.As(err, &qe) {
+				t.Fatalf("ParseQuery(%q) expected a QueryError, got %v", tt.input, err)
+			}
+			if qe.Pos != tt.pos {
+				t.Errorf("ParseQuery(%q) error %q at %d, expected %d", tt.input, qe.Msg, qe.Pos, tt.pos)
+			}
+		})
+	}
+}
+
+func TestParseQuery_NamePatterns(t *testing.T) {
+	q, err := ParseQuery(`IMG_??.jpg -*.tmp rep* re:^\d{4}-(a|b)" invo`)
+	if err != nil {
+		t.Fatalf("ParseQuery failed: %v", err)
+	}
+	expected := []namePattern{
+		{glob: "IMG_??.jpg"},
+		{glob: "*.tmp", negated: true},
+		{re: `^\d{4}-(a|b)"`},
+	}
+	if !reflect.DeepEqual(q.names, expected) {
+		t.Errorf("names = %+v, expected %+v", q.names, expected)
+	}
+	if q.Match != `"rep" * AND "invo" *` {
+		t.Errorf("match = %q", q.Match)
+	}
+}
+
+func TestSearch_QueryLanguage(t *testing.T) {
+	db, dbPath, cleanup := setupTestDB(t)
+	defer cleanup()
+	createTestFiles(t, db, "test-index")
+
+	searcher := createSearcher(t, dbPath, "test-index")
+	defer searcher.Close()
+
+	recent := time.Now().UTC().AddDate(0, 0, -2).Format("2006-01-02")
+	tests := []struct {
+		query    string
+		expected []string
+	}{
+		{"ext:pdf,txt", []string{"notes.txt", "report.pdf"}},
+		{"size:>1MB", []string{"movie.mp4", "photo.jpg", "screenshot.png"}},
+		{"size:>=1MB type:file", []string{"movie.mp4", "photo.jpg", "report.pdf", "screenshot.png"}},
+		{"photo OR movie", []string{"movie.mp4", "photo.jpg"}},
+		{"path:images", []string{"photo.jpg", "screenshot.png"}},
+		{"in:videos", []string{"movie.mp4"}},
+		{"-photo ext:jpg,png", []string{"screenshot.png"}},
+		{"rep*", []string{"report.pdf"}},
+		{`"report pdf"`, []string{"report.pdf"}},
+		{"modified:>=" + recent + " type:file", []string{"screenshot.png"}},
+		{"repo", []string{"report.pdf"}},
+		{"repo ", nil},
+		{"*.p?f", []string{"report.pdf"}},
+		{"S*shot.PNG", []string{"screenshot.png"}},
+		{"-*.jpg ext:jpg,png", []string{"screenshot.png"}},
+		{`re:^(photo|movie)\.`, []string{"movie.mp4", "photo.jpg"}},
+		{"re:(?i)^SCREEN", []string{"screenshot.png"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			results, err := searcher.Search(tt.query, nil, 100)
+			if err != nil {
+				t.Fatalf("Search failed: %v", err)
+			}
+			var names []string
+			for _, f := range results {
+				names = append(names, f.Name)
+			}
+			sort.Strings(names)
+			if !reflect.DeepEqual(names, tt.expected) {
+				t.Errorf("Search(%q) = %v, expected %v", tt.query, names, tt.expected)
+			}
+		})
+	}
+
+	t.Run("qualifiers replace form fields", func(t *testing.T) {
+		results, err := searcher.Search("ext:mp4", &FileFilter{Exts: []string{"pdf"}, MinSize: 1}, 100)
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		if len(results) != 1 || results[0].Name != "movie.mp4" {
+			t.Errorf("expected movie.mp4, got %+v", results)
+		}
+	})
+
+	t.Run("parse errors are returned", func(t *testing.T) {
+		_, err := searcher.Search("(unclosed", nil, 100)
+		var qe *QueryError
+		if !errors.As(err, &qe) {
+			t.Errorf("expected a QueryError, got %v", err)
+		}
+	})
+}
@@ -11,6 +11,8 @@ import (
 	"sync"
 	"sync/atomic"
 	"time"
+
+	"github.com/ogefest/findex/models"
 )
 
 // ScanLogger handles logging to both stdout and a compressed file
@@ -31,8 +33,24 @@ type ScanLogger struct {
 	errorsCount     int64
 	zipFilesScanned int64
 	zipEntriesFound int64
+	skippedHidden   int64
+	skippedDepth    int64
+	skippedInclude  int64
+	skippedSize     int64
+	symlinkLoops    int64
+	mountBoundaries int64
 }
 
+// skipReason tells why an entry was left out by the per-root walk limits
+type skipReason string
+
+const (
+	skipHidden  skipReason = "hidden"
+	skipDepth   skipReason = "max_depth"
+	skipInclude skipReason = "include_patterns"
+	skipSize    skipReason = "file_size"
+)
+
 // NewScanLogger creates a new logger that writes to both stdout and a gzipped log file
 // The log file is created in the same directory as the database
 func NewScanLogger(dbPath, indexName string, retentionDays int) (*ScanLogger, error) {
@@ -128,18 +146,45 @@ func (sl *ScanLogger) LogSection(title string) {
 }
 
 // LogConfig logs the scan configuration
-func (sl *ScanLogger) LogConfig(rootPaths []string, excludePaths []string, numWorkers int, scanZipContents bool) {
+func (sl *ScanLogger) LogConfig(idx models.IndexConfig) {
 	sl.LogSection("SCAN CONFIGURATION")
-	sl.Log("Root paths (%d):", len(rootPaths))
-	for i, p := range rootPaths {
+	sl.Log("Root paths (%d):", len(idx.RootPaths)+len(idx.Roots))
+	for i, p := range idx.RootPaths {
+		sl.Log("  [%d] %s", i+1, p)
+	}
+	for i, rc := range idx.Roots {
+		sl.Log("  [%d] %s", len(idx.RootPaths)+i+1, rc.Path)
+	}
+	sl.Log("Exclude paths (%d):", len(idx.ExcludePaths))
+	for i, p := range idx.ExcludePaths {
+		sl.Log("  [%d] %s", i+1, p)
+	}
+	sl.Log("Exclude patterns (%d):", len(idx.ExcludePatterns))
+	for i, p := range idx.ExcludePatterns {
 		sl.Log("  [%d] %s", i+1, p)
 	}
-	sl.Log("Exclude patterns (%d):", len(excludePaths))
-	for i, p := range excludePaths {
+	sl.Log("Exclude regex (%d):", len(idx.ExcludeRegex))
+	for i, p := range idx.ExcludeRegex {
 		sl.Log("  [%d] %s", i+1, p)
 	}
-	sl.Log("Number of workers: %d", numWorkers)
-	sl.Log("Scan zip contents: %v", scanZipContents)
+	sl.Log("Ignore files: %s", IgnoreFileName)
+	sl.Log("Include patterns (%d):", len(idx.IncludePatterns))
+	for i, p := range idx.IncludePatterns {
+		sl.Log("  [%d] %s", i+1, p)
+	}
+	sl.Log("Max depth: %d", idx.MaxDepth)
+	sl.Log("File size limits: min=%q max=%q", idx.MinFileSize, idx.MaxFileSize)
+	sl.Log("Skip hidden: %v", idx.SkipHidden)
+	for i, rc := range idx.Roots {
+		sl.Log("Root override [%d] %s: include=%v max_depth=%d min=%q max=%q skip_hidden=%v",
+			i+1, rc.Path, rc.IncludePatterns, rc.MaxDepth, rc.MinFileSize, rc.MaxFileSize, formatOptionalBool(rc.SkipHidden))
+	}
+	sl.Log("Follow symlinks: %v", idx.FollowSymlinks)
+	sl.Log("One file system: %v", idx.OneFileSystem)
+	sl.Log("Number of workers: %d", idx.ScanWorkers)
+	sl.Log("Scan zip contents: %v", idx.ScanZipContents)
+	sl.Log("Keep history: %v (retention %d days, max %d files)", idx.KeepHistory, idx.HistoryRetention, idx.HistoryMaxFiles)
+	sl.Log("Trigram index: %v", idx.TrigramIndex)
 }
 
 // LogPreviousStats logs statistics from previous scan
@@ -198,6 +243,18 @@ func (sl *ScanLogger) LogExcludedFile(path, pattern string) {
 	sl.Log("EXCLUDED FILE: %s (pattern: %s)", path, pattern)
 }
 
+// LogSymlinkLoop logs a directory reached again through a followed symlink
+func (sl *ScanLogger) LogSymlinkLoop(path string) {
+	atomic.AddInt64(&sl.symlinkLoops, 1)
+	sl.Log("SYMLINK LOOP: %s (directory already visited, not descending)", path)
+}
+
+// LogMountBoundary logs a directory on another filesystem that was not entered
+func (sl *ScanLogger) LogMountBoundary(path string) {
+	atomic.AddInt64(&sl.mountBoundaries, 1)
+	sl.Log("MOUNT BOUNDARY: %s (one_file_system, not descending)", path)
+}
+
 // LogError logs an error during scanning
 func (sl *ScanLogger) LogError(context, path string, err error) {
 	atomic.AddInt64(&sl.errorsCount, 1)
@@ -216,6 +273,22 @@ func (sl *ScanLogger) IncrementFiles() {
 	atomic.AddInt64(&sl.filesScanned, 1)
 }
 
+// IncrementSkipped counts an entry left out by include/depth/size/hidden
+// limits. These are not logged one by one since include-only indexes may
+// skip millions of files.
+func (sl *ScanLogger) IncrementSkipped(reason skipReason) {
+	switch reason {
+	case skipHidden:
+		atomic.AddInt64(&sl.skippedHidden, 1)
+	case skipDepth:
+		atomic.AddInt64(&sl.skippedDepth, 1)
+	case skipInclude:
+		atomic.AddInt64(&sl.skippedInclude, 1)
+	case skipSize:
+		atomic.AddInt64(&sl.skippedSize, 1)
+	}
+}
+
 // IncrementDirs increments the directory counter
 func (sl *ScanLogger) IncrementDirs() {
 	atomic.AddInt64(&sl.dirsScanned, 1)
@@ -258,6 +331,15 @@ func (sl *ScanLogger) LogComparison(prevFiles, currFiles, prevDirs, currDirs int
 	}
 }
 
+// LogChanges logs the changes journaled for this scan
+func (sl *ScanLogger) LogChanges(c models.ChangeSummary) {
+	sl.LogSection("CHANGES")
+	sl.Log("Added: %d", c.Added)
+	sl.Log("Removed: %d", c.Removed)
+	sl.Log("Modified: %d", c.Modified)
+	sl.Log("Moved: %d", c.Moved)
+}
+
 // LogSummary logs the final summary
 func (sl *ScanLogger) LogSummary() {
 	duration := time.Since(sl.startTime)
@@ -268,6 +350,12 @@ func (sl *ScanLogger) LogSummary() {
 	sl.Log("Directories scanned: %d", atomic.LoadInt64(&sl.dirsScanned))
 	sl.Log("Files excluded: %d", atomic.LoadInt64(&sl.filesExcluded))
 	sl.Log("Directories excluded: %d", atomic.LoadInt64(&sl.dirsExcluded))
+	sl.Log("Hidden entries skipped: %d", atomic.LoadInt64(&sl.skippedHidden))
+	sl.Log("Directories not descended (max_depth): %d", atomic.LoadInt64(&sl.skippedDepth))
+	sl.Log("Files not matching include_patterns: %d", atomic.LoadInt64(&sl.skippedInclude))
+	sl.Log("Files outside size limits: %d", atomic.LoadInt64(&sl.skippedSize))
+	sl.Log("Symlink loops avoided: %d", atomic.LoadInt64(&sl.symlinkLoops))
+	sl.Log("Mount boundaries not crossed: %d", atomic.LoadInt64(&sl.mountBoundaries))
 	sl.Log("Errors encountered: %d", atomic.LoadInt64(&sl.errorsCount))
 	sl.Log("Zip files scanned: %d", atomic.LoadInt64(&sl.zipFilesScanned))
 	sl.Log("Zip entries found: %d", atomic.LoadInt64(&sl.zipEntriesFound))
@@ -315,6 +403,14 @@ func (sl *ScanLogger) GetLogPath() string {
 	return sl.logPath
 }
 
+// formatOptionalBool renders an unset override as "inherit"
+func formatOptionalBool(b *bool) string {
+	if b == nil {
+		return "inherit"
+	}
+	return fmt.Sprintf("%v", *b)
+}
+
 // repeat returns a string with s repeated n times
 func repeat(s string, n int) string {
 	return strings.Repeat(s, n)
@@ -1,12 +1,17 @@
 package app
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
-	"hash/crc32"
 	"log"
+	"net/url"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/ogefest/findex/models"
@@ -14,17 +19,150 @@ import (
 )
 
 type FileFilter struct {
-	MinSize     int64
-	MaxSize     int64
-	Exts        []string
-	ModTimeFrom int64 // unix timestamp
-	ModTimeTo   int64 // unix timestamp
-	OnlyFiles   bool
-	OnlyDirs    bool
+	MinSize        int64
+	MaxSize        int64
+	HasMaxSize     bool // MaxSize is set, so that 0 matches empty files only
+	Exts           []string
+	ModTimeFrom    int64 // unix timestamp
+	ModTimeTo      int64 // unix timestamp
+	OnlyFiles      bool
+	OnlyDirs       bool
+	OnlyLinks      bool
+	Owner          string // user name or numeric uid
+	Group          string // group name or numeric gid
+	IncludeDeleted bool   // also search tombstones of deleted files
+	InDir          string // only entries below this directory
+	MatchMode      string // MatchWords, MatchSubstring or MatchFuzzy, empty for words
+	Sort           string // SortRelevance, SortName, SortSize, SortModified or SortPath
+	SortDesc       bool   // reverse the sort
+}
+
+// ParseFilter reads a FileFilter from the search form parameters: min_size,
+// max_size, ext, date_from, date_to, type, owner, group, in, deleted, match,
+// sort and order. Invalid values are ignored.
+func ParseFilter(q url.Values) *FileFilter {
+	filter := &FileFilter{}
+
+	// Parse size filters
+	if minSize := q.Get("min_size"); minSize != "" {
+		if val, err := ParseSize(minSize); err == nil {
+			filter.MinSize = val
+		}
+	}
+	if maxSize := q.Get("max_size"); maxSize != "" {
+		if val, err := ParseSize(maxSize); err == nil {
+			filter.MaxSize = val
+			filter.HasMaxSize = true
+		}
+	}
+
+	// Parse extension filter
+	if exts := q.Get("ext"); exts != "" {
+		extList := strings.Split(exts, ",")
+		for _, ext := range extList {
+			ext = strings.TrimSpace(ext)
+			if ext != "" {
+				filter.Exts = append(filter.Exts, ext)
+			}
+		}
+	}
+
+	// Parse date filters
+	if dateFrom := q.Get("date_from"); dateFrom != "" {
+		if t, err := time.Parse("2006-01-02", dateFrom); err == nil {
+			filter.ModTimeFrom = t.Unix()
+		}
+	}
+	if dateTo := q.Get("date_to"); dateTo != "" {
+		if t, err := time.Parse("2006-01-02", dateTo); err == nil {
+			// End of day
+			filter.ModTimeTo = t.Add(24*time.Hour - time.Second).Unix()
+		}
+	}
+
+	// Parse type filter
+	fileType := q.Get("type")
+	if fileType == "files" {
+		filter.OnlyFiles = true
+	} else if fileType == "dirs" {
+		filter.OnlyDirs = true
+	} else if fileType == "links" {
+		filter.OnlyLinks = true
+	}
+
+	// Parse ownership filters
+	filter.Owner = strings.TrimSpace(q.Get("owner"))
+	filter.Group = strings.TrimSpace(q.Get("group"))
+
+	if dir := strings.TrimSpace(q.Get("in")); dir != "" {
+		filter.InDir = filepath.Clean(dir)
+	}
+
+	filter.IncludeDeleted = q.Get("deleted") == "1"
+
+	switch mode := q.Get("match"); mode {
+	case MatchSubstring, MatchFuzzy:
+		filter.MatchMode = mode
+	}
+
+	switch by := q.Get("sort"); by {
+	case SortName, SortSize, SortModified, SortPath:
+		filter.Sort = by
+	}
+	switch q.Get("order") {
+	case "asc":
+	case "desc":
+		filter.SortDesc = filter.Sort != ""
+	default:
+		filter.SortDesc = sortDefaultDesc[filter.Sort]
+	}
+
+	return filter
+}
+
+// fileColumns is the column list read by scanFileRecord, selected from
+// fileTables
+const fileColumns = `f.id, d.path, f.name, COALESCE(r.path, d.path), f.ext, f.size, f.mod_time, f.is_dir, f.index_name, COALESCE(f.link_target, ''),
+	COALESCE(f.owner_name, ''), COALESCE(f.group_name, ''), COALESCE(f.mode, 0), COALESCE(f.first_seen, 0),
+	COALESCE(f.origin, '')`
+
+// fileTables joins files (aliased f) with the parent directory d and its root
+// r, which together hold the path that is no longer stored per file
+const fileTables = `files f
+	JOIN dirs d ON d.id = f.parent_id
+	LEFT JOIN dirs r ON r.id = d.root_id`
+
+// rowScanner is implemented by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanFileRecord reads one row selected with fileColumns
+func scanFileRecord(row rowScanner) (models.FileRecord, error) {
+	var f models.FileRecord
+	var parent string
+	var mod, firstSeen int64
+	var isDir int
+	if err := row.Scan(&f.ID, &parent, &f.Name, &f.Dir, &f.Ext, &f.Size, &mod, &isDir, &f.IndexName, &f.LinkTarget,
+		&f.Owner, &f.Group, &f.Mode, &firstSeen, &f.Origin); err != nil {
+		return f, err
+	}
+	f.Path = entryPath(parent, f.Name)
+	f.ModTime = time.Unix(mod, 0)
+	f.FirstSeen = unixTime(firstSeen)
+	f.IsDir = isDir != 0
+	return f, nil
 }
 
 type Searcher struct {
 	dbs map[string]*sql.DB
+
+	// Timeout is how long a search waits for the indexes,
+	// DefaultSearchTimeout when zero
+	Timeout time.Duration
+
+	trigramOnce sync.Once
+	trigrams    map[string]bool // indexes with a trigram index, see hasTrigrams
 }
 
 func NewSearcher(indexes []*models.IndexConfig) (*Searcher, error) {
@@ -41,6 +179,14 @@ func NewSearcher(indexes []*models.IndexConfig) (*Searcher, error) {
 		db.Exec(`PRAGMA journal_mode = WAL`)
 		db.Exec(`PRAGMA busy_timeout = 5000`)
 
+		if err := RunMigrations(db); err != nil {
+			db.Close()
+			for _, d := range dbs {
+				d.Close()
+			}
+			return nil, fmt.Errorf("failed to migrate db %s: %w", idx.DBPath, err)
+		}
+
 		dbs[idx.Name] = db
 	}
 	return &Searcher{dbs: dbs}, nil
@@ -52,23 +198,267 @@ func (s *Searcher) Close() {
 	}
 }
 
+// Search runs a search box query, see ParseQuery, together with the search
+// form filter and returns up to limitPerIndex results of every index, merged
+// in the sort order of the filter. A query that cannot be parsed returns a
+// *QueryError, a substring or fuzzy search when no index has a trigram index
+// ErrNoTrigramIndex. Indexes are searched at once; when some fail, or have
+// no trigram index for such a search, the results of the others are
+// returned with an error naming them. Results carry the parts of their name
+// and path the query matched.
 func (s *Searcher) Search(query string, filter *FileFilter, limitPerIndex int) ([]models.FileRecord, error) {
-	var results []models.FileRecord
-	for _, db := range s.dbs {
-		res, err := s.searchIndex(db, query, filter, limitPerIndex)
-		if err != nil {
+	q, err := s.compile(query, filter)
+	if err != nil {
+		return nil, err
+	}
+	hits, statuses := s.searchHits(context.Background(), q, nil, limitPerIndex)
+	results := records(hits)
+	q.markMatches(results)
+	return results, indexesError(statuses)
+}
+
+// Page is one page of search results. Prev and Next are the cursors of the
+// pages around it for SearchPage, empty on the first and the last page.
+// Indexes reports how long every index took and why failed ones are missing.
+// DeletedSkipped is set when deleted files were asked for but the match mode
+// cannot search them, so the page holds existing files only.
+type Page struct {
+	Results        []models.FileRecord
+	Prev           string
+	Next           string
+	Indexes        []IndexStatus
+	DeletedSkipped bool
+}
+
+// SearchPage returns up to limit results of a search like Search, starting
+// at the first or at cursor, the Prev or Next of an earlier page of the same
+// search and sort. A cursor it did not write returns ErrInvalidCursor.
+// Indexes that fail, miss the timeout of the searcher or cannot run the
+// match mode are left out of the page and reported in Page.Indexes.
+func (s *Searcher) SearchPage(ctx context.Context, query string, filter *FileFilter, cursor string, limit int) (*Page, error) {
+	q, err := s.compile(query, filter)
+	if err != nil {
+		return nil, err
+	}
+	at, err := parseCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	// The page before a cursor is the page after it in the reverse order
+	sortDesc := q.Filter.SortDesc
+	if at != nil && at.Before {
+		q.Filter.SortDesc = !sortDesc
+	}
+	hits, statuses := s.searchHits(ctx, q, at, limit+1)
+	more := len(hits) > limit
+	if more {
+		hits = hits[:limit]
+	}
+	if at != nil && at.Before {
+		if !more {
+			// Back at the start, which shows a full first page
+			return s.SearchPage(ctx, query, filter, "", limit)
+		}
+		slices.Reverse(hits)
+		q.Filter.SortDesc = sortDesc
+	}
+
+	page := &Page{Results: records(hits), Indexes: statuses, DeletedSkipped: q.Filter.IncludeDeleted && !q.searchesDeleted()}
+	q.markMatches(page.Results)
+	if len(hits) == 0 {
+		return page, nil
+	}
+	if at != nil {
+		page.Prev = cursorAt(&hits[0], q.Filter.Sort, true).String()
+	}
+	if more || (at != nil && at.Before) {
+		page.Next = cursorAt(&hits[len(hits)-1], q.Filter.Sort, false).String()
+	}
+	return page, nil
+}
+
+// searchHits searches every index at once for up to limit hits after the
+// cursor at, or from the start when it is nil, and merges them in sort order
+func (s *Searcher) searchHits(ctx context.Context, q *Query, at *cursor, limit int) ([]searchHit, []IndexStatus) {
+	lists, statuses := fanOut(ctx, s, func(ctx context.Context, name string, db *sql.DB) ([]searchHit, error) {
+		if err := s.checkIndex(q, name); err != nil {
 			return nil, err
 		}
-		results = append(results, res...)
+		return searchIndex(ctx, name, db, q, at, limit)
+	})
+	// Every index returns its hits in the order asked for, merging them
+	// keeps that order across indexes
+	return mergeHits(lists, hitLess(&q.Filter)), statuses
+}
+
+func records(hits []searchHit) []models.FileRecord {
+	results := make([]models.FileRecord, len(hits))
+	for i, h := range hits {
+		results[i] = h.FileRecord
 	}
-	return results, nil
+	return results
+}
+
+// countLimit is how many results of an index Count counts before it gives
+// up on an exact total
+const countLimit = 100000
+
+// Count is the number of results of a search. Exact is false when an index
+// had more than countLimit results, or more fuzzy candidates than are
+// compared, or failed, and Total is a lower bound. Indexes skipped for the
+// match mode leave it exact. Indexes reports how every index answered.
+type Count struct {
+	Total   int64
+	Exact   bool
+	Indexes []IndexStatus
+}
+
+// Count counts the results of a search like SearchPage without a limit
+func (s *Searcher) Count(ctx context.Context, query string, filter *FileFilter) (Count, error) {
+	q, err := s.compile(query, filter)
+	if err != nil {
+		return Count{}, err
+	}
+	type indexCount struct {
+		n     int64
+		exact bool
+	}
+	counts, statuses := fanOut(ctx, s, func(ctx context.Context, name string, db *sql.DB) (indexCount, error) {
+		if err := s.checkIndex(q, name); err != nil {
+			return indexCount{}, err
+		}
+		n, exact, err := countIndex(ctx, db, q)
+		return indexCount{n, exact}, err
+	})
+	// A failed index counts as inexact
+	count := Count{Exact: true, Indexes: statuses}
+	for i, c := range counts {
+		if statuses[i].Skipped {
+			continue
+		}
+		count.Total += c.n
+		count.Exact = count.Exact && c.exact
+	}
+	return count, nil
+}
+
+// countIndex counts the results of q in one index, stopping at countLimit
+func countIndex(ctx context.Context, db *sql.DB, q *Query) (int64, bool, error) {
+	if q.Filter.MatchMode == MatchFuzzy {
+		return countFuzzy(ctx, db, q)
+	}
+
+	from, where, ok := searchSource(q)
+	if !ok {
+		return 0, true, nil
+	}
+	n, err := countRows(ctx, db, from, where)
+	if err != nil {
+		return 0, false, err
+	}
+	if q.searchesDeleted() {
+		if from, where, ok := tombstoneSource(q); ok {
+			deleted, err := countRows(ctx, db, from, where)
+			if err != nil {
+				return 0, false, err
+			}
+			n += deleted
+		}
+	}
+	if n > countLimit {
+		return countLimit, false, nil
+	}
+	return n, true, nil
+}
+
+// countRows counts the rows of a search source up to one past countLimit
+func countRows(ctx context.Context, db *sql.DB, from string, where *sqlWhere) (int64, error) {
+	var n int64
+	err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM (SELECT 1 FROM `+from+` WHERE `+where.String()+` LIMIT ?)`,
+		append(where.Args(), countLimit+1)...).Scan(&n)
+	return n, err
+}
+
+// countFuzzy counts the fuzzy candidates within the allowed edit distance,
+// which only comparing them tells
+func countFuzzy(ctx context.Context, db *sql.DB, q *Query) (int64, bool, error) {
+	sqlQuery, args, ok := searchStatement(q, "", nil)
+	if !ok {
+		return 0, true, nil
+	}
+	rows, err := db.QueryContext(ctx, sqlQuery+" LIMIT ?", append(args, fuzzyCandidates)...)
+	if err != nil {
+		return 0, false, err
+	}
+	defer rows.Close()
+
+	var n, candidates int64
+	var score float64
+	for rows.Next() {
+		f, err := scanFileRecord(scoredRow{rows, &score})
+		if err != nil {
+			return 0, false, err
+		}
+		candidates++
+		if q.fuzzyDistance(f.Name) >= 0 {
+			n++
+		}
+	}
+	return n, candidates < fuzzyCandidates, rows.Err()
+}
+
+// CheckSearch returns the error Search and Export fail with before reading
+// any result, a *QueryError or ErrNoTrigramIndex
+func (s *Searcher) CheckSearch(query string, filter *FileFilter) error {
+	_, err := s.compile(query, filter)
+	return err
+}
+
+// compile parses a search. A substring or fuzzy search fails only when none
+// of the indexes has a trigram index, the others are skipped by checkIndex.
+func (s *Searcher) compile(query string, filter *FileFilter) (*Query, error) {
+	q, err := compileSearch(query, filter)
+	if err != nil {
+		return nil, err
+	}
+	q.resolveSort()
+	if !q.usesTrigrams() || len(s.dbs) == 0 {
+		return q, nil
+	}
+	for name := range s.dbs {
+		if s.hasTrigrams(name) {
+			return q, nil
+		}
+	}
+	return nil, ErrNoTrigramIndex
+}
+
+// checkIndex returns ErrNoTrigramIndex when the index name cannot run q
+func (s *Searcher) checkIndex(q *Query, name string) error {
+	if q.usesTrigrams() && !s.hasTrigrams(name) {
+		return ErrNoTrigramIndex
+	}
+	return nil
+}
+
+// hasTrigrams reports whether the index name has a trigram index. The
+// indexes are checked once per searcher, the first time it is asked.
+func (s *Searcher) hasTrigrams(name string) bool {
+	s.trigramOnce.Do(func() {
+		s.trigrams = make(map[string]bool, len(s.dbs))
+		for n, db := range s.dbs {
+			s.trigrams[n] = hasTrigramIndex(db)
+		}
+	})
+	return s.trigrams[name]
 }
 
 func (s *Searcher) GetFileByID(indexName string, id int64) (*models.FileRecord, error) {
 	sqlQuery := `
-        SELECT id, path, name, dir, ext, size, mod_time, is_dir, index_name
-        FROM files
-        WHERE id = ?
+        SELECT ` + fileColumns + `
+        FROM ` + fileTables + `
+        WHERE f.id = ?
         LIMIT 1`
 	rows, err := s.dbs[indexName].Query(sqlQuery, id)
 	if err != nil {
@@ -77,14 +467,10 @@ func (s *Searcher) GetFileByID(indexName string, id int64) (*models.FileRecord,
 	defer rows.Close()
 
 	for rows.Next() {
-		var f models.FileRecord
-		var mod int64
-		var isDir int
-		if err := rows.Scan(&f.ID, &f.Path, &f.Name, &f.Dir, &f.Ext, &f.Size, &mod, &isDir, &f.IndexName); err != nil {
+		f, err := scanFileRecord(rows)
+		if err != nil {
 			continue
 		}
-		f.ModTime = time.Unix(mod, 0)
-		f.IsDir = isDir != 0
 		return &f, nil
 	}
 
@@ -99,162 +485,103 @@ func (s *Searcher) GetDirectoryContent(indexName string, path string) ([]models.
 		return nil, fmt.Errorf("index not found: %s", indexName)
 	}
 
-	// Get distinct root paths
-	rootRows, err := db.Query(`SELECT DISTINCT dir FROM files WHERE dir != ''`)
-	if err != nil {
-		log.Printf("Error getting roots: %v", err)
-		return nil, err
-	}
-
-	var roots []string
-	for rootRows.Next() {
-		var dir string
-		if err := rootRows.Scan(&dir); err != nil {
-			continue
-		}
-		roots = append(roots, dir)
-	}
-	rootRows.Close()
-	log.Printf("Found %d roots: %v", len(roots), roots)
-
 	// If path is empty, show immediate children of all root directories
 	if path == "" {
+		roots, err := rootDirs(db)
+		if err != nil {
+			log.Printf("Error getting roots: %v", err)
+			return nil, err
+		}
+
 		var result []models.FileRecord
 		for _, root := range roots {
-			dirIndex := int64(crc32.ChecksumIEEE([]byte(filepath.Clean(root))))
-			rows, err := db.Query(`
-				SELECT f.id, f.path, f.name, f.dir, f.ext, f.size, f.mod_time, f.is_dir, f.index_name
-				FROM files f
-				WHERE dir_index = ? AND f.path LIKE ?
-				ORDER BY f.is_dir DESC, f.name
-			`, dirIndex, root+"/%")
+			children, err := s.listChildren(indexName, root.ID)
 			if err != nil {
-				continue
-			}
-
-			for rows.Next() {
-				var f models.FileRecord
-				var mod int64
-				var isDir int
-				if err := rows.Scan(&f.ID, &f.Path, &f.Name, &f.Dir, &f.Ext, &f.Size, &mod, &isDir, &f.IndexName); err != nil {
-					continue
-				}
-				f.ModTime = time.Unix(mod, 0)
-				f.IsDir = isDir != 0
-				result = append(result, f)
+				return nil, err
 			}
-			rows.Close()
+			result = append(result, children...)
 		}
 		return result, nil
 	}
 
-	// For non-empty path, check if it's a relative path and resolve it
-	// If path doesn't start with any root, try to find matching root + path
-	fullPath := path
-	isRelative := true
-	for _, root := range roots {
-		if strings.HasPrefix(path, root) {
-			isRelative = false
-			break
-		}
+	dir, ok, err := resolveDir(db, path)
+	if err != nil {
+		return nil, err
 	}
-	if isRelative && len(roots) > 0 {
-		// Try to find a matching full path
-		for _, root := range roots {
-			testPath := root + "/" + path
-			var count int
-			db.QueryRow(`SELECT COUNT(*) FROM files WHERE path = ? OR path LIKE ?`, testPath, testPath+"/%").Scan(&count)
-			log.Printf("Checking relative path: root=%s, testPath=%s, count=%d", root, testPath, count)
-			if count > 0 {
-				fullPath = testPath
-				log.Printf("Resolved relative path %s to %s", path, fullPath)
-				break
-			}
-		}
+	if !ok {
+		log.Printf("Directory %s not found in %s", path, indexName)
+		return nil, nil
+	}
+
+	result, err := s.listChildren(indexName, dir.ID)
+	if err != nil {
+		return nil, err
 	}
 
-	pathWithSlash := fullPath + "/"
-	dirIndex := int64(crc32.ChecksumIEEE([]byte(filepath.Clean(fullPath))))
+	log.Printf("Found %d elems in %s %s", len(result), indexName, dir.Path)
 
-	sqlQuery := `
-		SELECT
-			f.id,
-			f.path,
-			f.name,
-			f.dir,
-			f.ext,
-			f.size,
-			f.mod_time,
-			f.is_dir,
-			f.index_name
-		FROM files f
-		WHERE
-			dir_index = ? AND f.path LIKE ?
-		ORDER BY f.is_dir DESC, f.name;
-    `
-	rows, err := db.Query(sqlQuery, dirIndex, pathWithSlash+"%")
+	return result, nil
+}
+
+// DirPath returns the stored path of a browse path, which is either a full
+// path or relative to one of the roots, for FileFilter.InDir. ok is false
+// when no directory matches.
+func (s *Searcher) DirPath(indexName string, path string) (string, bool, error) {
+	db := s.dbs[indexName]
+	if db == nil {
+		return "", false, fmt.Errorf("index not found: %s", indexName)
+	}
+	dir, ok, err := resolveDir(db, path)
+	return dir.Path, ok, err
+}
+
+// listChildren returns the entries of one directory, directories first, with
+// directory sizes taken from dir_sizes, or calculated and cached on demand
+// for indexes scanned by older releases
+func (s *Searcher) listChildren(indexName string, dirID int64) ([]models.FileRecord, error) {
+	db := s.dbs[indexName]
+	rows, err := db.Query(`
+		SELECT `+fileColumns+`
+		FROM `+fileTables+`
+		WHERE f.parent_id = ?
+		ORDER BY f.is_dir DESC, f.name
+	`, dirID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
 	var result []models.FileRecord
-
 	for rows.Next() {
-		var f models.FileRecord
-		var mod int64
-		var isDir int
-
-		if err := rows.Scan(
-			&f.ID,
-			&f.Path,
-			&f.Name,
-			&f.Dir,
-			&f.Ext,
-			&f.Size,
-			&mod,
-			&isDir,
-			&f.IndexName,
-		); err != nil {
+		f, err := scanFileRecord(rows)
+		if err != nil {
 			return nil, err
 		}
-
-		f.ModTime = time.Unix(mod, 0)
-		f.IsDir = isDir != 0
-
-		if f.IsDir {
-			// Use cached directory size, calculate and cache if not present
-			var cachedSize int64
-			err := s.dbs[indexName].QueryRow(`SELECT total_size FROM dir_sizes WHERE path = ?`, f.Path).Scan(&cachedSize)
-			if err == nil {
-				f.Size = cachedSize
-			} else if err == sql.ErrNoRows {
-				// Calculate and cache on demand
-				var size int64
-				var count int64
-				calcErr := s.dbs[indexName].QueryRow(`
-					SELECT COALESCE(SUM(size), 0), COUNT(*)
-					FROM files
-					WHERE path LIKE ? AND is_dir = 0
-				`, f.Path+"/%").Scan(&size, &count)
-				if calcErr == nil {
-					f.Size = size
-					s.dbs[indexName].Exec(`
-						INSERT OR REPLACE INTO dir_sizes (path, total_size, file_count)
-						VALUES (?, ?, ?)
-					`, f.Path, size, count)
-				}
-			}
-		}
-
 		result = append(result, f)
 	}
-
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
+	rows.Close()
 
-	log.Printf("Found %d elems in %s %s", len(result), indexName, path)
+	for i := range result {
+		f := &result[i]
+		if !f.IsDir {
+			continue
+		}
+		// Use cached directory size, calculate and cache if not present
+		var cachedSize int64
+		err := db.QueryRow(`SELECT total_size FROM dir_sizes WHERE path = ?`, f.Path).Scan(&cachedSize)
+		if err == nil {
+			f.Size = cachedSize
+		} else if err == sql.ErrNoRows {
+			t, calcErr := querySubtreeTotals(db, f.Path)
+			if calcErr == nil {
+				f.Size = t.Apparent
+				cacheDirSize(db, f.Path, t)
+			}
+		}
+	}
 
 	return result, nil
 }
@@ -269,196 +596,238 @@ func (s *Searcher) GetDirectorySize(indexName string, path string) (models.DirIn
 	}
 
 	if path == "" {
-		sqlQ := "SELECT SUM(size), COUNT(*) FROM files WHERE is_dir = 0"
-		err := db.QueryRow(sqlQ).Scan(&result.Size, &result.Files)
+		t, err := querySizeTotals(db, "")
 		if err != nil {
 			return models.DirInfo{}, err
 		}
-		return result, nil
-	}
-
-	// Resolve relative path to full path
-	fullPath := path
-	rootRows, err := db.Query(`SELECT DISTINCT dir FROM files WHERE dir != ''`)
-	if err == nil {
-		var roots []string
-		for rootRows.Next() {
-			var dir string
-			if rootRows.Scan(&dir) == nil {
-				roots = append(roots, dir)
-			}
+		if err := db.QueryRow(`SELECT COUNT(*) FROM dirs WHERE parent_id IS NOT NULL`).Scan(&t.Dirs); err != nil {
+			return models.DirInfo{}, err
 		}
-		rootRows.Close()
+		return dirInfoFromTotals(t), nil
+	}
 
-		isRelative := true
-		for _, root := range roots {
-			if strings.HasPrefix(path, root) {
-				isRelative = false
-				break
-			}
-		}
-		if isRelative && len(roots) > 0 {
-			for _, root := range roots {
-				testPath := root + "/" + path
-				var count int
-				db.QueryRow(`SELECT COUNT(*) FROM files WHERE path = ? OR path LIKE ?`, testPath, testPath+"/%").Scan(&count)
-				if count > 0 {
-					fullPath = testPath
-					break
-				}
-			}
-		}
+	dir, ok, err := resolveDir(db, path)
+	if err != nil {
+		return models.DirInfo{}, err
+	}
+	if !ok {
+		return result, nil
 	}
 
-	// Try cache first
+	// Sizes are stored by the scan
 	err = db.QueryRow(`
-		SELECT total_size, file_count FROM dir_sizes WHERE path = ?
-	`, fullPath).Scan(&result.Size, &result.Files)
+		SELECT total_size, file_count, COALESCE(unique_size, total_size), COALESCE(disk_size, total_size), COALESCE(dir_count, 0)
+		FROM dir_sizes WHERE path = ?
+	`, dir.Path).Scan(&result.Size, &result.Files, &result.UniqueSize, &result.DiskUsage, &result.Dirs)
 	if err == nil {
 		return result, nil
 	}
 
-	// Calculate and cache on demand
-	sqlQ := `
-		SELECT COALESCE(SUM(size), 0), COUNT(*)
-		FROM files
-		WHERE path LIKE ? AND is_dir = 0
-	`
-	err = db.QueryRow(sqlQ, fullPath+"/%").Scan(&result.Size, &result.Files)
+	// Indexes scanned by older releases may lack the row, calculate and cache
+	// it on demand
+	t, err := querySubtreeTotals(db, dir.Path)
 	if err != nil {
 		return models.DirInfo{}, err
 	}
+	cacheDirSize(db, dir.Path, t)
 
-	// Cache the result
-	db.Exec(`
-		INSERT OR REPLACE INTO dir_sizes (path, total_size, file_count)
-		VALUES (?, ?, ?)
-	`, fullPath, result.Size, result.Files)
+	return dirInfoFromTotals(t), nil
+}
 
-	return result, nil
+func dirInfoFromTotals(t sizeTotals) models.DirInfo {
+	return models.DirInfo{
+		Size:       t.Apparent,
+		Files:      t.Files,
+		UniqueSize: t.Unique,
+		DiskUsage:  t.Allocated,
+		Dirs:       t.Dirs,
+	}
 }
 
-func (s *Searcher) searchIndex(db *sql.DB, query string, filter *FileFilter, limit int) ([]models.FileRecord, error) {
-	log.Printf("Index search %s %d\n", query, limit)
+func searchIndex(ctx context.Context, name string, db *sql.DB, q *Query, at *cursor, limit int) ([]searchHit, error) {
+	log.Printf("Index search %s %d\n", q.Match, limit)
 
-	// Build filter conditions
-	var conditions []string
-	if filter != nil {
-		if filter.MinSize > 0 {
-			conditions = append(conditions, fmt.Sprintf("f.size >= %d", filter.MinSize))
-		}
-		if filter.MaxSize > 0 {
-			conditions = append(conditions, fmt.Sprintf("f.size <= %d", filter.MaxSize))
-		}
-		if len(filter.Exts) > 0 {
-			var exts []string
-			for _, e := range filter.Exts {
-				e = strings.TrimPrefix(e, ".")
-				exts = append(exts, fmt.Sprintf("f.ext='.%s'", e))
-			}
-			conditions = append(conditions, "("+strings.Join(exts, " OR ")+")")
-		}
-		if filter.ModTimeFrom > 0 {
-			conditions = append(conditions, fmt.Sprintf("f.mod_time >= %d", filter.ModTimeFrom))
-		}
-		if filter.ModTimeTo > 0 {
-			conditions = append(conditions, fmt.Sprintf("f.mod_time <= %d", filter.ModTimeTo))
-		}
-		if filter.OnlyFiles {
-			conditions = append(conditions, "f.is_dir = 0")
-		}
-		if filter.OnlyDirs {
-			conditions = append(conditions, "f.is_dir = 1")
-		}
+	fuzzy := q.Filter.MatchMode == MatchFuzzy
+	keyset := at
+	if fuzzy {
+		// Fuzzy hits are ordered by distance once read, the cursor too
+		keyset = nil
 	}
-
+	sqlQuery, args, ok := searchStatement(q, name, keyset)
 	// If no query and no filters, return empty
-	if query == "" && len(conditions) == 0 {
+	if !ok {
 		return nil, nil
 	}
 
-	var sqlQuery string
-	var rows *sql.Rows
-	var err error
-
-	if query != "" {
-		// Full-text search with optional filters
-		querySafe := strings.ReplaceAll(query, `"`, `""`)
-		querySafe = strings.ReplaceAll(querySafe, `.`, ` `)
-		querySafe = prepareFTSQuery(querySafe)
-
-		whereClause := ""
-		if len(conditions) > 0 {
-			whereClause = " AND " + strings.Join(conditions, " AND ")
-		}
-
-		sqlQuery = fmt.Sprintf(`
-			SELECT f.id, f.path, f.name, f.dir, f.ext, f.size, f.mod_time, f.is_dir, f.index_name
-			FROM files f
-			JOIN files_fts ft ON ft.rowid = f.rowid
-			WHERE files_fts MATCH ? %s
-			LIMIT ?`, whereClause)
-
-		rows, err = db.Query(sqlQuery, querySafe, limit)
-	} else {
-		// Filter-only search (no FTS)
-		whereClause := strings.Join(conditions, " AND ")
-
-		sqlQuery = fmt.Sprintf(`
-			SELECT f.id, f.path, f.name, f.dir, f.ext, f.size, f.mod_time, f.is_dir, f.index_name
-			FROM files f
-			WHERE %s
-			ORDER BY f.mod_time DESC
-			LIMIT ?`, whereClause)
-
-		rows, err = db.Query(sqlQuery, limit)
+	queryLimit := limit
+	if fuzzy {
+		queryLimit = fuzzyCandidates
 	}
-
+	rows, err := db.QueryContext(ctx, sqlQuery+" LIMIT ?", append(args, queryLimit)...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var results []models.FileRecord
+	less := hitLess(&q.Filter)
+	var results []searchHit
 	for rows.Next() {
-		var f models.FileRecord
-		var mod int64
-		var isDir int
-		if err := rows.Scan(&f.ID, &f.Path, &f.Name, &f.Dir, &f.Ext, &f.Size, &mod, &isDir, &f.IndexName); err != nil {
+		var score float64
+		f, err := scanFileRecord(scoredRow{rows, &score})
+		if err != nil {
 			continue
 		}
-		f.ModTime = time.Unix(mod, 0)
-		f.IsDir = isDir != 0
-		results = append(results, f)
+		if fuzzy {
+			d := q.fuzzyDistance(f.Name)
+			if d < 0 {
+				continue
+			}
+			score = float64(d)
+		}
+		hit := newHit(name, f, score)
+		if fuzzy && at != nil && !less(at.hit(), &hit) {
+			continue
+		}
+		results = append(results, hit)
+	}
+
+	if fuzzy {
+		// Candidates come by shared trigrams, not in the order asked for
+		sort.Slice(results, func(i, j int) bool { return less(&results[i], &results[j]) })
+		if len(results) > limit {
+			results = results[:limit]
+		}
+	}
+
+	if q.searchesDeleted() {
+		deleted, err := searchTombstones(ctx, name, db, q, at, limit)
+		if err != nil {
+			return nil, err
+		}
+		results = mergeHits([][]searchHit{results, deleted}, less)
+		if len(results) > limit {
+			results = results[:limit]
+		}
 	}
 
 	return results, nil
 }
 
-func prepareFTSQuery(query string) string {
-	parts := strings.Fields(query)
-	var include []string
-	var exclude []string
+// searchSource returns the FROM and WHERE of the files matching a compiled
+// query. ok is false when nothing narrows the result.
+func searchSource(q *Query) (from string, where *sqlWhere, ok bool) {
+	table := q.ftsTable()
+	where = &sqlWhere{}
+	if q.Match != "" {
+		where.add(table+" MATCH ?", q.Match)
+	}
+	filterConditions(where, &q.Filter)
+	nameConditions(where, q.names)
+	if q.Path != "" {
+		where.add("f.id IN (SELECT rowid FROM files_fts WHERE files_fts MATCH ?)", q.Path)
+	}
+	if q.Exclude != "" {
+		where.add("f.id NOT IN (SELECT rowid FROM "+table+" WHERE "+table+" MATCH ?)", q.Exclude)
+	}
+	if where.empty() {
+		return "", nil, false
+	}
 
-	for _, p := range parts {
-		p = strings.TrimSpace(p)
-		if p == "" {
-			continue
-		}
-		if strings.HasPrefix(p, "-") && len(p) > 1 {
-			exclude = append(exclude, p[1:])
-		} else {
-			include = append(include, p)
+	from = fileTables
+	if q.Match != "" {
+		// Full-text search with optional filters
+		from += `
+			JOIN ` + table + ` ft ON ft.rowid = f.rowid`
+	}
+	return from, where, true
+}
+
+// searchStatement returns the SELECT of fileColumns and the relevance score
+// matching a compiled query, in the order of its sort, without LIMIT. With a
+// cursor it selects the files of the index name after it. ok is false when
+// nothing narrows the result.
+func searchStatement(q *Query, name string, at *cursor) (sqlQuery string, args []any, ok bool) {
+	from, where, ok := searchSource(q)
+	if !ok {
+		return "", nil, false
+	}
+
+	score := "0"
+	order := orderClause(&q.Filter, fileSort)
+	if q.Match != "" {
+		score = ftsRankFiles
+		if q.usesTrigrams() {
+			score = ftsRankTrigram
 		}
 	}
+	if q.Filter.MatchMode == MatchFuzzy {
+		// Names sharing the most trigrams with the terms are the candidates
+		order = "score"
+	}
+	if at != nil {
+		keysetCondition(where, &q.Filter, fileSort, at, name, false)
+	}
+	sqlQuery = `
+			SELECT ` + fileColumns + `, ` + score + ` AS score
+			FROM ` + from + `
+			WHERE ` + where.String() + `
+			ORDER BY ` + order
+	return sqlQuery, where.Args(), true
+}
 
-	var ftsQuery []string
-	if len(include) > 0 {
-		ftsQuery = append(ftsQuery, strings.Join(include, " AND "))
+// filterConditions adds the conditions of a filter on files aliased f to
+// where. Every field of FileFilter that narrows the result is handled here,
+// IncludeDeleted and MatchMode only select the tables to search, Sort and
+// SortDesc the order of the result.
+func filterConditions(where *sqlWhere, filter *FileFilter) {
+	if filter == nil {
+		return
+	}
+	if filter.MinSize > 0 {
+		where.add("f.size >= ?", filter.MinSize)
+	}
+	if filter.MaxSize > 0 || filter.HasMaxSize {
+		where.add("f.size <= ?", filter.MaxSize)
+	}
+	if len(filter.Exts) > 0 {
+		var exts []any
+		for _, e := range filter.Exts {
+			exts = append(exts, "."+strings.TrimPrefix(e, "."))
+		}
+		where.in("f.ext", exts...)
+	}
+	if filter.ModTimeFrom > 0 {
+		where.add("f.mod_time >= ?", filter.ModTimeFrom)
+	}
+	if filter.ModTimeTo > 0 {
+		where.add("f.mod_time <= ?", filter.ModTimeTo)
 	}
-	for _, ex := range exclude {
-		ftsQuery = append(ftsQuery, "NOT "+ex)
+	if filter.OnlyFiles {
+		where.add("f.is_dir = 0")
 	}
+	if filter.OnlyDirs {
+		where.add("f.is_dir = 1")
+	}
+	if filter.OnlyLinks {
+		where.add("f.link_target IS NOT NULL")
+	}
+	if filter.Owner != "" {
+		addOwnerCondition(where, "f.owner_name", "f.uid", filter.Owner)
+	}
+	if filter.Group != "" {
+		addOwnerCondition(where, "f.group_name", "f.gid", filter.Group)
+	}
+	if filter.InDir != "" {
+		where.add("f.parent_id IN ("+subtreeDirs+")", filter.InDir)
+	}
+}
 
-	return strings.Join(ftsQuery, " ")
+// addOwnerCondition matches a user or group given either by name or by
+// numeric id. Names can be all digits too, so a number matches both.
+func addOwnerCondition(where *sqlWhere, nameCol, idCol, value string) {
+	if id, err := strconv.ParseInt(value, 10, 64); err == nil {
+		where.add("("+idCol+" = ? OR "+nameCol+" = ?)", id, value)
+		return
+	}
+	where.add(nameCol+" = ?", value)
 }
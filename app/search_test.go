@@ -1,8 +1,11 @@
 package app
 
 import (
+	"database/sql"
 	"testing"
 	"time"
+
+	"github.com/ogefest/findex/models"
 )
 
 func TestSearch_BasicQuery(t *testing.T) {
@@ -484,42 +487,67 @@ func TestGetFileByID(t *testing.T) {
 	})
 }
 
-func TestPrepareFTSQuery(t *testing.T) {
+// createOwnedFiles inserts files owned by alice (1000), bob (1001) and an
+// unnamed uid 2000
+func createOwnedFiles(t *testing.T, db *sql.DB, indexName string) {
+	t.Helper()
+
+	now := time.Now()
+	files := []models.FileRecord{
+		{Path: "/p/alice1.dat", Name: "alice1.dat", Ext: ".dat", Size: 100, Inode: 1, UID: 1000, GID: 100, Owner: "alice", Group: "staff"},
+		{Path: "/p/alice2.dat", Name: "alice2.dat", Ext: ".dat", Size: 200, Inode: 2, UID: 1000, GID: 100, Owner: "alice", Group: "staff"},
+		{Path: "/p/bob.dat", Name: "bob.dat", Ext: ".dat", Size: 5000, Inode: 3, UID: 1001, GID: 100, Owner: "bob", Group: "staff"},
+		{Path: "/p/orphan.dat", Name: "orphan.dat", Ext: ".dat", Size: 50, Inode: 4, UID: 2000, GID: 2000},
+	}
+	for _, f := range files {
+		f.IndexName = indexName
+		f.ModTime = now
+		insertTestFile(t, db, f)
+	}
+}
+
+func TestSearch_FilterByOwner(t *testing.T) {
+	db, dbPath, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	createOwnedFiles(t, db, "test-index")
+	// A service account whose name is all digits
+	insertTestFile(t, db, models.FileRecord{IndexName: "test-index", Path: "/p/svc.dat", Name: "svc.dat", Ext: ".dat",
+		Size: 10, ModTime: time.Now(), Inode: 5, UID: 3000, GID: 3000, Owner: "4242"})
+
+	searcher := createSearcher(t, dbPath, "test-index")
+	defer searcher.Close()
+
 	tests := []struct {
-		input    string
-		expected string
+		name     string
+		filter   *FileFilter
+		query    string
+		expected int
 	}{
-		{
-			input:    "hello world",
-			expected: "hello AND world",
-		},
-		{
-			input:    "hello -world",
-			expected: "hello NOT world",
-		},
-		{
-			input:    "foo bar -baz",
-			expected: "foo AND bar NOT baz",
-		},
-		{
-			input:    "-excluded",
-			expected: "NOT excluded",
-		},
-		{
-			input:    "single",
-			expected: "single",
-		},
-		{
-			input:    "  spaced   terms  ",
-			expected: "spaced AND terms",
-		},
+		{"owner by name", &FileFilter{Owner: "alice"}, "", 2},
+		{"owner named by digits", &FileFilter{Owner: "4242"}, "", 1},
+		{"owner by uid", &FileFilter{Owner: "1001"}, "", 1},
+		{"unnamed owner by uid", &FileFilter{Owner: "2000"}, "", 1},
+		{"group by name", &FileFilter{Group: "staff"}, "", 3},
+		{"owner and group", &FileFilter{Owner: "alice", Group: "staff"}, "", 2},
+		{"owner with query", &FileFilter{Owner: "alice"}, "alice2", 1},
+		{"unknown owner", &FileFilter{Owner: "mallory"}, "", 0},
+		{"owner with quote is not injected", &FileFilter{Owner: "x' OR '1'='1"}, "", 0},
 	}
 
 	for _, tt := range tests {
-		t.Run(tt.input, func(t *testing.T) {
-			result := prepareFTSQuery(tt.input)
-			if result != tt.expected {
-				t.Errorf("prepareFTSQuery(%q) = %q, expected %q", tt.input, result, tt.expected)
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := searcher.Search(tt.query, tt.filter, 100)
+			if err != nil {
+				t.Fatalf("search failed: %v", err)
+			}
+			if len(results) != tt.expected {
+				t.Errorf("expected %d results, got %d", tt.expected, len(results))
+			}
+			for _, r := range results {
+				if tt.filter.Owner == "alice" && r.Owner != "alice" {
+					t.Errorf("unexpected owner %q for %s", r.Owner, r.Name)
+				}
 			}
 		})
 	}
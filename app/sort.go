@@ -0,0 +1,215 @@
+package app
+
+import (
+	"cmp"
+	"container/heap"
+	"path/filepath"
+	"strings"
+
+	"github.com/ogefest/findex/models"
+)
+
+// Sort orders of FileFilter.Sort. Relevance, the default, ranks full-text
+// matches by bm25 with name matches above path matches, fuzzy matches by
+// edit distance and searches without terms newest first.
+const (
+	SortRelevance = "relevance"
+	SortName      = "name"
+	SortSize      = "size"
+	SortModified  = "modified"
+	SortPath      = "path"
+)
+
+// sortDefaultDesc are the sort orders that run descending unless asked
+// otherwise: largest and newest first
+var sortDefaultDesc = map[string]bool{SortSize: true, SortModified: true}
+
+// bm25 weights of the files_fts columns name, dir and link_target
+const (
+	ftsRankFiles      = "bm25(files_fts, 10.0, 1.0, 1.0)"
+	ftsRankTombstones = "bm25(tombstones_fts, 10.0, 1.0)"
+	ftsRankTrigram    = "bm25(files_trigram)"
+)
+
+// searchHit is a result with its relevance score, lower is better, and the
+// index and parent directory its position in a sort depends on
+type searchHit struct {
+	models.FileRecord
+	score float64
+	db    string
+	dir   string
+}
+
+func newHit(db string, f models.FileRecord, score float64) searchHit {
+	return searchHit{FileRecord: f, score: score, db: db, dir: filepath.Dir(f.Path)}
+}
+
+// scoredRow scans the score selected after the columns of a record
+type scoredRow struct {
+	rowScanner
+	score *float64
+}
+
+func (r scoredRow) Scan(dest ...any) error {
+	return r.rowScanner.Scan(append(dest, r.score)...)
+}
+
+// sortColumns are the columns of files or tombstones, aliased f, a sort
+// reads besides the name
+type sortColumns struct {
+	parent, size, modTime string
+}
+
+var (
+	fileSort = sortColumns{"d.path", "f.size", "f.mod_time"}
+	// Tombstones may lack a size or time, which scan as 0
+	tombstoneSort = sortColumns{"f.dir", "COALESCE(f.size, 0)", "COALESCE(f.mod_time, 0)"}
+)
+
+// resolveSort turns relevance into newest first for a query without terms,
+// where every score is equal, so an index on mod_time serves it
+func (q *Query) resolveSort() {
+	if q.Filter.Sort == "" && q.Match == "" {
+		q.Filter.Sort, q.Filter.SortDesc = SortModified, true
+	}
+}
+
+// sortKeys returns the expressions a search is ordered by before its ties
+// are broken, with their values at c. Relevance is the score, then newest
+// first.
+func sortKeys(filter *FileFilter, cols sortColumns, c *cursor) (keys []string, values []any) {
+	var at cursor
+	if c != nil {
+		at = *c
+	}
+	switch filter.Sort {
+	case SortName:
+		return []string{"f.name COLLATE NOCASE"}, []any{at.Name}
+	case SortSize:
+		return []string{cols.size}, []any{at.Size}
+	case SortModified:
+		return []string{cols.modTime}, []any{at.ModTime}
+	case SortPath:
+		return []string{cols.parent, "f.name"}, []any{at.Dir, at.Name}
+	}
+	return []string{"score", "-" + cols.modTime}, []any{at.Score, -at.ModTime}
+}
+
+// orderClause returns the ORDER BY of a search with the relevance selected
+// as score. Ties are broken by id, so it orders like hitLess and the
+// results of several indexes can be merged.
+func orderClause(filter *FileFilter, cols sortColumns) string {
+	dir := ""
+	if filter.SortDesc {
+		dir = " DESC"
+	}
+	keys, _ := sortKeys(filter, cols, nil)
+	terms := make([]string, 0, len(keys)+1)
+	for _, k := range append(keys, "f.id") {
+		terms = append(terms, k+dir)
+	}
+	return strings.Join(terms, ", ")
+}
+
+// hitLess orders hits by the sort of filter. Equal keys are ordered by
+// index, live before deleted and then id, so no two hits compare equal.
+func hitLess(filter *FileFilter) func(a, b *searchHit) bool {
+	var compare func(a, b *searchHit) int
+	switch filter.Sort {
+	case SortName:
+		compare = func(a, b *searchHit) int {
+			return strings.Compare(asciiLower(a.Name), asciiLower(b.Name))
+		}
+	case SortSize:
+		compare = func(a, b *searchHit) int { return cmp.Compare(a.Size, b.Size) }
+	case SortModified:
+		compare = func(a, b *searchHit) int { return cmp.Compare(a.ModTime.Unix(), b.ModTime.Unix()) }
+	case SortPath:
+		compare = func(a, b *searchHit) int {
+			if c := strings.Compare(a.dir, b.dir); c != 0 {
+				return c
+			}
+			return strings.Compare(a.Name, b.Name)
+		}
+	default:
+		compare = func(a, b *searchHit) int {
+			if c := cmp.Compare(a.score, b.score); c != 0 {
+				return c
+			}
+			return cmp.Compare(b.ModTime.Unix(), a.ModTime.Unix())
+		}
+	}
+	desc := filter.SortDesc
+	return func(a, b *searchHit) bool {
+		c := compare(a, b)
+		if c == 0 {
+			c = compareTable(a.db, a.Deleted, b.db, b.Deleted)
+		}
+		if c == 0 {
+			c = cmp.Compare(a.ID, b.ID)
+		}
+		if desc {
+			return c > 0
+		}
+		return c < 0
+	}
+}
+
+// compareTable orders the tables of the indexes searched together, files
+// before tombstones
+func compareTable(db string, deleted bool, otherDB string, otherDeleted bool) int {
+	if c := strings.Compare(db, otherDB); c != 0 {
+		return c
+	}
+	switch {
+	case deleted == otherDeleted:
+		return 0
+	case otherDeleted:
+		return -1
+	}
+	return 1
+}
+
+// hitHeap holds the next hit of every list being merged
+type hitHeap struct {
+	lists [][]searchHit
+	less  func(a, b *searchHit) bool
+}
+
+func (h *hitHeap) Len() int { return len(h.lists) }
+func (h *hitHeap) Less(i, j int) bool {
+	return h.less(&h.lists[i][0], &h.lists[j][0])
+}
+func (h *hitHeap) Swap(i, j int) { h.lists[i], h.lists[j] = h.lists[j], h.lists[i] }
+func (h *hitHeap) Push(x any)    { h.lists = append(h.lists, x.([]searchHit)) }
+func (h *hitHeap) Pop() any {
+	last := h.lists[len(h.lists)-1]
+	h.lists = h.lists[:len(h.lists)-1]
+	return last
+}
+
+// mergeHits merges lists, each ordered by less, into one ordered list
+func mergeHits(lists [][]searchHit, less func(a, b *searchHit) bool) []searchHit {
+	h := &hitHeap{less: less}
+	total := 0
+	for _, l := range lists {
+		if len(l) > 0 {
+			h.lists = append(h.lists, l)
+			total += len(l)
+		}
+	}
+	heap.Init(h)
+
+	result := make([]searchHit, 0, total)
+	for h.Len() > 0 {
+		head := h.lists[0]
+		result = append(result, head[0])
+		if len(head) > 1 {
+			h.lists[0] = head[1:]
+			heap.Fix(h, 0)
+		} else {
+			heap.Pop(h)
+		}
+	}
+	return result
+}
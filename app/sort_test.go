@@ -0,0 +1,143 @@
+package app
+
+import (
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ogefest/findex/models"
+)
+
+func TestParseFilter_Sort(t *testing.T) {
+	tests := []struct {
+		query string
+		sort  string
+		desc  bool
+	}{
+		{"", "", false},
+		{"sort=name", SortName, false},
+		{"sort=name&order=desc", SortName, true},
+		{"sort=size", SortSize, true},
+		{"sort=size&order=asc", SortSize, false},
+		{"sort=modified", SortModified, true},
+		{"sort=path", SortPath, false},
+		{"sort=random", "", false},
+	}
+	for _, tt := range tests {
+		values, _ := url.ParseQuery(tt.query)
+		filter := ParseFilter(values)
+		if filter.Sort != tt.sort || filter.SortDesc != tt.desc {
+			t.Errorf("ParseFilter(%q) = sort %q desc %v, expected %q and %v", tt.query, filter.Sort, filter.SortDesc, tt.sort, tt.desc)
+		}
+	}
+}
+
+func TestMergeHits(t *testing.T) {
+	hits := func(scores ...float64) []searchHit {
+		var list []searchHit
+		for _, s := range scores {
+			list = append(list, searchHit{score: s})
+		}
+		return list
+	}
+	merged := mergeHits([][]searchHit{hits(-9, -3, -1), nil, hits(-7, -5), hits(-2)}, hitLess(&FileFilter{}))
+
+	var scores []float64
+	for _, h := range merged {
+		scores = append(scores, h.score)
+	}
+	expected := []float64{-9, -7, -5, -3, -2, -1}
+	if !reflect.DeepEqual(scores, expected) {
+		t.Errorf("mergeHits = %v, expected %v", scores, expected)
+	}
+}
+
+// Two indexes searched together come back in one order, not one index after
+// the other
+func TestSearch_SortAcrossIndexes(t *testing.T) {
+	now := time.Now()
+	var configs []*models.IndexConfig
+	for i, files := range [][]models.FileRecord{
+		{
+			{Path: "music/b-side.mp3", Name: "b-side.mp3", Ext: ".mp3", Size: 300, ModTime: now.Add(-3 * time.Hour)},
+			{Path: "archive/Demo.mp3", Name: "Demo.mp3", Ext: ".mp3", Size: 100, ModTime: now.Add(-1 * time.Hour)},
+		},
+		{
+			{Path: "music/a-side.mp3", Name: "a-side.mp3", Ext: ".mp3", Size: 200, ModTime: now.Add(-2 * time.Hour)},
+			{Path: "music/c-side.mp3", Name: "c-side.mp3", Ext: ".mp3", Size: 400, ModTime: now.Add(-4 * time.Hour)},
+		},
+	} {
+		db, dbPath, cleanup := setupTestDB(t)
+		defer cleanup()
+		name := []string{"first", "second"}[i]
+		for _, f := range files {
+			f.IndexName = name
+			insertTestFile(t, db, f)
+		}
+		configs = append(configs, &models.IndexConfig{Name: name, DBPath: dbPath})
+	}
+	searcher, err := NewSearcher(configs)
+	if err != nil {
+		t.Fatalf("NewSearcher failed: %v", err)
+	}
+	defer searcher.Close()
+
+	tests := []struct {
+		sort     string
+		desc     bool
+		expected []string
+	}{
+		{SortRelevance, false, []string{"Demo.mp3", "a-side.mp3", "b-side.mp3", "c-side.mp3"}},
+		{SortName, false, []string{"a-side.mp3", "b-side.mp3", "c-side.mp3", "Demo.mp3"}},
+		{SortName, true, []string{"Demo.mp3", "c-side.mp3", "b-side.mp3", "a-side.mp3"}},
+		{SortSize, true, []string{"c-side.mp3", "b-side.mp3", "a-side.mp3", "Demo.mp3"}},
+		{SortSize, false, []string{"Demo.mp3", "a-side.mp3", "b-side.mp3", "c-side.mp3"}},
+		{SortModified, false, []string{"c-side.mp3", "b-side.mp3", "a-side.mp3", "Demo.mp3"}},
+		{SortPath, false, []string{"Demo.mp3", "a-side.mp3", "b-side.mp3", "c-side.mp3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.sort, func(t *testing.T) {
+			results, err := searcher.Search("", &FileFilter{Exts: []string{".mp3"}, Sort: tt.sort, SortDesc: tt.desc}, 100)
+			if err != nil {
+				t.Fatalf("Search failed: %v", err)
+			}
+			var names []string
+			for _, f := range results {
+				names = append(names, filepath.Base(f.Path))
+			}
+			if !reflect.DeepEqual(names, tt.expected) {
+				t.Errorf("sort %s desc %v = %v, expected %v", tt.sort, tt.desc, names, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSearch_RelevanceRanksNamesOverPaths(t *testing.T) {
+	db, dbPath, cleanup := setupTestDB(t)
+	defer cleanup()
+	// The path match is newer, so only the rank puts the name match first
+	insertTestFile(t, db, models.FileRecord{
+		IndexName: "test-index", Path: "budget/notes.txt", Name: "notes.txt", Ext: ".txt", ModTime: time.Now(),
+	})
+	insertTestFile(t, db, models.FileRecord{
+		IndexName: "test-index", Path: "finance/budget.xlsx", Name: "budget.xlsx", Ext: ".xlsx", ModTime: time.Now().AddDate(-1, 0, 0),
+	})
+
+	searcher := createSearcher(t, dbPath, "test-index")
+	defer searcher.Close()
+
+	results, err := searcher.Search("budget", &FileFilter{}, 100)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	var names []string
+	for _, f := range results {
+		names = append(names, f.Name)
+	}
+	expected := []string{"budget.xlsx", "notes.txt"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("Search(budget) = %v, expected %v", names, expected)
+	}
+}
@@ -2,7 +2,6 @@ package app
 
 import (
 	"archive/zip"
-	"hash/crc32"
 	"log"
 	"os"
 	"path/filepath"
@@ -19,11 +18,80 @@ type LocalSource struct {
 	IndexName       string
 	RootPaths       []string
 	ExcludePaths    []string
+	ExcludePatterns []string               // gitignore-style patterns relative to each root
+	ExcludeRegex    []string               // regular expressions matched against absolute paths
+	RootOptions     map[string]RootOptions // keyed by cleaned root path, see ResolveRoots
+	FollowSymlinks  bool                   // descend into symlinked directories (with loop detection)
+	OneFileSystem   bool                   // do not cross mount points below a root
 	NumWorkers      int
 	ScanZipContents bool
 	scanLogger      *ScanLogger
 }
 
+// dirJob is a directory waiting to be read together with the exclusion
+// rules in effect for it (index rules plus inherited .findexignore files)
+type dirJob struct {
+	path  string
+	depth int // 0 for the root itself
+	rules *excludeRules
+}
+
+// rootWalk carries the per-root settings shared by all workers of a walk
+type rootWalk struct {
+	root    string
+	opts    RootOptions
+	include *excludeRules // nil when every file is accepted
+
+	rootDev    uint64
+	hasRootDev bool
+	visited    sync.Map // directories already read, keyed by fileID or resolved path
+
+	owners *ownerNames // shared by all roots of a walk
+}
+
+// markVisited records dir as read and reports false when the same directory
+// was already reached through another path (a symlink loop or duplicate).
+func (rw *rootWalk) markVisited(dir string) bool {
+	info, err := os.Stat(dir)
+	if err != nil {
+		// Let the caller fail on open and report the error
+		return true
+	}
+	var key any
+	if id, ok := statFileID(info); ok {
+		key = id
+	} else if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+		key = resolved
+	} else {
+		return true
+	}
+	_, loaded := rw.visited.LoadOrStore(key, dir)
+	return !loaded
+}
+
+// crossesMount reports whether info lives on a different device than the root
+func (rw *rootWalk) crossesMount(info os.FileInfo) bool {
+	if !rw.hasRootDev {
+		return false
+	}
+	id, ok := statFileID(info)
+	return ok && id.dev != rw.rootDev
+}
+
+// skipFile returns why a file must not be indexed, or "" to keep it
+func (rw *rootWalk) skipFile(path string, size int64) skipReason {
+	if rw.include != nil && rw.include.match(path, false) == nil {
+		return skipInclude
+	}
+	if rw.opts.MinFileSize > 0 && size < rw.opts.MinFileSize {
+		return skipSize
+	}
+	if rw.opts.MaxFileSize > 0 && size > rw.opts.MaxFileSize {
+		return skipSize
+	}
+	return ""
+}
+
 func NewLocalSource(indexName string, rootPaths []string, excludePaths []string, numWorkers int, scanZipContents bool, scanLogger *ScanLogger) *LocalSource {
 	if numWorkers <= 0 {
 		numWorkers = runtime.NumCPU() * 2
@@ -38,11 +106,10 @@ func NewLocalSource(indexName string, rootPaths []string, excludePaths []string,
 	}
 }
 
-func (l *LocalSource) getDirDeep(path string) uint32 {
-	dir := filepath.Dir(path)
-	normalized := filepath.Clean(dir)
-	result := crc32.ChecksumIEEE([]byte(normalized))
-	return result
+func (l *LocalSource) countSkipped(reason skipReason) {
+	if l.scanLogger != nil {
+		l.scanLogger.IncrementSkipped(reason)
+	}
 }
 
 func (l *LocalSource) Name() string {
@@ -55,6 +122,8 @@ func (l *LocalSource) Walk() <-chan models.FileRecord {
 	go func() {
 		defer close(filesCh)
 
+		owners := newOwnerNames()
+
 		// Process roots sequentially to avoid deadlock with shared channel
 		for i, root := range l.RootPaths {
 			cleanRoot := filepath.Clean(root)
@@ -69,8 +138,38 @@ func (l *LocalSource) Walk() <-chan models.FileRecord {
 				filesBefore, dirsBefore, _, _ = l.scanLogger.GetStats()
 			}
 
+			rules, err := newExcludeRules(cleanRoot, l.ExcludePaths, l.ExcludePatterns, l.ExcludeRegex)
+			if err != nil {
+				if l.scanLogger != nil {
+					l.scanLogger.LogError("exclude_rules", cleanRoot, err)
+				}
+				log.Printf("Skipping root %s: %v", cleanRoot, err)
+				continue
+			}
+
+			rw := &rootWalk{root: cleanRoot, opts: l.RootOptions[cleanRoot], owners: owners}
+			if len(rw.opts.IncludePatterns) > 0 {
+				include, err := newPatternRules(cleanRoot, "include_patterns", rw.opts.IncludePatterns)
+				if err != nil {
+					if l.scanLogger != nil {
+						l.scanLogger.LogError("include_rules", cleanRoot, err)
+					}
+					log.Printf("Skipping root %s: %v", cleanRoot, err)
+					continue
+				}
+				rw.include = include
+			}
+			if l.OneFileSystem {
+				if info, err := os.Stat(cleanRoot); err == nil {
+					if id, ok := statFileID(info); ok {
+						rw.rootDev = id.dev
+						rw.hasRootDev = true
+					}
+				}
+			}
+
 			start := time.Now()
-			l.walkRootParallel(cleanRoot, filesCh)
+			l.walkRootParallel(rw, rules, filesCh)
 			duration := time.Since(start)
 
 			if l.scanLogger != nil {
@@ -84,13 +183,13 @@ func (l *LocalSource) Walk() <-chan models.FileRecord {
 	return filesCh
 }
 
-func (l *LocalSource) walkRootParallel(root string, filesCh chan<- models.FileRecord) {
-	dirQueue := make(chan string, 100000)
+func (l *LocalSource) walkRootParallel(rw *rootWalk, rules *excludeRules, filesCh chan<- models.FileRecord) {
+	dirQueue := make(chan dirJob, 100000)
 	var wg sync.WaitGroup
 	var activeWorkers int32
 
 	// Initialize - add root to queue
-	dirQueue <- root
+	dirQueue <- dirJob{path: rw.root, rules: rules}
 	atomic.AddInt32(&activeWorkers, 1)
 
 	// Start workers
@@ -98,7 +197,7 @@ func (l *LocalSource) walkRootParallel(root string, filesCh chan<- models.FileRe
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			l.dirWorker(root, dirQueue, filesCh, &activeWorkers)
+			l.dirWorker(rw, dirQueue, filesCh, &activeWorkers)
 		}()
 	}
 
@@ -106,13 +205,13 @@ func (l *LocalSource) walkRootParallel(root string, filesCh chan<- models.FileRe
 }
 
 func (l *LocalSource) dirWorker(
-	root string,
-	dirQueue chan string,
+	rw *rootWalk,
+	dirQueue chan dirJob,
 	filesCh chan<- models.FileRecord,
 	activeWorkers *int32,
 ) {
-	for dir := range dirQueue {
-		l.processDirectory(root, dir, dirQueue, filesCh, activeWorkers)
+	for job := range dirQueue {
+		l.processDirectory(rw, job, dirQueue, filesCh, activeWorkers)
 
 		// Decrease active counter
 		if atomic.AddInt32(activeWorkers, -1) == 0 {
@@ -124,25 +223,30 @@ func (l *LocalSource) dirWorker(
 }
 
 func (l *LocalSource) processDirectory(
-	root, dir string,
-	dirQueue chan string,
+	rw *rootWalk,
+	job dirJob,
+	dirQueue chan dirJob,
 	filesCh chan<- models.FileRecord,
 	activeWorkers *int32,
 ) {
+	dir := job.path
+	rules := job.rules
+
 	// Check exclude for directory
-	for _, exclude := range l.ExcludePaths {
-		if matched, _ := filepath.Match(exclude, dir); matched {
-			if l.scanLogger != nil {
-				l.scanLogger.LogExcludedDir(dir, exclude)
-			}
-			return
+	if rule := rules.match(dir, true); rule != nil {
+		if l.scanLogger != nil {
+			l.scanLogger.LogExcludedDir(dir, rule.String())
 		}
-		if strings.HasPrefix(dir, exclude) {
-			if l.scanLogger != nil {
-				l.scanLogger.LogExcludedDir(dir, exclude)
-			}
-			return
+		return
+	}
+
+	// Followed symlinks may lead back to a directory that was already read
+	if l.FollowSymlinks && !rw.markVisited(dir) {
+		if l.scanLogger != nil {
+			l.scanLogger.LogSymlinkLoop(dir)
 		}
+		log.Printf("Skipping already visited directory %s (symlink loop)", dir)
+		return
 	}
 
 	// Open directory and read without sorting
@@ -165,63 +269,110 @@ func (l *LocalSource) processDirectory(
 		return
 	}
 
+	// Rules from an ignore file apply to this directory's entries and below
+	for _, entry := range entries {
+		if entry.Name() == IgnoreFileName && entry.Type().IsRegular() {
+			ignorePath := filepath.Join(dir, entry.Name())
+			extended, err := rules.withIgnoreFile(dir, ignorePath)
+			if err != nil {
+				if l.scanLogger != nil {
+					l.scanLogger.LogError("read_ignore_file", ignorePath, err)
+				}
+				log.Printf("Error reading %s: %v", ignorePath, err)
+			}
+			rules = extended
+			break
+		}
+	}
+
 	// Counters for directory summary
 	var filesInDir, dirsInDir, excludedInDir int
 
+	// Depth of the entries read from this directory
+	depth := job.depth + 1
+
 	for _, entry := range entries {
 		path := filepath.Join(dir, entry.Name())
-
-		// Check exclude for file/subdirectory
-		excluded := false
-		var matchedPattern string
-		for _, exclude := range l.ExcludePaths {
-			if matched, _ := filepath.Match(exclude, path); matched {
-				excluded = true
-				matchedPattern = exclude
-				break
-			}
-			if strings.HasPrefix(path, exclude) {
-				excluded = true
-				matchedPattern = exclude
-				break
+		isDir := entry.IsDir()
+
+		// Symlinks are recorded with their target; when following them the
+		// entry takes the type, size and times of what it points to
+		var linkTarget string
+		var targetInfo os.FileInfo
+		if entry.Type()&os.ModeSymlink != 0 {
+			linkTarget, _ = os.Readlink(path)
+			if l.FollowSymlinks {
+				if ti, err := os.Stat(path); err == nil {
+					targetInfo = ti
+					isDir = ti.IsDir()
+				} else if l.scanLogger != nil {
+					l.scanLogger.Log("BROKEN SYMLINK: %s -> %s", path, linkTarget)
+				}
 			}
 		}
-		if excluded {
+
+		// Check exclude for file/subdirectory
+		if rule := rules.match(path, isDir); rule != nil {
 			excludedInDir++
 			if l.scanLogger != nil {
-				if entry.IsDir() {
-					l.scanLogger.LogExcludedDir(path, matchedPattern)
+				if isDir {
+					l.scanLogger.LogExcludedDir(path, rule.String())
 				} else {
-					l.scanLogger.LogExcludedFile(path, matchedPattern)
+					l.scanLogger.LogExcludedFile(path, rule.String())
 				}
 			}
 			continue
 		}
 
-		if entry.IsDir() {
-			// Add subdirectory to queue (non-blocking to avoid deadlock)
-			atomic.AddInt32(activeWorkers, 1)
-			select {
-			case dirQueue <- path:
-				// Successfully queued
-			default:
-				// Queue full - process synchronously to avoid deadlock
-				atomic.AddInt32(activeWorkers, -1)
-				l.processDirectory(root, path, dirQueue, filesCh, activeWorkers)
+		if rw.opts.SkipHidden && strings.HasPrefix(entry.Name(), ".") {
+			l.countSkipped(skipHidden)
+			continue
+		}
+
+		info := targetInfo
+		if info == nil {
+			var err error
+			info, err = entry.Info()
+			if err != nil {
+				if l.scanLogger != nil {
+					l.scanLogger.LogError("file_info", path, err)
+				}
+				continue
 			}
 		}
 
-		// Send file/directory to channel
-		info, err := entry.Info()
-		if err != nil {
-			if l.scanLogger != nil {
-				l.scanLogger.LogError("file_info", path, err)
+		if isDir {
+			if rw.opts.MaxDepth > 0 && depth >= rw.opts.MaxDepth {
+				// Record the directory but do not descend into it
+				l.countSkipped(skipDepth)
+			} else if l.OneFileSystem && rw.crossesMount(info) {
+				if l.scanLogger != nil {
+					l.scanLogger.LogMountBoundary(path)
+				}
+			} else {
+				// Add subdirectory to queue (non-blocking to avoid deadlock)
+				sub := dirJob{path: path, depth: depth, rules: rules}
+				atomic.AddInt32(activeWorkers, 1)
+				select {
+				case dirQueue <- sub:
+					// Successfully queued
+				default:
+					// Queue full - process synchronously to avoid deadlock
+					atomic.AddInt32(activeWorkers, -1)
+					l.processDirectory(rw, sub, dirQueue, filesCh, activeWorkers)
+				}
+			}
+		}
+
+		if !isDir {
+			if reason := rw.skipFile(path, info.Size()); reason != "" {
+				l.countSkipped(reason)
+				continue
 			}
-			continue
 		}
 
 		// Track statistics
-		if entry.IsDir() {
+		if isDir {
 			dirsInDir++
 			if l.scanLogger != nil {
 				l.scanLogger.IncrementDirs()
@@ -234,22 +385,34 @@ func (l *LocalSource) processDirectory(
 		}
 
 		// Use full absolute path for uniqueness across multiple root_paths
-		filesCh <- models.FileRecord{
-			Path:      path,
-			Name:      entry.Name(),
-			Dir:       root,
-			DirIndex:  int64(l.getDirDeep(path)),
-			Ext:       filepath.Ext(entry.Name()),
-			Size:      info.Size(),
-			ModTime:   info.ModTime(),
-			IsDir:     entry.IsDir(),
-			IndexName: l.IndexName,
+		rec := models.FileRecord{
+			Path:       path,
+			Name:       entry.Name(),
+			Dir:        rw.root,
+			Ext:        filepath.Ext(entry.Name()),
+			Size:       info.Size(),
+			ModTime:    info.ModTime(),
+			IsDir:      isDir,
+			IndexName:  l.IndexName,
+			LinkTarget: linkTarget,
+			Mode:       unixMode(info.Mode()),
 		}
+		if st, ok := statFile(info); ok {
+			rec.Device = int64(st.id.dev)
+			rec.Inode = int64(st.id.ino)
+			rec.Links = st.nlink
+			rec.DiskSize = st.allocated
+			rec.UID = int64(st.uid)
+			rec.GID = int64(st.gid)
+			rec.Owner = rw.owners.user(st.uid)
+			rec.Group = rw.owners.group(st.gid)
+		}
+		filesCh <- rec
 
 		// Scan inside zip files if enabled
-		if l.ScanZipContents && !entry.IsDir() && strings.ToLower(filepath.Ext(entry.Name())) == ".zip" {
+		if l.ScanZipContents && !isDir && strings.ToLower(filepath.Ext(entry.Name())) == ".zip" {
 			log.Printf("Scanning zip contents: %s", path)
-			l.scanZipContents(path, root, filesCh)
+			l.scanZipContents(path, rw, filesCh)
 		}
 	}
 
@@ -259,7 +422,8 @@ func (l *LocalSource) processDirectory(
 	}
 }
 
-func (l *LocalSource) scanZipContents(zipPath, root string, filesCh chan<- models.FileRecord) {
+func (l *LocalSource) scanZipContents(zipPath string, rw *rootWalk, filesCh chan<- models.FileRecord) {
+	root := rw.root
 	reader, err := zip.OpenReader(zipPath)
 	if err != nil {
 		if l.scanLogger != nil {
@@ -285,7 +449,6 @@ func (l *LocalSource) scanZipContents(zipPath, root string, filesCh chan<- model
 		Path:      zipRootPath,
 		Name:      filepath.Base(zipPath) + "!",
 		Dir:       root,
-		DirIndex:  int64(l.getDirDeep(zipRootPath)),
 		Ext:       "",
 		Size:      0,
 		ModTime:   time.Time{},
@@ -318,7 +481,6 @@ func (l *LocalSource) scanZipContents(zipPath, root string, filesCh chan<- model
 				Path:      fullPath,
 				Name:      part,
 				Dir:       root,
-				DirIndex:  int64(l.getDirDeep(fullPath)),
 				Ext:       "",
 				Size:      0,
 				ModTime:   time.Time{},
@@ -353,7 +515,6 @@ func (l *LocalSource) scanZipContents(zipPath, root string, filesCh chan<- model
 					Path:      innerPath,
 					Name:      name,
 					Dir:       root,
-					DirIndex:  int64(l.getDirDeep(innerPath)),
 					Ext:       "",
 					Size:      0,
 					ModTime:   file.Modified,
@@ -364,11 +525,15 @@ func (l *LocalSource) scanZipContents(zipPath, root string, filesCh chan<- model
 			continue
 		}
 
+		if reason := rw.skipFile(innerPath, int64(file.UncompressedSize64)); reason != "" {
+			l.countSkipped(reason)
+			continue
+		}
+
 		filesCh <- models.FileRecord{
 			Path:      innerPath,
 			Name:      name,
 			Dir:       root,
-			DirIndex:  int64(l.getDirDeep(innerPath)),
 			Ext:       filepath.Ext(name),
 			Size:      int64(file.UncompressedSize64),
 			ModTime:   file.Modified,
@@ -0,0 +1,49 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+)
+
+// sqlWhere collects the conditions of a WHERE clause and their bound
+// arguments. Conditions are fixed SQL written in this package; every value,
+// and above all every value from a request, goes through a ? placeholder and
+// never into the SQL text.
+type sqlWhere struct {
+	conds []string
+	args  []any
+}
+
+// add appends a condition with one argument per placeholder. A mismatch is a
+// programming error and panics, a condition can never silently take a value
+// into its text.
+func (w *sqlWhere) add(cond string, args ...any) {
+	if n := strings.Count(cond, "?"); n != len(args) {
+		panic(fmt.Sprintf("sqlWhere: %q has %d placeholders for %d args", cond, n, len(args)))
+	}
+	w.conds = append(w.conds, cond)
+	w.args = append(w.args, args...)
+}
+
+// in appends "column IN (?, ...)" with one placeholder per value, nothing
+// when values is empty
+func (w *sqlWhere) in(column string, values ...any) {
+	if len(values) == 0 {
+		return
+	}
+	w.add(column+" IN ("+strings.TrimSuffix(strings.Repeat("?, ", len(values)), ", ")+")", values...)
+}
+
+func (w *sqlWhere) empty() bool {
+	return len(w.conds) == 0
+}
+
+// String returns the conditions joined with AND
+func (w *sqlWhere) String() string {
+	return strings.Join(w.conds, " AND ")
+}
+
+// Args returns the arguments in placeholder order
+func (w *sqlWhere) Args() []any {
+	return w.args
+}
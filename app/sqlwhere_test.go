@@ -0,0 +1,180 @@
+package app
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestSQLWhere(t *testing.T) {
+	where := &sqlWhere{}
+	if !where.empty() {
+		t.Error("expected a new builder to be empty")
+	}
+	where.add("f.size >= ?", int64(10))
+	where.in("f.ext")
+	where.in("f.ext", ".pdf", ".txt")
+	where.add("f.is_dir = 0")
+
+	expected := "f.size >= ? AND f.ext IN (?, ?) AND f.is_dir = 0"
+	if where.String() != expected {
+		t.Errorf("String() = %q, expected %q", where.String(), expected)
+	}
+	if !reflect.DeepEqual(where.Args(), []any{int64(10), ".pdf", ".txt"}) {
+		t.Errorf("unexpected args %v", where.Args())
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic for a placeholder without an argument")
+		}
+	}()
+	where.add("f.name = ?")
+}
+
+// Every field of FileFilter has to narrow the result, a field added without
+// a condition fails here
+func TestFilterConditions_CoversEveryField(t *testing.T) {
+	// Fields that select what is searched or its order instead of adding a
+	// condition
+	skip := map[string]bool{"IncludeDeleted": true, "MatchMode": true, "Sort": true, "SortDesc": true}
+
+	typ := reflect.TypeOf(FileFilter{})
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if skip[field.Name] {
+			continue
+		}
+		var filter FileFilter
+		v := reflect.ValueOf(&filter).Elem().Field(i)
+		switch v.Kind() {
+		case reflect.Int64:
+			v.SetInt(1)
+		case reflect.Bool:
+			v.SetBool(true)
+		case reflect.String:
+			v.SetString("x")
+		case reflect.Slice:
+			v.Set(reflect.ValueOf([]string{"x"}))
+		default:
+			t.Fatalf("field %s has unhandled kind %s", field.Name, v.Kind())
+		}
+
+		where := &sqlWhere{}
+		filterConditions(where, &filter)
+		if where.empty() {
+			t.Errorf("FileFilter.%s adds no condition", field.Name)
+		}
+	}
+}
+
+// filterFromFuzz builds a filter that puts s into every text field
+func filterFromFuzz(s string, n int64) *FileFilter {
+	return &FileFilter{
+		MinSize:     n,
+		MaxSize:     n,
+		Exts:        strings.Split(s, ","),
+		ModTimeFrom: n,
+		ModTimeTo:   n,
+		OnlyFiles:   true,
+		Owner:       s,
+		Group:       s,
+		InDir:       s,
+	}
+}
+
+func FuzzFilterConditions(f *testing.F) {
+	for _, seed := range []string{
+		"pdf",
+		"pdf' OR '1'='1",
+		"x'); DROP TABLE files; --",
+		"/mnt/media\" OR 1=1 --",
+		"?,?,?",
+		"0 UNION SELECT * FROM metadata",
+		"\x00'\n\\",
+	} {
+		f.Add(seed, int64(1))
+	}
+
+	db, _, cleanup := setupTestDB(f)
+	defer cleanup()
+	createTestFiles(f, db, "test-index")
+
+	var before int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM files`).Scan(&before); err != nil {
+		f.Fatalf("failed to count files: %v", err)
+	}
+
+	f.Fuzz(func(t *testing.T, s string, n int64) {
+		filter := filterFromFuzz(s, n)
+		where := &sqlWhere{}
+		filterConditions(where, filter)
+
+		// The SQL text must not depend on the values, only on their number
+		// and on whether an owner is a name or an id
+		plain := filterFromFuzz(strings.Repeat(",", len(filter.Exts)-1), n)
+		plain.InDir, plain.Owner, plain.Group = filter.InDir, filter.Owner, filter.Group
+		if s != "" {
+			plain.InDir = "x"
+			if _, err := strconv.ParseInt(s, 10, 64); err != nil {
+				plain.Owner, plain.Group = "x", "x"
+			} else {
+				plain.Owner, plain.Group = "1", "1"
+			}
+		}
+		plainWhere := &sqlWhere{}
+		filterConditions(plainWhere, plain)
+		if where.String() != plainWhere.String() {
+			t.Fatalf("values leaked into the SQL text: %q", where.String())
+		}
+		if strings.Count(where.String(), "?") != len(where.Args()) {
+			t.Fatalf("%d placeholders for %d args", strings.Count(where.String(), "?"), len(where.Args()))
+		}
+
+		sqlQuery, args, _ := searchStatement(&Query{Filter: *filter}, "", nil)
+		rows, err := db.Query(sqlQuery, args...)
+		if err != nil {
+			t.Fatalf("query failed for %q: %v", s, err)
+		}
+		rows.Close()
+
+		var after int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM files`).Scan(&after); err != nil || after != before {
+			t.Fatalf("files changed: %d -> %d (%v)", before, after, err)
+		}
+	})
+}
+
+// Whatever is typed into the search box either parses into a query SQLite
+// accepts or is rejected with a QueryError
+func FuzzSearch(f *testing.F) {
+	for _, seed := range []string{
+		"report",
+		`"unclosed`,
+		"a OR (b -c)",
+		"ext:pdf' OR 1=1 --",
+		`in:"/x' OR '1'='1"`,
+		"NEAR(a b) x^y {col}: *",
+		"size:>1MB modified:2024..",
+		"files_fts MATCH '*'",
+		"0\x00",
+	} {
+		f.Add(seed)
+	}
+
+	db, dbPath, cleanup := setupTestDB(f)
+	defer cleanup()
+	createTestFiles(f, db, "test-index")
+	searcher := createSearcher(f, dbPath, "test-index")
+	defer searcher.Close()
+
+	f.Fuzz(func(t *testing.T, query string) {
+		_, err := searcher.Search(query, &FileFilter{IncludeDeleted: true}, 10)
+		var qe *QueryError
+		if err != nil && !errors.As(err, &qe) {
+			t.Fatalf("Search(%q) failed: %v", query, err)
+		}
+	})
+}
@@ -3,6 +3,7 @@ package app
 import (
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"time"
 
 	"github.com/ogefest/findex/models"
@@ -50,8 +51,7 @@ func (s *Searcher) calculateIndexStats(indexName string) (*models.IndexStats, er
 	}
 
 	// Total size
-	err = db.QueryRow(`SELECT COALESCE(SUM(size), 0) FROM files WHERE is_dir = 0`).Scan(&stats.TotalSize)
-	if err != nil {
+	if err := loadSizeTotals(db, stats); err != nil {
 		return nil, err
 	}
 
@@ -81,21 +81,16 @@ func (s *Searcher) calculateIndexStats(indexName string) (*models.IndexStats, er
 
 	// Top 10 largest files
 	rows, err := db.Query(`
-		SELECT id, path, name, dir, ext, size, mod_time, is_dir, index_name
-		FROM files
-		WHERE is_dir = 0
-		ORDER BY size DESC
+		SELECT ` + fileColumns + `
+		FROM ` + fileTables + `
+		WHERE f.is_dir = 0
+		ORDER BY f.size DESC
 		LIMIT 10
 	`)
 	if err == nil {
 		defer rows.Close()
 		for rows.Next() {
-			var f models.FileRecord
-			var mod int64
-			var isDir int
-			if err := rows.Scan(&f.ID, &f.Path, &f.Name, &f.Dir, &f.Ext, &f.Size, &mod, &isDir, &f.IndexName); err == nil {
-				f.ModTime = time.Unix(mod, 0)
-				f.IsDir = isDir != 0
+			if f, err := scanFileRecord(rows); err == nil {
 				stats.LargestFiles = append(stats.LargestFiles, f)
 			}
 		}
@@ -195,23 +190,21 @@ func (s *Searcher) calculateIndexStats(indexName string) (*models.IndexStats, er
 		}
 	}
 
+	// Owners and groups
+	loadOwnerStats(db, stats)
+
 	// Recent files
 	rows, err = db.Query(`
-		SELECT id, path, name, dir, ext, size, mod_time, is_dir, index_name
-		FROM files
-		WHERE is_dir = 0
-		ORDER BY mod_time DESC
+		SELECT ` + fileColumns + `
+		FROM ` + fileTables + `
+		WHERE f.is_dir = 0
+		ORDER BY f.mod_time DESC
 		LIMIT 10
 	`)
 	if err == nil {
 		defer rows.Close()
 		for rows.Next() {
-			var f models.FileRecord
-			var mod int64
-			var isDir int
-			if err := rows.Scan(&f.ID, &f.Path, &f.Name, &f.Dir, &f.Ext, &f.Size, &mod, &isDir, &f.IndexName); err == nil {
-				f.ModTime = time.Unix(mod, 0)
-				f.IsDir = isDir != 0
+			if f, err := scanFileRecord(rows); err == nil {
 				stats.RecentFiles = append(stats.RecentFiles, f)
 			}
 		}
@@ -220,6 +213,88 @@ func (s *Searcher) calculateIndexStats(indexName string) (*models.IndexStats, er
 	return stats, nil
 }
 
+// loadSizeTotals fills the apparent, unique and allocated totals of stats
+func loadSizeTotals(db *sql.DB, stats *models.IndexStats) error {
+	t, err := querySizeTotals(db, "")
+	if err != nil {
+		return err
+	}
+	stats.TotalSize = t.Apparent
+	stats.UniqueSize = t.Unique
+	stats.DiskUsage = t.Allocated
+
+	return db.QueryRow(`SELECT COUNT(*) FROM files WHERE is_dir = 0 AND nlink > 1`).Scan(&stats.HardlinkedFiles)
+}
+
+// queryOwnerStats returns the limit users (idCol "uid") or groups (idCol
+// "gid") owning the most data, all of them for limit 0
+func queryOwnerStats(db *sql.DB, idCol, nameCol string, limit int) []models.OwnerStats {
+	query := fmt.Sprintf(`
+		SELECT %[1]s, COALESCE(MAX(%[2]s), ''), COUNT(*), COALESCE(SUM(size), 0) as total_size
+		FROM files
+		WHERE is_dir = 0 AND %[1]s IS NOT NULL
+		GROUP BY %[1]s
+		ORDER BY total_size DESC
+	`, idCol, nameCol)
+	if limit > 0 {
+		query += fmt.Sprintf(`LIMIT %d`, limit)
+	}
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	var result []models.OwnerStats
+	for rows.Next() {
+		var o models.OwnerStats
+		if err := rows.Scan(&o.ID, &o.Name, &o.Count, &o.Size); err == nil {
+			result = append(result, o)
+		}
+	}
+	return result
+}
+
+// loadOwnerStats fills the per-owner and per-group breakdowns of stats
+func loadOwnerStats(db *sql.DB, stats *models.IndexStats) {
+	stats.TopOwners = queryOwnerStats(db, "uid", "owner_name", 15)
+	stats.TopGroups = queryOwnerStats(db, "gid", "group_name", 15)
+}
+
+// ownerKey identifies a user or group across indexes. The same id can stand
+// for different accounts on different hosts, so the name is part of it.
+type ownerKey struct {
+	id   int64
+	name string
+}
+
+// mergeOwnerStats adds the entries of src into the map keyed by id and name
+func mergeOwnerStats(dst map[ownerKey]*models.OwnerStats, src []models.OwnerStats) {
+	for _, o := range src {
+		key := ownerKey{o.ID, o.Name}
+		if existing, ok := dst[key]; ok {
+			existing.Count += o.Count
+			existing.Size += o.Size
+		} else {
+			entry := o
+			dst[key] = &entry
+		}
+	}
+}
+
+// topOwnerStats returns the largest limit entries of m by size
+func topOwnerStats(m map[ownerKey]*models.OwnerStats, limit int) []models.OwnerStats {
+	var result []models.OwnerStats
+	for _, o := range m {
+		result = append(result, *o)
+	}
+	sortOwnerStatsBySize(result)
+	if len(result) > limit {
+		result = result[:limit]
+	}
+	return result
+}
+
 func (s *Searcher) GetGlobalStats() (*models.GlobalStats, error) {
 	global := &models.GlobalStats{
 		IndexCount: len(s.dbs),
@@ -229,6 +304,8 @@ func (s *Searcher) GetGlobalStats() (*models.GlobalStats, error) {
 	extMapBySize := make(map[string]*models.ExtensionStats)
 	sizeDistMap := make(map[string]*models.SizeRange)
 	yearDistMap := make(map[int]*models.YearStats)
+	ownerMap := make(map[ownerKey]*models.OwnerStats)
+	groupMap := make(map[ownerKey]*models.OwnerStats)
 
 	for indexName := range s.dbs {
 		indexStats, err := s.GetIndexStats(indexName)
@@ -240,6 +317,8 @@ func (s *Searcher) GetGlobalStats() (*models.GlobalStats, error) {
 		global.TotalFiles += indexStats.TotalFiles
 		global.TotalDirs += indexStats.TotalDirs
 		global.TotalSize += indexStats.TotalSize
+		global.UniqueSize += indexStats.UniqueSize
+		global.DiskUsage += indexStats.DiskUsage
 
 		// Aggregate extensions by count
 		for _, ext := range indexStats.TopExtensions {
@@ -283,6 +362,12 @@ func (s *Searcher) GetGlobalStats() (*models.GlobalStats, error) {
 			}
 		}
 
+		// The cached top entries of an index leave out smaller owners that
+		// may add up to more across indexes, so all of them are merged
+		db := s.dbs[indexName]
+		mergeOwnerStats(ownerMap, queryOwnerStats(db, "uid", "owner_name", 0))
+		mergeOwnerStats(groupMap, queryOwnerStats(db, "gid", "group_name", 0))
+
 		// Aggregate year distribution
 		for _, yd := range indexStats.YearDistribution {
 			if existing, ok := yearDistMap[yd.Year]; ok {
@@ -332,6 +417,10 @@ func (s *Searcher) GetGlobalStats() (*models.GlobalStats, error) {
 	}
 	sortYearStats(global.YearDistribution)
 
+	// Owners and groups by size
+	global.TopOwners = topOwnerStats(ownerMap, 15)
+	global.TopGroups = topOwnerStats(groupMap, 15)
+
 	return global, nil
 }
 
@@ -355,6 +444,16 @@ func sortExtensionsBySize(exts []models.ExtensionStats) {
 	}
 }
 
+func sortOwnerStatsBySize(owners []models.OwnerStats) {
+	for i := 0; i < len(owners); i++ {
+		for j := i + 1; j < len(owners); j++ {
+			if owners[j].Size > owners[i].Size {
+				owners[i], owners[j] = owners[j], owners[i]
+			}
+		}
+	}
+}
+
 func sortYearStats(years []models.YearStats) {
 	for i := 0; i < len(years); i++ {
 		for j := i + 1; j < len(years); j++ {
@@ -1,8 +1,11 @@
 package app
 
 import (
+	"fmt"
 	"testing"
 	"time"
+
+	"github.com/ogefest/findex/models"
 )
 
 func TestGetIndexStats_TotalCounts(t *testing.T) {
@@ -378,3 +381,107 @@ func TestSortYearStats(t *testing.T) {
 	// This is implicitly tested through TestGetIndexStats_YearDistribution
 	// which verifies the order of years
 }
+
+func TestGetIndexStats_Owners(t *testing.T) {
+	db, dbPath, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	createOwnedFiles(t, db, "test-index")
+
+	searcher := createSearcher(t, dbPath, "test-index")
+	defer searcher.Close()
+
+	stats, err := searcher.GetIndexStats("test-index")
+	if err != nil {
+		t.Fatalf("GetIndexStats failed: %v", err)
+	}
+
+	if len(stats.TopOwners) != 3 {
+		t.Fatalf("expected 3 owners, got %d", len(stats.TopOwners))
+	}
+	// ordered by size: bob (5000), alice (300), uid 2000 (50)
+	if stats.TopOwners[0].Name != "bob" || stats.TopOwners[0].Size != 5000 {
+		t.Errorf("expected bob first, got %+v", stats.TopOwners[0])
+	}
+	if stats.TopOwners[1].Name != "alice" || stats.TopOwners[1].Count != 2 || stats.TopOwners[1].Size != 300 {
+		t.Errorf("unexpected alice entry %+v", stats.TopOwners[1])
+	}
+	if stats.TopOwners[2].Name != "" || stats.TopOwners[2].ID != 2000 {
+		t.Errorf("expected unnamed uid 2000 last, got %+v", stats.TopOwners[2])
+	}
+
+	if len(stats.TopGroups) != 2 || stats.TopGroups[0].Name != "staff" || stats.TopGroups[0].Size != 5300 {
+		t.Errorf("unexpected groups %+v", stats.TopGroups)
+	}
+
+	global, err := searcher.GetGlobalStats()
+	if err != nil {
+		t.Fatalf("GetGlobalStats failed: %v", err)
+	}
+	if len(global.TopOwners) != 3 || global.TopOwners[0].Name != "bob" {
+		t.Errorf("unexpected global owners %+v", global.TopOwners)
+	}
+}
+
+func TestGetGlobalStats_OwnersAcrossIndexes(t *testing.T) {
+	var configs []*models.IndexConfig
+	for _, name := range []string{"host-a", "host-b"} {
+		db, dbPath, cleanup := setupTestDB(t)
+		defer cleanup()
+
+		owners := []models.FileRecord{
+			// Only host-b knows uid 1000 as carol
+			{UID: 1000, Owner: "alice", Size: 900},
+		}
+		if name == "host-a" {
+			// More owners than an index lists, uid 1016 is the smallest here
+			for i := 1; i <= 16; i++ {
+				owners = append(owners, models.FileRecord{UID: int64(1000 + i), Owner: fmt.Sprintf("user%d", i), Size: int64(1000 - i*10)})
+			}
+		} else {
+			owners = []models.FileRecord{
+				{UID: 1000, Owner: "carol", Size: 1200},
+				{UID: 1016, Owner: "user16", Size: 500},
+			}
+		}
+		for i, f := range owners {
+			f.IndexName = name
+			f.Name = fmt.Sprintf("file%d.dat", i)
+			f.Path = "/p/" + f.Name
+			f.Inode = int64(i + 1)
+			f.GID = 100
+			f.Group = "staff"
+			f.ModTime = time.Now()
+			insertTestFile(t, db, f)
+		}
+		configs = append(configs, &models.IndexConfig{Name: name, DBPath: dbPath})
+	}
+	searcher, err := NewSearcher(configs)
+	if err != nil {
+		t.Fatalf("NewSearcher failed: %v", err)
+	}
+	defer searcher.Close()
+
+	global, err := searcher.GetGlobalStats()
+	if err != nil {
+		t.Fatalf("GetGlobalStats failed: %v", err)
+	}
+	if len(global.TopOwners) != 15 {
+		t.Fatalf("expected 15 owners, got %d", len(global.TopOwners))
+	}
+	// user16 is left out of the top owners of host-a but leads in total
+	if o := global.TopOwners[0]; o.Name != "user16" || o.Size != 840+500 || o.Count != 2 {
+		t.Errorf("expected user16 first, got %+v", o)
+	}
+	var alice, carol bool
+	for _, o := range global.TopOwners {
+		alice = alice || o.Name == "alice" && o.Size == 900
+		carol = carol || o.Name == "carol" && o.Size == 1200
+	}
+	if !alice || !carol {
+		t.Errorf("expected uid 1000 as alice and carol apart, got %+v", global.TopOwners)
+	}
+	if len(global.TopGroups) != 1 || global.TopGroups[0].Count != 19 {
+		t.Errorf("unexpected groups %+v", global.TopGroups)
+	}
+}
@@ -2,7 +2,9 @@ package app
 
 import (
 	"database/sql"
+	"fmt"
 	"os"
+	"path"
 	"path/filepath"
 	"testing"
 	"time"
@@ -12,7 +14,7 @@ import (
 )
 
 // setupTestDB creates a temporary SQLite database for testing
-func setupTestDB(t *testing.T) (*sql.DB, string, func()) {
+func setupTestDB(t testing.TB) (*sql.DB, string, func()) {
 	t.Helper()
 
 	tmpDir, err := os.MkdirTemp("", "findex_test_*")
@@ -28,46 +30,7 @@ func setupTestDB(t *testing.T) (*sql.DB, string, func()) {
 	}
 
 	// Run migrations
-	schema := `
-		CREATE TABLE IF NOT EXISTS files (
-			id INTEGER PRIMARY KEY,
-			index_name TEXT,
-			path TEXT NOT NULL UNIQUE,
-			name TEXT,
-			dir TEXT,
-			dir_index INTEGER,
-			ext TEXT,
-			size INTEGER,
-			mod_time INTEGER,
-			is_dir INTEGER,
-			is_searchable INTEGER DEFAULT 0
-		);
-
-		CREATE TABLE IF NOT EXISTS metadata (
-			key TEXT PRIMARY KEY,
-			value TEXT
-		);
-
-		CREATE TABLE IF NOT EXISTS dir_sizes (
-			path TEXT PRIMARY KEY,
-			total_size INTEGER,
-			file_count INTEGER
-		);
-
-		CREATE TABLE IF NOT EXISTS scan_history (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			scan_time INTEGER NOT NULL,
-			stats_json TEXT NOT NULL
-		);
-
-		CREATE INDEX IF NOT EXISTS idx_scan_history_time ON scan_history(scan_time DESC);
-
-		CREATE VIRTUAL TABLE IF NOT EXISTS files_fts USING fts5(name, path, tokenize = 'unicode61');
-
-		CREATE INDEX IF NOT EXISTS idx_files_path ON files(path);
-		CREATE INDEX IF NOT EXISTS idx_dir_index ON files(dir_index);
-	`
-	if _, err := db.Exec(schema); err != nil {
+	if err := RunMigrations(db); err != nil {
 		db.Close()
 		os.RemoveAll(tmpDir)
 		t.Fatalf("failed to run migrations: %v", err)
@@ -82,7 +45,7 @@ func setupTestDB(t *testing.T) (*sql.DB, string, func()) {
 }
 
 // insertTestFile inserts a test file record into the database
-func insertTestFile(t *testing.T, db *sql.DB, f models.FileRecord) int64 {
+func insertTestFile(t testing.TB, db *sql.DB, f models.FileRecord) int64 {
 	t.Helper()
 
 	isDir := 0
@@ -90,10 +53,18 @@ func insertTestFile(t *testing.T, db *sql.DB, f models.FileRecord) int64 {
 		isDir = 1
 	}
 
+	parentID := ensureTestDir(t, db, path.Dir(f.Path))
+	if f.IsDir {
+		ensureTestDir(t, db, f.Path)
+	}
+
 	result, err := db.Exec(`
-		INSERT INTO files(path, name, dir, ext, size, mod_time, is_dir, is_searchable, index_name, dir_index)
-		VALUES (?, ?, ?, ?, ?, ?, ?, 2, ?, ?)
-	`, f.Path, f.Name, f.Dir, f.Ext, f.Size, f.ModTime.Unix(), isDir, f.IndexName, f.DirIndex)
+		INSERT INTO files(parent_id, name, ext, size, mod_time, is_dir, is_searchable, index_name,
+		                  device, inode, nlink, disk_size, uid, gid, owner_name, group_name)
+		VALUES (?, ?, ?, ?, ?, ?, 2, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, parentID, path.Base(f.Path), f.Ext, f.Size, f.ModTime.Unix(), isDir, f.IndexName,
+		nullIfNoInode(f, f.Device), nullIfNoInode(f, f.Inode), nullIfNoInode(f, f.Links), nullIfNoInode(f, f.DiskSize),
+		nullIfNoInode(f, f.UID), nullIfNoInode(f, f.GID), nullIfEmpty(f.Owner), nullIfEmpty(f.Group))
 	if err != nil {
 		t.Fatalf("failed to insert test file: %v", err)
 	}
@@ -101,7 +72,7 @@ func insertTestFile(t *testing.T, db *sql.DB, f models.FileRecord) int64 {
 	id, _ := result.LastInsertId()
 
 	// Insert into FTS
-	_, err = db.Exec(`INSERT INTO files_fts(rowid, name, path) VALUES (?, ?, ?)`, id, f.Name, f.Path)
+	_, err = db.Exec(`INSERT INTO files_fts(rowid, name, dir) VALUES (?, ?, ?)`, id, f.Name, path.Dir(f.Path))
 	if err != nil {
 		t.Fatalf("failed to insert into FTS: %v", err)
 	}
@@ -109,8 +80,30 @@ func insertTestFile(t *testing.T, db *sql.DB, f models.FileRecord) int64 {
 	return id
 }
 
+// ensureTestDir returns the dirs id of dir, creating it and its ancestors.
+// Test paths are relative, "." is the root.
+func ensureTestDir(t testing.TB, db *sql.DB, dir string) int64 {
+	t.Helper()
+
+	var id int64
+	if err := db.QueryRow(`SELECT id FROM dirs WHERE path = ?`, dir).Scan(&id); err == nil {
+		return id
+	}
+
+	var parentID any
+	if dir != "." && dir != "/" {
+		parentID = ensureTestDir(t, db, path.Dir(dir))
+	}
+	result, err := db.Exec(`INSERT INTO dirs(path, name, parent_id) VALUES (?, ?, ?)`, dir, path.Base(dir), parentID)
+	if err != nil {
+		t.Fatalf("failed to insert test dir: %v", err)
+	}
+	id, _ = result.LastInsertId()
+	return id
+}
+
 // createTestFiles creates a set of test files with various properties
-func createTestFiles(t *testing.T, db *sql.DB, indexName string) []models.FileRecord {
+func createTestFiles(t testing.TB, db *sql.DB, indexName string) []models.FileRecord {
 	t.Helper()
 
 	now := time.Now()
@@ -205,7 +198,7 @@ func createTestFiles(t *testing.T, db *sql.DB, indexName string) []models.FileRe
 }
 
 // createSearcher creates a Searcher with a test database
-func createSearcher(t *testing.T, dbPath string, indexName string) *Searcher {
+func createSearcher(t testing.TB, dbPath string, indexName string) *Searcher {
 	t.Helper()
 
 	cfg := &models.IndexConfig{
@@ -220,3 +213,66 @@ func createSearcher(t *testing.T, dbPath string, indexName string) *Searcher {
 
 	return searcher
 }
+
+// scanFixture is a local index over a temporary data directory, configured
+// through a config file like a real setup
+type scanFixture struct {
+	dataDir    string
+	dbPath     string
+	configPath string
+	cfg        *models.AppConfig
+}
+
+// setupScanFixture writes files (slash separated path to content) below a
+// new data directory and configures "test-index" over it. options are
+// extra settings of the index in YAML, e.g. "keep_history: true".
+func setupScanFixture(t *testing.T, files map[string]string, options ...string) *scanFixture {
+	t.Helper()
+
+	tmpDir := t.TempDir()
+	f := &scanFixture{
+		dataDir:    filepath.Join(tmpDir, "data"),
+		dbPath:     filepath.Join(tmpDir, "test.db"),
+		configPath: filepath.Join(tmpDir, "config.yaml"),
+	}
+	if err := os.MkdirAll(f.dataDir, 0755); err != nil {
+		t.Fatalf("failed to create dir: %v", err)
+	}
+	for name, content := range files {
+		f.write(t, name, content)
+	}
+
+	config := fmt.Sprintf("indexes:\n  - name: test-index\n    db_path: %s\n    source_engine: local\n    root_paths:\n      - %s\n", f.dbPath, f.dataDir)
+	for _, option := range options {
+		config += "    " + option + "\n"
+	}
+	if err := os.WriteFile(f.configPath, []byte(config), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	cfg, err := LoadConfig(f.configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	f.cfg = cfg
+	return f
+}
+
+// write creates or replaces a file below the data directory
+func (f *scanFixture) write(t *testing.T, name, content string) {
+	t.Helper()
+	full := filepath.Join(f.dataDir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+		t.Fatalf("failed to create dir: %v", err)
+	}
+	if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to create file: %v", err)
+	}
+}
+
+// scan runs a forced scan of the index
+func (f *scanFixture) scan(t *testing.T) {
+	t.Helper()
+	if err := ScanIndexes(f.cfg, true); err != nil {
+		t.Fatalf("ScanIndexes failed: %v", err)
+	}
+}
@@ -0,0 +1,187 @@
+package app
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Match modes of FileFilter.MatchMode. Words, the default, matches whole
+// words of names and paths with files_fts. Substring and fuzzy match names
+// with files_trigram, which indexes every three characters of a name and is
+// only filled for indexes with trigram_index set.
+const (
+	MatchWords     = "words"
+	MatchSubstring = "substring"
+	MatchFuzzy     = "fuzzy"
+)
+
+// ErrNoTrigramIndex is returned by Search for a substring or fuzzy search of
+// an index without a trigram index
+var ErrNoTrigramIndex = errors.New("substring and fuzzy matching need trigram_index: true and a rescan")
+
+// fuzzyCandidates is how many names of an index sharing the most trigrams
+// with the terms are compared by edit distance. Every page of a fuzzy search
+// reads the same candidates, so paging through them stays consistent.
+const fuzzyCandidates = 20000
+
+// usesTrigrams reports whether the query is matched against files_trigram
+func (q *Query) usesTrigrams() bool {
+	return q.Filter.MatchMode == MatchSubstring || q.Filter.MatchMode == MatchFuzzy
+}
+
+// searchesDeleted reports whether the query searches the tombstones of
+// deleted files too. Tombstones only have a word index, substring and fuzzy
+// matching leave them out.
+func (q *Query) searchesDeleted() bool {
+	return q.Filter.IncludeDeleted && !q.usesTrigrams()
+}
+
+// ftsTable is the full-text table Match and Exclude are written for
+func (q *Query) ftsTable() string {
+	if q.usesTrigrams() {
+		return "files_trigram"
+	}
+	return "files_fts"
+}
+
+// compileMatchMode rewrites Match and Exclude for the match mode of the
+// filter. The trigram table only holds names, so path: qualifiers move to
+// Path and stay matched by word.
+func (q *Query) compileMatchMode() error {
+	if !q.usesTrigrams() {
+		return nil
+	}
+	if q.shortTerm >= 0 {
+		return &QueryError{q.shortTerm, q.Filter.MatchMode + " matching needs terms of at least 3 characters"}
+	}
+
+	var names, paths []queryNode
+	for _, n := range q.nodes {
+		if n.path {
+			paths = append(paths, n)
+		} else {
+			names = append(names, n)
+		}
+	}
+	q.Path, _ = combineNodes(paths)
+
+	if q.Filter.MatchMode == MatchSubstring {
+		q.Match, q.Exclude = combineNodes(names)
+		return nil
+	}
+
+	// Fuzzy matching selects candidates sharing a trigram with every term
+	// and keeps those within the allowed edit distance
+	var match, exclude []string
+	q.fuzzyTerms = nil
+	for _, n := range names {
+		if n.negated {
+			exclude = append(exclude, n.fts)
+			continue
+		}
+		if n.term == "" {
+			return &QueryError{n.pos, "fuzzy matching does not support OR or parentheses"}
+		}
+		term := []rune(strings.ToLower(n.term))
+		q.fuzzyTerms = append(q.fuzzyTerms, term)
+		match = append(match, trigramAlternatives(term))
+	}
+	q.Match = strings.Join(match, " AND ")
+	q.Exclude = strings.Join(exclude, " OR ")
+	return nil
+}
+
+// trigramAlternatives matches names sharing at least one trigram with term
+func trigramAlternatives(term []rune) string {
+	seen := map[string]bool{}
+	var grams []string
+	for i := 0; i+3 <= len(term); i++ {
+		g := string(term[i : i+3])
+		if !seen[g] {
+			seen[g] = true
+			grams = append(grams, quoteFTS(g))
+		}
+	}
+	return "(" + strings.Join(grams, " OR ") + ")"
+}
+
+// maxTypos is the edit distance a fuzzy term of n characters tolerates
+func maxTypos(n int) int {
+	switch {
+	case n <= 4:
+		return 1
+	case n <= 8:
+		return 2
+	}
+	return 3
+}
+
+// fuzzyDistance returns the summed edit distance of the fuzzy terms to their
+// closest part of name, -1 when a term is further off than it tolerates
+func (q *Query) fuzzyDistance(name string) int {
+	text := []rune(strings.ToLower(name))
+	total := 0
+	for _, term := range q.fuzzyTerms {
+		d := substringDistance(term, text)
+		if d > maxTypos(len(term)) {
+			return -1
+		}
+		total += d
+	}
+	return total
+}
+
+// substringDistance is the smallest Levenshtein distance between term and
+// any substring of text
+func substringDistance(term, text []rune) int {
+	// col[i] is the distance of term[:i] to the best substring ending at the
+	// current character of text, which may start anywhere for free
+	col := make([]int, len(term)+1)
+	for i := range col {
+		col[i] = i
+	}
+	best := col[len(term)]
+	for _, c := range text {
+		diag := col[0]
+		for i := 1; i <= len(term); i++ {
+			cost := 1
+			if term[i-1] == c {
+				cost = 0
+			}
+			next := min(col[i]+1, col[i-1]+1, diag+cost)
+			diag, col[i] = col[i], next
+		}
+		best = min(best, col[len(term)])
+	}
+	return best
+}
+
+// hasTrigramIndex reports whether the scan filled files_trigram
+func hasTrigramIndex(db *sql.DB) bool {
+	var exists bool
+	err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM files_trigram)`).Scan(&exists)
+	return err == nil && exists
+}
+
+// rebuildTrigram fills files_trigram with the names of the searchable
+// files, or empties it when the index has no trigram index
+func rebuildTrigram(db *sql.DB, enabled bool) error {
+	if _, err := db.Exec(`INSERT INTO files_trigram(files_trigram) VALUES('delete-all')`); err != nil {
+		return err
+	}
+	if !enabled {
+		return nil
+	}
+	log.Println("  Rebuilding trigram index...")
+	if _, err := db.Exec(`
+		INSERT INTO files_trigram(rowid, name)
+		SELECT id, name FROM files WHERE is_searchable = 2
+	`); err != nil {
+		return fmt.Errorf("failed to fill trigram index: %w", err)
+	}
+	_, err := db.Exec(`INSERT INTO files_trigram(files_trigram) VALUES('optimize')`)
+	return err
+}
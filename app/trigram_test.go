@@ -0,0 +1,186 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ogefest/findex/models"
+)
+
+func TestSubstringDistance(t *testing.T) {
+	tests := []struct {
+		term, text string
+		expected   int
+	}{
+		{"report", "annualreport2024.pdf", 0},
+		{"report", "annualreprot2024.pdf", 2},
+		{"report", "annualrepot2024.pdf", 1},
+		{"report", "rport", 1},
+		{"vacation", "vacaton photos", 1},
+		{"movie", "", 5},
+		{"abc", "xyz", 3},
+	}
+	for _, tt := range tests {
+		got := substringDistance([]rune(tt.term), []rune(tt.text))
+		if got != tt.expected {
+			t.Errorf("substringDistance(%q, %q) = %d, expected %d", tt.term, tt.text, got, tt.expected)
+		}
+	}
+}
+
+func TestCompileSearch_MatchModes(t *testing.T) {
+	tests := []struct {
+		query, mode    string
+		match, exclude string
+		path           string
+	}{
+		{"report ", MatchWords, `"report"`, "", ""},
+		{"report -draft path:docs", MatchSubstring, `"report" NOT "draft"`, "", `dir : "docs"`},
+		{"-draft", MatchSubstring, "", `"draft"`, ""},
+		{"(report OR memo) 2024 ", MatchSubstring, `("report" OR "memo") AND "2024"`, "", ""},
+		{"repo -draft", MatchFuzzy, `("rep" OR "epo")`, `"draft"`, ""},
+		{"match:fuzzy movie", "", `("mov" OR "ovi" OR "vie")`, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := compileSearch(tt.query, &FileFilter{MatchMode: tt.mode})
+			if err != nil {
+				t.Fatalf("compileSearch(%q) failed: %v", tt.query, err)
+			}
+			if q.Match != tt.match || q.Exclude != tt.exclude || q.Path != tt.path {
+				t.Errorf("compileSearch(%q) = match %q exclude %q path %q, expected %q, %q and %q",
+					tt.query, q.Match, q.Exclude, q.Path, tt.match, tt.exclude, tt.path)
+			}
+		})
+	}
+
+	for _, tt := range []struct{ query, mode string }{
+		{"ab report", MatchSubstring},
+		{"re*", MatchFuzzy},
+		{"report OR memo", MatchFuzzy},
+		{"match:typo report", ""},
+	} {
+		var qe *QueryError
+		if _, err := compileSearch(tt.query, &FileFilter{MatchMode: tt.mode}); !errors.As(err, &qe) {
+			t.Errorf("compileSearch(%q, %s) expected a QueryError, got %v", tt.query, tt.mode, err)
+		}
+	}
+}
+
+func TestSearch_MatchModes(t *testing.T) {
+	db, dbPath, cleanup := setupTestDB(t)
+	defer cleanup()
+	createTestFiles(t, db, "test-index")
+	for _, name := range []string{"AnnualReport2024.pdf", "annual_reprot_draft.pdf"} {
+		insertTestFile(t, db, models.FileRecord{
+			IndexName: "test-index", Path: "documents/" + name, Name: name, Ext: ".pdf", ModTime: time.Now(),
+		})
+	}
+
+	before := createSearcher(t, dbPath, "test-index")
+	_, err := before.Search("report", &FileFilter{MatchMode: MatchSubstring}, 100)
+	before.Close()
+	if !errors.Is(err, ErrNoTrigramIndex) {
+		t.Fatalf("expected ErrNoTrigramIndex before the trigram index is built, got %v", err)
+	}
+	if err := rebuildTrigram(db, true); err != nil {
+		t.Fatalf("rebuildTrigram failed: %v", err)
+	}
+	// A searcher checks for trigram indexes once, a new one sees it
+	searcher := createSearcher(t, dbPath, "test-index")
+	defer searcher.Close()
+
+	tests := []struct {
+		query, mode string
+		expected    []string
+	}{
+		{"report", MatchWords, []string{"report.pdf"}},
+		{"report", MatchSubstring, []string{"AnnualReport2024.pdf", "report.pdf"}},
+		{"ort -annual", MatchSubstring, []string{"report.pdf"}},
+		{"shot path:images", MatchSubstring, []string{"screenshot.png"}},
+		// Exact matches rank before the typo
+		{"annual report", MatchFuzzy, []string{"AnnualReport2024.pdf", "annual_reprot_draft.pdf"}},
+		{"movei", MatchFuzzy, []string{"movie.mp4"}},
+		{"anual -draft", MatchFuzzy, []string{"AnnualReport2024.pdf"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode+" "+tt.query, func(t *testing.T) {
+			results, err := searcher.Search(tt.query, &FileFilter{MatchMode: tt.mode}, 100)
+			if err != nil {
+				t.Fatalf("Search failed: %v", err)
+			}
+			var names []string
+			for _, f := range results {
+				names = append(names, f.Name)
+			}
+			if tt.mode != MatchFuzzy {
+				sort.Strings(names)
+			}
+			if !reflect.DeepEqual(names, tt.expected) {
+				t.Errorf("Search(%q, %s) = %v, expected %v", tt.query, tt.mode, names, tt.expected)
+			}
+		})
+	}
+
+	t.Run("export drops fuzzy candidates", func(t *testing.T) {
+		var buf bytes.Buffer
+		n, err := searcher.Export(&buf, FormatCSV, "movei", &FileFilter{MatchMode: MatchFuzzy})
+		if err != nil {
+			t.Fatalf("Export failed: %v", err)
+		}
+		if n != 1 || !strings.Contains(buf.String(), "movie.mp4") {
+			t.Errorf("expected only movie.mp4, got %d rows:\n%s", n, buf.String())
+		}
+	})
+}
+
+func TestSearch_MatchModesSkipIndexesWithoutTrigrams(t *testing.T) {
+	var configs []*models.IndexConfig
+	for _, name := range []string{"archive", "media"} {
+		db, dbPath, cleanup := setupTestDB(t)
+		defer cleanup()
+		createTestFiles(t, db, name)
+		if name == "archive" {
+			if err := rebuildTrigram(db, true); err != nil {
+				t.Fatalf("rebuildTrigram failed: %v", err)
+			}
+		}
+		configs = append(configs, &models.IndexConfig{Name: name, DBPath: dbPath})
+	}
+	searcher, err := NewSearcher(configs)
+	if err != nil {
+		t.Fatalf("NewSearcher failed: %v", err)
+	}
+	defer searcher.Close()
+
+	filter := &FileFilter{MatchMode: MatchSubstring}
+	page, err := searcher.SearchPage(context.Background(), "eport", filter, "", 10)
+	if err != nil {
+		t.Fatalf("SearchPage failed: %v", err)
+	}
+	if len(page.Results) != 1 || page.Results[0].IndexName != "archive" {
+		t.Errorf("expected report.pdf of archive, got %+v", page.Results)
+	}
+	skipped := FailedIndexes(page.Indexes)
+	if len(skipped) != 1 || skipped[0].Index != "media" || !skipped[0].Skipped || !errors.Is(skipped[0].Err, ErrNoTrigramIndex) {
+		t.Errorf("expected media reported as skipped, got %+v", page.Indexes)
+	}
+
+	// The skipped index does not make the count a lower bound
+	count, err := searcher.Count(context.Background(), "eport", filter)
+	if err != nil || count.Total != 1 || !count.Exact {
+		t.Errorf("expected an exact count of 1, got %+v (%v)", count, err)
+	}
+
+	// Search returns the results with an error naming the skipped index
+	results, err := searcher.Search("eport", filter, 10)
+	if len(results) != 1 || !errors.Is(err, ErrNoTrigramIndex) || !strings.Contains(err.Error(), "media") {
+		t.Errorf("expected one result and media named, got %d results and %v", len(results), err)
+	}
+}
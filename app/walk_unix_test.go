@@ -0,0 +1,164 @@
+//go:build !windows
+
+package app
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ogefest/findex/models"
+)
+
+// createSymlinkTree builds a tree with a file link and a link back to the root
+func createSymlinkTree(t *testing.T) string {
+	tmpDir := t.TempDir()
+
+	if err := os.MkdirAll(filepath.Join(tmpDir, "data", "sub"), 0755); err != nil {
+		t.Fatalf("failed to create dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, "data", "sub", "file.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatalf("failed to create file: %v", err)
+	}
+	if err := os.Symlink(filepath.Join(tmpDir, "data", "sub", "file.txt"), filepath.Join(tmpDir, "file-link.txt")); err != nil {
+		t.Fatalf("failed to create symlink: %v", err)
+	}
+	// loop: data/sub/back -> tmpDir
+	if err := os.Symlink(tmpDir, filepath.Join(tmpDir, "data", "sub", "back")); err != nil {
+		t.Fatalf("failed to create symlink: %v", err)
+	}
+	return tmpDir
+}
+
+func walkRecords(source *LocalSource, root string) map[string]models.FileRecord {
+	found := make(map[string]models.FileRecord)
+	for f := range source.Walk() {
+		rel, _ := filepath.Rel(root, f.Path)
+		found[filepath.ToSlash(rel)] = f
+	}
+	return found
+}
+
+func TestLocalSourceWalk_SymlinksNotFollowed(t *testing.T) {
+	tmpDir := createSymlinkTree(t)
+
+	source := NewLocalSource("test-index", []string{tmpDir}, nil, 2, false, nil)
+	found := walkRecords(source, tmpDir)
+
+	link, ok := found["file-link.txt"]
+	if !ok {
+		t.Fatal("expected file symlink to be recorded")
+	}
+	if link.LinkTarget != filepath.Join(tmpDir, "data", "sub", "file.txt") {
+		t.Errorf("unexpected link target %q", link.LinkTarget)
+	}
+
+	back, ok := found["data/sub/back"]
+	if !ok {
+		t.Fatal("expected directory symlink to be recorded")
+	}
+	if back.IsDir {
+		t.Error("directory symlink should not be treated as a directory when not following")
+	}
+	if back.LinkTarget != tmpDir {
+		t.Errorf("unexpected link target %q", back.LinkTarget)
+	}
+
+	if _, ok := found["data/sub/back/data"]; ok {
+		t.Error("symlinked directory should not be descended into")
+	}
+	if found["data/sub/file.txt"].LinkTarget != "" {
+		t.Error("regular file should have no link target")
+	}
+}
+
+func TestLocalSourceWalk_FollowSymlinksDetectsLoops(t *testing.T) {
+	tmpDir := createSymlinkTree(t)
+
+	source := NewLocalSource("test-index", []string{tmpDir}, nil, 2, false, nil)
+	source.FollowSymlinks = true
+
+	done := make(chan map[string]models.FileRecord)
+	go func() { done <- walkRecords(source, tmpDir) }()
+
+	var found map[string]models.FileRecord
+	select {
+	case found = <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("walk did not finish, symlink loop not detected")
+	}
+
+	back, ok := found["data/sub/back"]
+	if !ok {
+		t.Fatal("expected directory symlink to be recorded")
+	}
+	if !back.IsDir {
+		t.Error("followed directory symlink should be recorded as a directory")
+	}
+	if back.LinkTarget != tmpDir {
+		t.Errorf("unexpected link target %q", back.LinkTarget)
+	}
+
+	// The loop points back at the root, which was already visited
+	if _, ok := found["data/sub/back/data"]; ok {
+		t.Error("symlink loop should not be walked")
+	}
+
+	link := found["file-link.txt"]
+	if link.Size != 5 {
+		t.Errorf("followed file symlink should report target size, got %d", link.Size)
+	}
+}
+
+func TestLocalSourceWalk_HardlinksShareInode(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	original := filepath.Join(tmpDir, "original.txt")
+	if err := os.WriteFile(original, []byte("shared content"), 0644); err != nil {
+		t.Fatalf("failed to create file: %v", err)
+	}
+	if err := os.Link(original, filepath.Join(tmpDir, "linked.txt")); err != nil {
+		t.Skipf("hardlinks not supported: %v", err)
+	}
+
+	source := NewLocalSource("test-index", []string{tmpDir}, nil, 2, false, nil)
+	found := walkRecords(source, tmpDir)
+
+	a, b := found["original.txt"], found["linked.txt"]
+	if a.Inode == 0 {
+		t.Fatal("expected inode to be recorded")
+	}
+	if a.Inode != b.Inode || a.Device != b.Device {
+		t.Errorf("hardlinks should share device and inode: %d/%d vs %d/%d", a.Device, a.Inode, b.Device, b.Inode)
+	}
+	if a.Links != 2 {
+		t.Errorf("expected link count 2, got %d", a.Links)
+	}
+}
+
+func TestLocalSourceWalk_RecordsOwnership(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	path := filepath.Join(tmpDir, "script.sh")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"), 0644); err != nil {
+		t.Fatalf("failed to create file: %v", err)
+	}
+	if err := os.Chmod(path, 0750); err != nil {
+		t.Fatalf("failed to chmod: %v", err)
+	}
+
+	source := NewLocalSource("test-index", []string{tmpDir}, nil, 2, false, nil)
+	f := walkRecords(source, tmpDir)["script.sh"]
+
+	if f.UID != int64(os.Getuid()) || f.GID != int64(os.Getgid()) {
+		t.Errorf("expected uid/gid %d/%d, got %d/%d", os.Getuid(), os.Getgid(), f.UID, f.GID)
+	}
+	if f.Mode != 0750 {
+		t.Errorf("expected mode 0750, got %o", f.Mode)
+	}
+	if u, err := user.Current(); err == nil && f.Owner != u.Username {
+		t.Errorf("expected owner %q, got %q", u.Username, f.Owner)
+	}
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"github.com/ogefest/findex/app"
+)
+
+// diff prints the changes recorded by a scan: findex diff [-index name] [-scan id] [-kind kind]
+func diff(args []string) {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	configPath := fs.String("config", "index_config.yaml", "Path to index configuration file")
+	indexName := fs.String("index", "", "Index to show, may be omitted when the config has one index")
+	scanID := fs.Int64("scan", 0, "Scan id, defaults to the latest scan")
+	kind := fs.String("kind", "", "Only show added, removed, modified or moved files")
+	fs.Parse(args)
+
+	if err := app.Diff(os.Stdout, *configPath, *indexName, *scanID, *kind); err != nil {
+		log.Fatalf("error: %v", err)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/ogefest/findex/app"
+)
+
+// filterFlags are the search filters accepted by export, named like the
+// parameters of the web search form
+var filterFlags = map[string]string{
+	"ext":       "Comma separated extensions, e.g. mp4,mkv",
+	"min_size":  "Minimum size, e.g. 10MB",
+	"max_size":  "Maximum size, e.g. 4GB",
+	"date_from": "Modified on or after, YYYY-MM-DD",
+	"date_to":   "Modified on or before, YYYY-MM-DD",
+	"type":      "files, dirs or links",
+	"owner":     "Owner name or uid",
+	"group":     "Group name or gid",
+}
+
+// export writes indexes or a search result set as NDJSON, CSV or SQLite:
+// findex export [-index a,b] [-format csv] [-q query] [-o file] [filters]
+func export(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	configPath := fs.String("config", "index_config.yaml", "Path to index configuration file")
+	indexes := fs.String("index", "", "Comma separated indexes to export, all when empty")
+	format := fs.String("format", app.FormatNDJSON, "ndjson, csv or sqlite")
+	query := fs.String("q", "", "Only export files matching this search")
+	output := fs.String("o", "", "Output file, standard output when empty")
+	for name, usage := range filterFlags {
+		fs.String(name, "", usage)
+	}
+	fs.Parse(args)
+
+	filter := url.Values{}
+	fs.Visit(func(f *flag.Flag) {
+		if _, ok := filterFlags[f.Name]; ok {
+			filter.Set(f.Name, f.Value.String())
+		}
+	})
+
+	var names []string
+	if *indexes != "" {
+		names = strings.Split(*indexes, ",")
+	}
+
+	out := os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			log.Fatalf("error: %v", err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	count, err := app.ExportIndexes(out, *configPath, names, *format, *query, app.ParseFilter(filter))
+	if err != nil {
+		log.Fatalf("error: %v", err)
+	}
+	log.Printf("Exported %d entries", count)
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/ogefest/findex/app"
+)
+
+// importCatalogs loads catalogs written by findex export into a catalog
+// index: findex import -index name [-format csv] file...
+func importCatalogs(args []string) {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	configPath := fs.String("config", "index_config.yaml", "Path to index configuration file")
+	indexName := fs.String("index", "", "Catalog index to fill, replacing its contents")
+	format := fs.String("format", "", "ndjson or csv, taken from the file extension when empty")
+	fs.Parse(args)
+
+	if err := app.ImportCatalogs(*configPath, *indexName, fs.Args(), *format); err != nil {
+		log.Fatalf("error: %v", err)
+	}
+}
+
+// merge combines index databases into a catalog index:
+// findex merge -index name index-or-db...
+func merge(args []string) {
+	fs := flag.NewFlagSet("merge", flag.ExitOnError)
+	configPath := fs.String("config", "index_config.yaml", "Path to index configuration file")
+	indexName := fs.String("index", "", "Catalog index to fill, replacing its contents")
+	fs.Parse(args)
+
+	if err := app.MergeIndexes(*configPath, *indexName, fs.Args()); err != nil {
+		log.Fatalf("error: %v", err)
+	}
+}
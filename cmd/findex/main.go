@@ -3,11 +3,30 @@ package main
 import (
 	"flag"
 	"log"
+	"os"
 
 	"github.com/ogefest/findex/app"
 )
 
+// commands are the subcommands, run as findex <command> [flags]. Without one
+// findex scans the configured indexes.
+var commands = map[string]func(args []string){
+	"diff":     diff,
+	"export":   export,
+	"import":   importCatalogs,
+	"maintain": maintain,
+	"merge":    merge,
+	"prune":    prune,
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			cmd(os.Args[2:])
+			return
+		}
+	}
+
 	configPath := flag.String("config", "index_config.yaml", "Path to index configuration file")
 	forceScan := flag.Bool("force", false, "Force scan ignoring refresh_interval")
 	flag.Parse()
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/ogefest/findex/app"
+)
+
+// maintain checks or repairs index databases without a rescan:
+// findex maintain <check|vacuum|rebuild-fts|rebuild-stats> [-index a,b]
+func maintain(args []string) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		log.Fatalf("usage: findex maintain <check|vacuum|rebuild-fts|rebuild-stats> [-config file] [-index a,b]")
+	}
+	action := args[0]
+
+	fs := flag.NewFlagSet("maintain", flag.ExitOnError)
+	configPath := fs.String("config", "index_config.yaml", "Path to index configuration file")
+	indexes := fs.String("index", "", "Comma separated indexes, all when empty")
+	fs.Parse(args[1:])
+
+	var names []string
+	if *indexes != "" {
+		names = strings.Split(*indexes, ",")
+	}
+
+	if err := app.Maintain(os.Stdout, *configPath, names, action); err != nil {
+		log.Fatalf("error: %v", err)
+	}
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"github.com/ogefest/findex/app"
+)
+
+// prune deletes quarantined databases past their retention after asking:
+// findex prune [-all] [-yes]
+func prune(args []string) {
+	fs := flag.NewFlagSet("prune", flag.ExitOnError)
+	configPath := fs.String("config", "index_config.yaml", "Path to index configuration file")
+	all := fs.Bool("all", false, "Also delete databases still within the retention")
+	yes := fs.Bool("yes", false, "Delete without asking")
+	fs.Parse(args)
+
+	if err := app.Prune(os.Stdout, os.Stdin, *configPath, *all, *yes); err != nil {
+		log.Fatalf("error: %v", err)
+	}
+}
@@ -4,18 +4,11 @@ package main
 
 import (
 	"fmt"
-	"hash/crc32"
-	"path/filepath"
 	"strings"
 )
 
-func dirIndex(dir string) int64 {
-	if dir == "" {
-		dir = "."
-	}
-	normalized := filepath.Clean(dir)
-	return int64(crc32.ChecksumIEEE([]byte(normalized)))
-}
+// demoRoot is the dirs row every demo path hangs off
+const demoRoot = "."
 
 type file struct {
 	path    string
@@ -30,7 +23,6 @@ type file struct {
 func main() {
 	// Documents index
 	fmt.Println("-- Documents index data")
-	fmt.Println("-- Generated dir_index values using CRC32")
 	fmt.Println()
 
 	documentsFiles := []file{
@@ -180,19 +172,37 @@ func main() {
 }
 
 func generateSQL(indexName string, files []file) {
+	// Directories are listed before their contents, so each parent row
+	// exists by the time a child looks it up. The index name comment lets
+	// the README split the output per database.
+	fmt.Printf("INSERT INTO dirs (path, name) VALUES ('%s', '%s'); -- %s\n", demoRoot, demoRoot, indexName)
+	for _, f := range files {
+		if f.isDir {
+			fmt.Printf("INSERT INTO dirs (path, name, parent_id, root_id) VALUES ('%s', '%s', %s, %s); -- %s\n",
+				quote(f.path), quote(f.name), parentID(f.dir), parentID(""), indexName)
+		}
+	}
+
 	for _, f := range files {
 		isDirInt := 0
 		if f.isDir {
 			isDirInt = 1
 		}
-		di := dirIndex(f.dir)
 
-		// Escape single quotes in strings
-		path := strings.ReplaceAll(f.path, "'", "''")
-		name := strings.ReplaceAll(f.name, "'", "''")
-		dir := strings.ReplaceAll(f.dir, "'", "''")
+		fmt.Printf("INSERT INTO files (index_name, parent_id, name, ext, size, mod_time, is_dir, is_searchable) VALUES ('%s', %s, '%s', '%s', %d, %d, %d, 2); -- %s\n",
+			indexName, parentID(f.dir), quote(f.name), f.ext, f.size, f.modTime, isDirInt, indexName)
+	}
+}
 
-		fmt.Printf("INSERT INTO files (index_name, path, name, dir, dir_index, ext, size, mod_time, is_dir, is_searchable) VALUES ('%s', '%s', '%s', '%s', %d, '%s', %d, %d, %d, 2);\n",
-			indexName, path, name, dir, di, f.ext, f.size, f.modTime, isDirInt)
+// parentID looks up the dirs id of dir, the root for top level entries
+func parentID(dir string) string {
+	if dir == "" {
+		dir = demoRoot
 	}
+	return fmt.Sprintf("(SELECT id FROM dirs WHERE path = '%s')", quote(dir))
+}
+
+// quote escapes single quotes for SQL string literals
+func quote(s string) string {
+	return strings.ReplaceAll(s, "'", "''")
 }
@@ -1,16 +1,35 @@
 -- Schema (run this first for both databases)
 CREATE TABLE IF NOT EXISTS files (
   id INTEGER PRIMARY KEY,
+  parent_id INTEGER NOT NULL REFERENCES dirs(id),
+  name TEXT NOT NULL,
   index_name TEXT,
-  path TEXT NOT NULL UNIQUE,
-  name TEXT,
-  dir TEXT,
-  dir_index INTEGER,
   ext TEXT,
   size INTEGER,
   mod_time INTEGER,
   is_dir INTEGER,
-  is_searchable INTEGER DEFAULT 0
+  is_searchable INTEGER DEFAULT 0,
+  link_target TEXT,
+  device INTEGER,
+  inode INTEGER,
+  nlink INTEGER,
+  disk_size INTEGER,
+  uid INTEGER,
+  gid INTEGER,
+  owner_name TEXT,
+  group_name TEXT,
+  mode INTEGER,
+  first_seen INTEGER,
+  origin TEXT,
+  UNIQUE (parent_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS dirs (
+  id INTEGER PRIMARY KEY,
+  parent_id INTEGER REFERENCES dirs(id),
+  path TEXT NOT NULL UNIQUE,
+  name TEXT NOT NULL,
+  root_id INTEGER REFERENCES dirs(id)
 );
 
 CREATE TABLE IF NOT EXISTS metadata (
@@ -18,9 +37,66 @@ CREATE TABLE IF NOT EXISTS metadata (
     value TEXT
 );
 
-CREATE VIRTUAL TABLE IF NOT EXISTS files_fts USING fts5(name, path, tokenize = 'unicode61');
+CREATE TABLE IF NOT EXISTS dir_sizes (
+    path TEXT PRIMARY KEY,
+    total_size INTEGER,
+    file_count INTEGER,
+    unique_size INTEGER,
+    disk_size INTEGER,
+    dir_count INTEGER
+);
+
+CREATE TABLE IF NOT EXISTS scan_history (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    scan_time INTEGER NOT NULL,
+    stats_json TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_scan_history_time ON scan_history(scan_time DESC);
+
+CREATE TABLE IF NOT EXISTS changes (
+    id INTEGER PRIMARY KEY,
+    scan_id INTEGER NOT NULL REFERENCES scan_history(id),
+    kind TEXT NOT NULL,
+    dir TEXT NOT NULL,
+    name TEXT NOT NULL,
+    old_dir TEXT,
+    size INTEGER,
+    old_size INTEGER,
+    mod_time INTEGER,
+    old_mod_time INTEGER
+);
+
+CREATE INDEX IF NOT EXISTS idx_changes_scan ON changes(scan_id, kind);
+
+CREATE TABLE IF NOT EXISTS tombstones (
+    id INTEGER PRIMARY KEY,
+    index_name TEXT,
+    root TEXT,
+    dir TEXT NOT NULL,
+    name TEXT NOT NULL,
+    ext TEXT,
+    size INTEGER,
+    mod_time INTEGER,
+    first_seen INTEGER,
+    last_seen INTEGER NOT NULL,
+    UNIQUE (dir, name)
+);
+
+CREATE INDEX IF NOT EXISTS idx_tombstones_last_seen ON tombstones(last_seen);
+CREATE VIRTUAL TABLE IF NOT EXISTS tombstones_fts USING fts5(name, dir, content = '', contentless_delete = 1, tokenize = 'unicode61');
+
+CREATE VIRTUAL TABLE IF NOT EXISTS files_fts USING fts5(name, dir, link_target, content = '', contentless_delete = 1, prefix = '2 3', tokenize = 'unicode61');
+CREATE VIRTUAL TABLE IF NOT EXISTS files_trigram USING fts5(name, content = '', contentless_delete = 1, tokenize = 'trigram');
 
-CREATE INDEX IF NOT EXISTS idx_files_path ON files(path);
-CREATE INDEX IF NOT EXISTS idx_dir_index ON files(dir_index);
+CREATE INDEX IF NOT EXISTS idx_files_inode ON files(device, inode);
+CREATE INDEX IF NOT EXISTS idx_files_uid ON files(uid);
+CREATE INDEX IF NOT EXISTS idx_files_size ON files(size);
+CREATE INDEX IF NOT EXISTS idx_files_mod_time ON files(mod_time);
+CREATE INDEX IF NOT EXISTS idx_files_name ON files(name COLLATE NOCASE);
+CREATE INDEX IF NOT EXISTS idx_dirs_parent ON dirs(parent_id);
 
+-- Matches the latest file in app/migrations, so findex does not try to
+-- upgrade the demo databases
+INSERT INTO metadata (key, value) VALUES ('schema_version', '13');
 INSERT INTO metadata (key, value) VALUES ('last_scan', '2026-01-31T10:00:00Z');
@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// Change kinds recorded by a scan
+const (
+	ChangeAdded    = "added"
+	ChangeRemoved  = "removed"
+	ChangeModified = "modified"
+	ChangeMoved    = "moved"
+)
+
+// FileChange is one file that differs between a scan and the one before it
+type FileChange struct {
+	Kind       string
+	Path       string
+	OldPath    string // previous location of a moved file
+	Size       int64  // zero for removed files
+	OldSize    int64  // zero for added files
+	ModTime    time.Time
+	OldModTime time.Time
+}
+
+// ChangeSummary counts the changes recorded by one scan
+type ChangeSummary struct {
+	ScanID   int64
+	ScanTime time.Time
+	Added    int64
+	Removed  int64
+	Modified int64
+	Moved    int64
+}
+
+// Total returns the number of changes of any kind
+func (c ChangeSummary) Total() int64 {
+	return c.Added + c.Removed + c.Modified + c.Moved
+}
@@ -1,22 +1,52 @@
 package models
 
+import "time"
+
+// RootConfig describes a single root with optional overrides of the
+// index-level walk limits. Unset fields inherit the index value.
+type RootConfig struct {
+	Path            string   `mapstructure:"path"`
+	IncludePatterns []string `mapstructure:"include_patterns"`
+	MaxDepth        int      `mapstructure:"max_depth"`
+	MinFileSize     string   `mapstructure:"min_file_size"`
+	MaxFileSize     string   `mapstructure:"max_file_size"`
+	SkipHidden      *bool    `mapstructure:"skip_hidden"`
+}
+
 type IndexConfig struct {
-	Name             string   `mapstructure:"name"`
-	SourceEngine     string   `mapstructure:"source_engine"`
-	DBPath           string   `mapstructure:"db_path"`
-	RootPaths        []string `mapstructure:"root_paths"`
-	ExcludePaths     []string `mapstructure:"exclude_paths"`
-	RefreshInterval  int      `mapstructure:"refresh_interval"`
-	ScanWorkers      int      `mapstructure:"scan_workers"`      // 0 = auto (CPU * 2)
-	ScanZipContents  bool     `mapstructure:"scan_zip_contents"` // scan inside .zip files
-	LogRetentionDays int      `mapstructure:"log_retention_days"` // days to keep scan logs, 0 = keep forever, default 30
+	Name             string       `mapstructure:"name"`
+	SourceEngine     string       `mapstructure:"source_engine"`
+	DBPath           string       `mapstructure:"db_path"`
+	RootPaths        []string     `mapstructure:"root_paths"`
+	Roots            []RootConfig `mapstructure:"roots"` // roots with per-root overrides
+	ExcludePaths     []string     `mapstructure:"exclude_paths"`
+	ExcludePatterns  []string     `mapstructure:"exclude_patterns"` // gitignore-style, relative to each root
+	ExcludeRegex     []string     `mapstructure:"exclude_regex"`    // matched against absolute paths
+	IncludePatterns  []string     `mapstructure:"include_patterns"` // when set, only matching files are indexed
+	MaxDepth         int          `mapstructure:"max_depth"`        // 0 = unlimited, 1 = only entries directly in root
+	MinFileSize      string       `mapstructure:"min_file_size"`    // e.g. "1MB", empty = no limit
+	MaxFileSize      string       `mapstructure:"max_file_size"`    // e.g. "4GB", empty = no limit
+	SkipHidden       bool         `mapstructure:"skip_hidden"`      // skip dot-files and dot-directories
+	FollowSymlinks   bool         `mapstructure:"follow_symlinks"`  // descend into symlinked directories
+	OneFileSystem    bool         `mapstructure:"one_file_system"`  // do not cross mount points
+	RefreshInterval  int          `mapstructure:"refresh_interval"`
+	ScanWorkers      int          `mapstructure:"scan_workers"`           // 0 = auto (CPU * 2)
+	ScanZipContents  bool         `mapstructure:"scan_zip_contents"`      // scan inside .zip files
+	LogRetentionDays int          `mapstructure:"log_retention_days"`     // days to keep scan logs, 0 = keep forever, default 30
+	KeepHistory      bool         `mapstructure:"keep_history"`           // track first seen and keep tombstones of deleted files
+	HistoryRetention int          `mapstructure:"history_retention_days"` // days to keep tombstones, 0 = keep forever
+	HistoryMaxFiles  int          `mapstructure:"history_max_files"`      // most tombstones kept, 0 = unlimited
+	TrigramIndex     bool         `mapstructure:"trigram_index"`          // index names for substring and fuzzy search
 }
 
 type ServerConfig struct {
-	Port int `mapstructure:"port"`
+	Port          int           `mapstructure:"port"`
+	SearchTimeout time.Duration `mapstructure:"search_timeout"` // how long a search waits for each index, default 10s
 }
 
 type AppConfig struct {
-	Server  ServerConfig  `mapstructure:"server"`
-	Indexes []IndexConfig `mapstructure:"indexes"`
+	Server              ServerConfig  `mapstructure:"server"`
+	Indexes             []IndexConfig `mapstructure:"indexes"`
+	DataDir             string        `mapstructure:"data_dir"`                  // checked for unused index databases, default: every db_path directory
+	QuarantineRetention int           `mapstructure:"quarantine_retention_days"` // days before findex prune deletes a quarantined database, default 30
 }
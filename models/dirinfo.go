@@ -1,6 +1,9 @@
 package models
 
 type DirInfo struct {
-	Size  int64
-	Files int64
+	Size       int64
+	Files      int64
+	UniqueSize int64 // Size with every hardlinked inode counted once
+	DiskUsage  int64 // allocated bytes, hardlinks counted once
+	Dirs       int64 // directories below, at any depth
 }
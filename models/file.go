@@ -5,16 +5,35 @@ import (
 )
 
 type FileRecord struct {
-	ID        int64     `db:"id"`
-	IndexName string    `db:"index_name"`
-	Path      string    `db:"path"`
-	Name      string    `db:"name"`
-	Dir       string    `db:"dir"`
-	DirIndex  int64     `db:"dir_index"`
-	Ext       string    `db:"ext"`
-	Size      int64     `db:"size"`
-	ModTime   time.Time `db:"mod_time"`
-	IsDir     bool      `db:"is_dir"`
-	Checksum  string    `db:"checksum"`
-	MetaJSON  string    `db:"meta_json"`
+	ID         int64     `db:"id"`
+	IndexName  string    `db:"index_name"`
+	Path       string    `db:"path"` // rebuilt from dirs on read, not stored per file
+	Name       string    `db:"name"`
+	Dir        string    `db:"dir"`       // root the entry was found under
+	ParentID   int64     `db:"parent_id"` // dirs.id of the containing directory, assigned on insert
+	Ext        string    `db:"ext"`
+	Size       int64     `db:"size"`
+	ModTime    time.Time `db:"mod_time"`
+	IsDir      bool      `db:"is_dir"`
+	Checksum   string    `db:"checksum"`
+	MetaJSON   string    `db:"meta_json"`
+	LinkTarget string    `db:"link_target"` // symlink target, empty for regular entries
+	Device     int64     `db:"device"`      // device and inode are zero when unknown
+	Inode      int64     `db:"inode"`
+	Links      int64     `db:"nlink"`
+	DiskSize   int64     `db:"disk_size"` // allocated bytes on disk
+	UID        int64     `db:"uid"`       // uid and gid are only valid when Inode is set
+	GID        int64     `db:"gid"`
+	Owner      string    `db:"owner_name"` // resolved at scan time, empty when unknown
+	Group      string    `db:"group_name"`
+	Mode       uint32    `db:"mode"`       // permission bits, e.g. 0644
+	FirstSeen  time.Time `db:"first_seen"` // first scan that saw the file, zero unless the index keeps history
+	LastSeen   time.Time `db:"last_seen"`  // last scan that saw a deleted file
+	Origin     string    `db:"origin"`     // index that scanned an imported entry, empty for scanned files
+	Deleted    bool      // tombstone of a file that is gone
+
+	// Parts of a search result that matched the query, byte ranges of
+	// Name and of the directories of Path; empty outside of searches
+	NameMatches []Span
+	PathMatches []Span
 }
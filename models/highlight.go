@@ -0,0 +1,102 @@
+package models
+
+import (
+	"sort"
+	"strings"
+)
+
+// Span is a byte range of a text, End exclusive
+type Span struct {
+	Start int
+	End   int
+}
+
+// Mark returns text with open and close around every span, e.g.
+// Mark(f.Name, f.NameMatches, "[", "]", nil). escape, when not nil, is
+// applied to the text but not to the markers, so HTML output passes
+// html.EscapeString. Spans must be sorted and not overlap.
+func Mark(text string, spans []Span, open, close string, escape func(string) string) string {
+	if escape == nil {
+		escape = func(s string) string { return s }
+	}
+	var b strings.Builder
+	last := 0
+	for _, s := range spans {
+		if s.Start < last || s.End > len(text) || s.Start >= s.End {
+			continue
+		}
+		b.WriteString(escape(text[last:s.Start]))
+		b.WriteString(open)
+		b.WriteString(escape(text[s.Start:s.End]))
+		b.WriteString(close)
+		last = s.End
+	}
+	b.WriteString(escape(text[last:]))
+	return b.String()
+}
+
+// MergeSpans sorts spans and joins those that overlap or touch
+func MergeSpans(spans []Span) []Span {
+	if len(spans) == 0 {
+		return nil
+	}
+	sorted := append([]Span(nil), spans...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Start < sorted[j].Start })
+	merged := sorted[:1]
+	for _, s := range sorted[1:] {
+		last := &merged[len(merged)-1]
+		if s.Start <= last.End {
+			last.End = max(last.End, s.End)
+			continue
+		}
+		merged = append(merged, s)
+	}
+	return merged
+}
+
+// PathPart is a directory of the path of a search result, with the matches
+// in its name. Elided parts stand for directories left out of a snippet.
+type PathPart struct {
+	Name    string
+	Path    string // the directory, up to and including Name
+	Matches []Span // of Name
+	Elided  bool
+}
+
+// PathSnippet splits the directories of path, the full path of an entry,
+// into parts and keeps the first one, the last keepLast and every one with
+// a match in spans, byte ranges of path. The directories left out between
+// them become one elided part each run.
+func PathSnippet(path string, spans []Span, keepLast int) []PathPart {
+	var parts []PathPart
+	start := 0
+	for i := 0; i <= len(path); i++ {
+		if i < len(path) && path[i] != '/' {
+			continue
+		}
+		if i > start {
+			part := PathPart{Name: path[start:i], Path: path[:i]}
+			for _, s := range spans {
+				if s.End > start && s.Start < i {
+					part.Matches = append(part.Matches, Span{max(s.Start, start) - start, min(s.End, i) - start})
+				}
+			}
+			parts = append(parts, part)
+		}
+		start = i + 1
+	}
+	// The last part is the entry itself
+	if len(parts) > 0 {
+		parts = parts[:len(parts)-1]
+	}
+
+	var snippet []PathPart
+	for i, p := range parts {
+		if i == 0 || i >= len(parts)-keepLast || len(p.Matches) > 0 {
+			snippet = append(snippet, p)
+		} else if n := len(snippet); n == 0 || !snippet[n-1].Elided {
+			snippet = append(snippet, PathPart{Name: "…", Elided: true})
+		}
+	}
+	return snippet
+}
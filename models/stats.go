@@ -20,11 +20,23 @@ type YearStats struct {
 	Size  int64
 }
 
+// OwnerStats is the share of one user or group, Name is empty when the id
+// had no passwd/group entry at scan time
+type OwnerStats struct {
+	ID    int64
+	Name  string
+	Count int64
+	Size  int64
+}
+
 type IndexStats struct {
 	Name             string
 	TotalFiles       int64
 	TotalDirs        int64
-	TotalSize        int64
+	TotalSize        int64 // apparent size, every hardlink counted
+	UniqueSize       int64 // each hardlinked inode counted once
+	DiskUsage        int64 // allocated bytes, hardlinks counted once
+	HardlinkedFiles  int64 // files with more than one link
 	LastScan         time.Time
 	OldestFile       time.Time
 	NewestFile       time.Time
@@ -35,17 +47,23 @@ type IndexStats struct {
 	RecentFiles      []FileRecord
 	SizeDistribution []SizeRange
 	YearDistribution []YearStats
+	TopOwners        []OwnerStats
+	TopGroups        []OwnerStats
 }
 
 type GlobalStats struct {
 	TotalFiles       int64
 	TotalDirs        int64
 	TotalSize        int64
+	UniqueSize       int64
+	DiskUsage        int64
 	IndexCount       int
 	TopExtensions    []ExtensionStats
 	TopExtBySize     []ExtensionStats
 	SizeDistribution []SizeRange
 	YearDistribution []YearStats
+	TopOwners        []OwnerStats
+	TopGroups        []OwnerStats
 	IndexStats       []IndexStats
 }
 
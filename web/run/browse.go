@@ -53,6 +53,17 @@ func (webapp *WebApp) browse() http.HandlerFunc {
 			return
 		}
 
+		// Searches in this folder are scoped by its full path
+		scope := ""
+		if path != "" {
+			dirPath, ok, err := searcher.DirPath(index, path)
+			if err != nil {
+				log.Printf("Unable to resolve dir %s in index %s: %v\n", path, index, err)
+			} else if ok {
+				scope = dirPath
+			}
+		}
+
 		var breadcrumbs []Breadcrumb
 		var pathParts []string
 		if path != "" {
@@ -75,6 +86,7 @@ func (webapp *WebApp) browse() http.HandlerFunc {
 		data["Index"] = index
 		data["Breadcrumbs"] = breadcrumbs
 		data["DirInfo"] = currentDirInfo
+		data["Scope"] = scope
 
 		err = webapp.TemplateCache["browse.html"].Execute(w, data)
 		if err != nil {
@@ -0,0 +1,98 @@
+package webapp
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/ogefest/findex/app"
+	"github.com/ogefest/findex/models"
+)
+
+// changesLimit caps the number of changes listed for one scan
+const changesLimit = 1000
+
+func (webapp *WebApp) changes() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		searcher, err := app.NewSearcher(webapp.IndexConfig)
+		if err != nil {
+			log.Printf("Unable to create searcher: %v\n", err)
+			webapp.renderError(w, http.StatusInternalServerError, "")
+			return
+		}
+		defer searcher.Close()
+
+		selectedIndex := r.URL.Query().Get("index")
+		if selectedIndex == "" && len(webapp.IndexConfig) > 0 {
+			selectedIndex = webapp.IndexConfig[0].Name
+		}
+		if selectedIndex != "" && webapp.getIndexByName(selectedIndex) == nil {
+			webapp.renderError(w, http.StatusNotFound, "Index not found")
+			return
+		}
+
+		kind := r.URL.Query().Get("kind")
+		switch kind {
+		case "", models.ChangeAdded, models.ChangeRemoved, models.ChangeModified, models.ChangeMoved:
+		default:
+			kind = ""
+		}
+
+		var scans []models.ChangeSummary
+		var selectedScan *models.ChangeSummary
+		var changes []models.FileChange
+		if selectedIndex != "" {
+			scans, err = searcher.GetChangeSummaries(selectedIndex, 30)
+			if err != nil {
+				log.Printf("Unable to get change summaries: %v\n", err)
+				webapp.renderError(w, http.StatusInternalServerError, "")
+				return
+			}
+
+			// Latest scan unless another one was picked
+			if len(scans) > 0 {
+				selectedScan = &scans[0]
+			}
+			if scanID, err := strconv.ParseInt(r.URL.Query().Get("scan"), 10, 64); err == nil {
+				for i := range scans {
+					if scans[i].ScanID == scanID {
+						selectedScan = &scans[i]
+					}
+				}
+			}
+
+			if selectedScan != nil {
+				changes, err = searcher.GetChanges(selectedIndex, selectedScan.ScanID, kind, changesLimit)
+				if err != nil {
+					log.Printf("Unable to get changes: %v\n", err)
+					webapp.renderError(w, http.StatusInternalServerError, "")
+					return
+				}
+			}
+		}
+
+		data := webapp.newTplData()
+		data["Title"] = "What changed"
+		data["IndexNames"] = indexNames(webapp.IndexConfig)
+		data["SelectedIndex"] = selectedIndex
+		data["Scans"] = scans
+		data["SelectedScan"] = selectedScan
+		data["Kind"] = kind
+		data["Changes"] = changes
+		data["Truncated"] = len(changes) == changesLimit
+
+		err = webapp.TemplateCache["changes.html"].Execute(w, data)
+		if err != nil {
+			log.Printf("Template error: %v\n", err)
+			webapp.renderError(w, http.StatusInternalServerError, "")
+		}
+	}
+}
+
+func indexNames(indexes []*models.IndexConfig) []string {
+	names := make([]string, 0, len(indexes))
+	for _, idx := range indexes {
+		names = append(names, idx.Name)
+	}
+	return names
+}
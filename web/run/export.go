@@ -0,0 +1,73 @@
+package webapp
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/ogefest/findex/app"
+	"github.com/ogefest/findex/models"
+)
+
+// exportTypes maps export formats to their content type and file extension
+var exportTypes = map[string]struct{ contentType, ext string }{
+	app.FormatNDJSON: {"application/x-ndjson", "ndjson"},
+	app.FormatCSV:    {"text/csv; charset=utf-8", "csv"},
+	app.FormatSQLite: {"application/vnd.sqlite3", "db"},
+}
+
+// export streams the selected indexes, or the files matching the search
+// form parameters, as a download
+func (webapp *WebApp) export() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = app.FormatNDJSON
+		}
+		exportType, ok := exportTypes[format]
+		if !ok {
+			webapp.renderError(w, http.StatusBadRequest, "Unknown export format")
+			return
+		}
+
+		query := r.URL.Query().Get("q")
+		filter := parseFilterParams(r)
+
+		var indexes []*models.IndexConfig
+		for _, name := range r.URL.Query()["index[]"] {
+			idx := webapp.getIndexByName(name)
+			if idx == nil {
+				webapp.renderError(w, http.StatusNotFound, "Index not found")
+				return
+			}
+			indexes = append(indexes, idx)
+		}
+		if len(indexes) == 0 {
+			indexes = webapp.IndexConfig
+		}
+
+		searcher, err := app.NewSearcher(indexes)
+		if err != nil {
+			log.Printf("Unable to create searcher: %v\n", err)
+			webapp.renderError(w, http.StatusInternalServerError, "")
+			return
+		}
+		defer searcher.Close()
+
+		if err := searcher.CheckSearch(query, filter); err != nil {
+			webapp.renderError(w, http.StatusBadRequest, "Invalid search: "+err.Error())
+			return
+		}
+
+		w.Header().Set("Content-Type", exportType.contentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="findex-export.%s"`, exportType.ext))
+
+		// Headers are gone once rows are streamed, errors can only be logged
+		count, err := searcher.Export(w, format, query, filter)
+		if err != nil {
+			log.Printf("Export error after %d entries: %v\n", count, err)
+			return
+		}
+		log.Printf("Exported %d entries as %s\n", count, format)
+	}
+}
@@ -2,15 +2,18 @@ package webapp
 
 import (
 	"database/sql"
-	"hash/crc32"
+	"html"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/ogefest/findex/app"
 	"github.com/ogefest/findex/models"
 	_ "modernc.org/sqlite"
 )
@@ -31,46 +34,7 @@ func setupTestWebApp(t *testing.T) (*WebApp, string, func()) {
 		t.Fatalf("failed to open db: %v", err)
 	}
 
-	schema := `
-		CREATE TABLE IF NOT EXISTS files (
-			id INTEGER PRIMARY KEY,
-			index_name TEXT,
-			path TEXT NOT NULL UNIQUE,
-			name TEXT,
-			dir TEXT,
-			dir_index INTEGER,
-			ext TEXT,
-			size INTEGER,
-			mod_time INTEGER,
-			is_dir INTEGER,
-			is_searchable INTEGER DEFAULT 0
-		);
-
-		CREATE TABLE IF NOT EXISTS metadata (
-			key TEXT PRIMARY KEY,
-			value TEXT
-		);
-
-		CREATE TABLE IF NOT EXISTS dir_sizes (
-			path TEXT PRIMARY KEY,
-			total_size INTEGER,
-			file_count INTEGER
-		);
-
-		CREATE TABLE IF NOT EXISTS scan_history (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			scan_time INTEGER NOT NULL,
-			stats_json TEXT NOT NULL
-		);
-
-		CREATE INDEX IF NOT EXISTS idx_scan_history_time ON scan_history(scan_time DESC);
-
-		CREATE VIRTUAL TABLE IF NOT EXISTS files_fts USING fts5(name, path, tokenize = 'unicode61');
-
-		CREATE INDEX IF NOT EXISTS idx_files_path ON files(path);
-		CREATE INDEX IF NOT EXISTS idx_dir_index ON files(dir_index);
-	`
-	if _, err := db.Exec(schema); err != nil {
+	if err := app.RunMigrations(db); err != nil {
 		db.Close()
 		os.RemoveAll(tmpDir)
 		t.Fatalf("failed to run migrations: %v", err)
@@ -99,6 +63,30 @@ func setupTestWebApp(t *testing.T) (*WebApp, string, func()) {
 	return webapp, dbPath, cleanup
 }
 
+// insertTestDir returns the dirs id of dir, creating it and its ancestors up to root
+func insertTestDir(t *testing.T, db *sql.DB, dir, root string) int64 {
+	t.Helper()
+
+	var id int64
+	if err := db.QueryRow(`SELECT id FROM dirs WHERE path = ?`, dir).Scan(&id); err == nil {
+		return id
+	}
+
+	var parentID, rootID any
+	name := dir
+	if dir != root {
+		parentID = insertTestDir(t, db, filepath.Dir(dir), root)
+		rootID = insertTestDir(t, db, root, root)
+		name = filepath.Base(dir)
+	}
+	result, err := db.Exec(`INSERT INTO dirs(path, name, parent_id, root_id) VALUES (?, ?, ?, ?)`, dir, name, parentID, rootID)
+	if err != nil {
+		t.Fatalf("failed to insert test dir %s: %v", dir, err)
+	}
+	id, _ = result.LastInsertId()
+	return id
+}
+
 func insertTestData(t *testing.T, db *sql.DB, indexName string) {
 	t.Helper()
 
@@ -130,25 +118,31 @@ func insertTestData(t *testing.T, db *sql.DB, indexName string) {
 		if f.isDir {
 			isDir = 1
 		}
-		// Calculate dir_index same way as in source_local.go - hash of parent directory
-		parentDir := filepath.Dir(f.path)
-		dirIndex := int64(crc32.ChecksumIEEE([]byte(filepath.Clean(parentDir))))
+		// Register the parent directory the same way the scanner does
+		parentID := insertTestDir(t, db, filepath.Dir(f.path), root)
+		if f.isDir {
+			insertTestDir(t, db, f.path, root)
+		}
 
 		result, err := db.Exec(`
-			INSERT INTO files(path, name, dir, ext, size, mod_time, is_dir, is_searchable, index_name, dir_index)
-			VALUES (?, ?, ?, ?, ?, ?, ?, 2, ?, ?)
-		`, f.path, f.name, f.dir, f.ext, f.size, f.modTime.Unix(), isDir, indexName, dirIndex)
+			INSERT INTO files(parent_id, name, ext, size, mod_time, is_dir, is_searchable, index_name)
+			VALUES (?, ?, ?, ?, ?, ?, 2, ?)
+		`, parentID, f.name, f.ext, f.size, f.modTime.Unix(), isDir, indexName)
 		if err != nil {
 			t.Fatalf("failed to insert test file %s: %v", f.path, err)
 		}
 
 		id, _ := result.LastInsertId()
-		_, err = db.Exec(`INSERT INTO files_fts(rowid, name, path) VALUES (?, ?, ?)`, id, f.name, f.path)
+		_, err = db.Exec(`INSERT INTO files_fts(rowid, name, dir) VALUES (?, ?, ?)`, id, f.name, filepath.Dir(f.path))
 		if err != nil {
 			t.Fatalf("failed to insert into FTS: %v", err)
 		}
 	}
 
+	// Ownership: documents belong to alice, everything else to bob
+	db.Exec(`UPDATE files SET uid = 1000, gid = 100, owner_name = 'alice', group_name = 'staff' WHERE parent_id = (SELECT id FROM dirs WHERE path = ?)`, root+"/documents")
+	db.Exec(`UPDATE files SET uid = 1001, gid = 100, owner_name = 'bob', group_name = 'staff' WHERE uid IS NULL AND is_dir = 0`)
+
 	// Insert dir_sizes cache
 	db.Exec(`INSERT INTO dir_sizes(path, total_size, file_count) VALUES (?, ?, ?)`, root+"/documents", 1024*1024+512, 2)
 	db.Exec(`INSERT INTO dir_sizes(path, total_size, file_count) VALUES (?, ?, ?)`, root+"/images", 7*1024*1024, 2)
@@ -327,6 +321,62 @@ func TestStartPage_FilterByExtension(t *testing.T) {
 	}
 }
 
+// Test filter by owner and group
+func TestStartPage_FilterByOwner(t *testing.T) {
+	webapp, _, cleanup := setupTestWebApp(t)
+	defer cleanup()
+
+	tests := []struct {
+		name          string
+		query         string
+		shouldContain []string
+		shouldNotFind []string
+	}{
+		{
+			name:          "owner by name",
+			query:         "?owner=alice&index[]=test-index",
+			shouldContain: []string{"report.pdf", "notes.txt"},
+			shouldNotFind: []string{"photo.jpg", "movie.mp4"},
+		},
+		{
+			name:          "owner by uid",
+			query:         "?owner=1001&index[]=test-index",
+			shouldContain: []string{"photo.jpg", "movie.mp4"},
+			shouldNotFind: []string{"report.pdf"},
+		},
+		{
+			name:          "group",
+			query:         "?group=staff&index[]=test-index",
+			shouldContain: []string{"report.pdf", "movie.mp4"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/"+tt.query, nil)
+			rec := httptest.NewRecorder()
+
+			webapp.Router.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Errorf("expected status 200, got %d", rec.Code)
+			}
+
+			body := rec.Body.String()
+			for _, s := range tt.shouldContain {
+				if !strings.Contains(body, s) {
+					t.Errorf("response should contain %q", s)
+				}
+			}
+			for _, s := range tt.shouldNotFind {
+				if strings.Contains(body, s) {
+					t.Errorf("response should not contain %q", s)
+				}
+			}
+		})
+	}
+}
+
 // Test filter by type (files/dirs)
 func TestStartPage_FilterByType(t *testing.T) {
 	webapp, _, cleanup := setupTestWebApp(t)
@@ -376,6 +426,208 @@ func TestStartPage_FilterByType(t *testing.T) {
 	}
 }
 
+// Test searching tombstones of deleted files
+func TestStartPage_IncludeDeleted(t *testing.T) {
+	webapp, dbPath, cleanup := setupTestWebApp(t)
+	defer cleanup()
+
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	lastSeen := time.Date(2026, 3, 14, 12, 0, 0, 0, time.Local)
+	result, err := db.Exec(`INSERT INTO tombstones(index_name, root, dir, name, ext, size, mod_time, last_seen) VALUES ('test-index', '/testroot', '/testroot/documents', 'oldreport.pdf', '.pdf', 100, ?, ?)`,
+		lastSeen.Unix(), lastSeen.Unix())
+	if err != nil {
+		t.Fatalf("failed to insert tombstone: %v", err)
+	}
+	id, _ := result.LastInsertId()
+	db.Exec(`INSERT INTO tombstones_fts(rowid, name, dir) VALUES (?, 'oldreport.pdf', '/testroot/documents')`, id)
+	db.Close()
+
+	tests := []struct {
+		name          string
+		query         string
+		shouldContain []string
+		shouldNotFind []string
+	}{
+		{
+			name:          "hidden by default",
+			query:         "?q=oldreport&index[]=test-index",
+			shouldNotFind: []string{"oldreport.pdf"},
+		},
+		{
+			name:          "included on request",
+			query:         "?q=oldreport&deleted=1&index[]=test-index",
+			shouldContain: []string{"oldreport.pdf", "deleted", "last seen 2026-03-14"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/"+tt.query, nil)
+			rec := httptest.NewRecorder()
+
+			webapp.Router.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Errorf("expected status 200, got %d", rec.Code)
+			}
+
+			body := rec.Body.String()
+			for _, s := range tt.shouldContain {
+				if !strings.Contains(body, s) {
+					t.Errorf("response should contain %q", s)
+				}
+			}
+			for _, s := range tt.shouldNotFind {
+				if strings.Contains(body, s) {
+					t.Errorf("response should not contain %q", s)
+				}
+			}
+		})
+	}
+}
+
+// Test that a query that cannot be parsed explains why
+func TestStartPage_QueryError(t *testing.T) {
+	webapp, _, cleanup := setupTestWebApp(t)
+	defer cleanup()
+
+	req := httptest.NewRequest(http.MethodGet, "/?q=size%3A%3Elots&index[]=test-index", nil)
+	rec := httptest.NewRecorder()
+	webapp.Router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected status 200, got %d", rec.Code)
+	}
+	body := rec.Body.String()
+	if !strings.Contains(body, "Invalid search: size:") {
+		t.Errorf("response should explain the parse error")
+	}
+	if strings.Contains(body, "No results found") {
+		t.Errorf("response should not claim there are no results")
+	}
+}
+
+// Test that substring search explains a missing trigram index
+func TestStartPage_MatchModeWithoutTrigramIndex(t *testing.T) {
+	webapp, _, cleanup := setupTestWebApp(t)
+	defer cleanup()
+
+	req := httptest.NewRequest(http.MethodGet, "/?q=report&match=substring&index[]=test-index", nil)
+	rec := httptest.NewRecorder()
+	webapp.Router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected status 200, got %d", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), "trigram_index") {
+		t.Errorf("response should mention trigram_index")
+	}
+}
+
+// An index that fails is named in a banner, the others still answer
+func TestStartPage_FailedIndex(t *testing.T) {
+	webapp, _, cleanup := setupTestWebApp(t)
+	defer cleanup()
+
+	brokenPath := filepath.Join(t.TempDir(), "broken.db")
+	db, err := sql.Open("sqlite", brokenPath)
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	if err := app.RunMigrations(db); err != nil {
+		t.Fatalf("failed to run migrations: %v", err)
+	}
+	db.Exec(`DROP TABLE files_fts`)
+	db.Close()
+	webapp.IndexConfig = append(webapp.IndexConfig, &models.IndexConfig{Name: "broken-index", DBPath: brokenPath})
+
+	req := httptest.NewRequest(http.MethodGet, "/?q=report&index[]=test-index&index[]=broken-index", nil)
+	rec := httptest.NewRecorder()
+	webapp.Router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+	body := rec.Body.String()
+	for _, s := range []string{"Results are incomplete", "broken-index", "report.pdf"} {
+		if !strings.Contains(body, s) {
+			t.Errorf("response should contain %q", s)
+		}
+	}
+	timing := rec.Header().Get("Server-Timing")
+	if !strings.Contains(timing, `desc="test-index"`) || !strings.Contains(timing, `desc="broken-index"`) {
+		t.Errorf("expected both indexes in Server-Timing, got %q", timing)
+	}
+}
+
+// Facets link to the search narrowed to their value
+func TestStartPage_Facets(t *testing.T) {
+	webapp, _, cleanup := setupTestWebApp(t)
+	defer cleanup()
+
+	get := func(query string) string {
+		req := httptest.NewRequest(http.MethodGet, "/"+query, nil)
+		rec := httptest.NewRecorder()
+		webapp.Router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", rec.Code)
+		}
+		return rec.Body.String()
+	}
+
+	body := get("?type=files&index[]=test-index")
+	for _, s := range []string{
+		"ext=mp4", "in=%2Ftestroot%2Fdocuments", "/testroot/images", "index%5B%5D=test-index",
+		"min_size=1048576", "under 1MB",
+	} {
+		if !strings.Contains(body, s) {
+			t.Errorf("response should contain facet %q", s)
+		}
+	}
+
+	body = get("?type=files&in=%2Ftestroot%2Fdocuments&index[]=test-index")
+	if !strings.Contains(body, "report.pdf") || !strings.Contains(body, "notes.txt") {
+		t.Error("expected the files of the documents folder")
+	}
+	if strings.Contains(body, "photo.jpg") || strings.Contains(body, "movie.mp4") {
+		t.Error("expected no files outside the documents folder")
+	}
+}
+
+// Matched terms are marked in names and paths
+func TestStartPage_Highlight(t *testing.T) {
+	webapp, _, cleanup := setupTestWebApp(t)
+	defer cleanup()
+
+	for _, tt := range []struct {
+		query    string
+		expected string
+	}{
+		{"rep", "<mark>rep</mark>ort.pdf"},
+		{"path:documents notes", "<mark>documents</mark></a>"},
+		{"path:documents notes", "<mark>notes</mark>.txt"},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/?index[]=test-index&q="+url.QueryEscape(tt.query), nil)
+		rec := httptest.NewRecorder()
+		webapp.Router.ServeHTTP(rec, req)
+
+		if body := rec.Body.String(); !strings.Contains(body, tt.expected) {
+			t.Errorf("results of %q should contain %q", tt.query, tt.expected)
+		}
+	}
+}
+
+func TestHighlight_Escapes(t *testing.T) {
+	got := highlight(`<a href="x">b&c`, []models.Span{{Start: 0, End: 2}, {Start: 12, End: 14}})
+	expected := `<mark>&lt;a</mark> href=&#34;x&#34;&gt;<mark>b&amp;</mark>c`
+	if string(got) != expected {
+		t.Errorf("highlight = %s, expected %s", got, expected)
+	}
+}
+
 // Test pagination
 func TestStartPage_Pagination(t *testing.T) {
 	webapp, _, cleanup := setupTestWebApp(t)
@@ -415,6 +667,96 @@ func TestStartPage_Pagination(t *testing.T) {
 			}
 		})
 	}
+
+	// Following the next links visits every file once
+	t.Run("next links", func(t *testing.T) {
+		nextCursor := regexp.MustCompile(`cursor=([A-Za-z0-9_-]+)`)
+		files := []string{"report.pdf", "notes.txt", "photo.jpg", "screenshot.png", "movie.mp4"}
+		seen := map[string]int{}
+		query := "?type=files&index[]=test-index&per_page=2"
+		for pages := 1; ; pages++ {
+			req := httptest.NewRequest(http.MethodGet, "/"+query, nil)
+			rec := httptest.NewRecorder()
+			webapp.Router.ServeHTTP(rec, req)
+
+			body := rec.Body.String()
+			if !strings.Contains(body, "Found <strong>5</strong> results") {
+				t.Fatalf("page %d should show the total of 5 results", pages)
+			}
+			for _, name := range files {
+				if strings.Contains(body, name) {
+					seen[name]++
+				}
+			}
+			// The next link has the last cursor of a page, the last page
+			// only has the previous link
+			m := nextCursor.FindAllStringSubmatch(body, -1)
+			if pages == 3 {
+				if len(m) != 1 {
+					t.Fatalf("expected only a previous link on the last page, got %d cursors", len(m))
+				}
+				break
+			}
+			if len(m) == 0 {
+				t.Fatalf("page %d has no next link", pages)
+			}
+			query = "?type=files&index[]=test-index&per_page=2&cursor=" + m[len(m)-1][1]
+		}
+		for _, name := range files {
+			if seen[name] != 1 {
+				t.Errorf("%s shown on %d pages, expected 1", name, seen[name])
+			}
+		}
+	})
+
+	t.Run("invalid cursor starts over", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/?type=files&index[]=test-index&per_page=2&cursor=bogus&page=7", nil)
+		rec := httptest.NewRecorder()
+		webapp.Router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Page 1 of 3") {
+			t.Errorf("expected the first page, got status %d", rec.Code)
+		}
+	})
+}
+
+func TestStartPage_Sort(t *testing.T) {
+	webapp, _, cleanup := setupTestWebApp(t)
+	defer cleanup()
+
+	tests := []struct {
+		query    string
+		expected []string
+	}{
+		{"?type=files&index[]=test-index&sort=size", []string{"movie.mp4", "photo.jpg", "screenshot.png", "report.pdf", "notes.txt"}},
+		{"?type=files&index[]=test-index&sort=size&order=asc", []string{"notes.txt", "report.pdf", "screenshot.png", "photo.jpg", "movie.mp4"}},
+		{"?type=files&index[]=test-index&sort=name", []string{"movie.mp4", "notes.txt", "photo.jpg", "report.pdf", "screenshot.png"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/"+tt.query, nil)
+			rec := httptest.NewRecorder()
+
+			webapp.Router.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d", rec.Code)
+			}
+			// The desktop table lists the results first
+			body := rec.Body.String()
+			last := -1
+			for _, name := range tt.expected {
+				pos := strings.Index(body, name)
+				if pos <= last {
+					t.Fatalf("expected %s after the previous result, results should be %v", name, tt.expected)
+				}
+				last = pos
+			}
+			if !strings.Contains(body, `name="sort" value="`) {
+				t.Error("expected the search form to keep the sort")
+			}
+		})
+	}
 }
 
 // Test browse endpoint
@@ -476,6 +818,47 @@ func TestBrowse(t *testing.T) {
 	}
 }
 
+// The browse page searches in the folder it shows, and the scope stays on
+// every page of the results
+func TestBrowse_SearchInFolder(t *testing.T) {
+	webapp, _, cleanup := setupTestWebApp(t)
+	defer cleanup()
+
+	get := func(path string) string {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		rec := httptest.NewRecorder()
+		webapp.Router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s: expected status 200, got %d", path, rec.Code)
+		}
+		return rec.Body.String()
+	}
+
+	body := get("/browse/test-index?path=documents")
+	if !strings.Contains(body, `type="hidden" name="in" value="/testroot/documents"`) {
+		t.Error("browse form should scope the search to the full folder path")
+	}
+	if body := get("/browse/test-index"); strings.Contains(body, `type="hidden" name="in"`) {
+		t.Error("browse root should search the whole index")
+	}
+
+	body = get("/?in=%2Ftestroot%2Fimages&index[]=test-index&per_page=1")
+	if !strings.Contains(body, "Searching in") || strings.Contains(body, "report.pdf") {
+		t.Error("expected results of the images folder only")
+	}
+	next := regexp.MustCompile(`href="\?([^"]*cursor=[^"]*)"`).FindStringSubmatch(body)
+	if next == nil || !strings.Contains(next[1], "in=%2Ftestroot%2Fimages") {
+		t.Fatalf("expected a next page link keeping the scope, got %v", next)
+	}
+	body = get("/?" + html.UnescapeString(next[1]))
+	if strings.Contains(body, "report.pdf") || strings.Contains(body, "movie.mp4") {
+		t.Error("expected the next page to stay in the images folder")
+	}
+	if !strings.Contains(body, `href="?index%5B%5D=test-index&amp;per_page=1"`) {
+		t.Error("expected a search everywhere link dropping the scope")
+	}
+}
+
 // Test stats endpoint
 func TestStats(t *testing.T) {
 	webapp, _, cleanup := setupTestWebApp(t)
@@ -496,6 +879,8 @@ func TestStats(t *testing.T) {
 	expectedContent := []string{
 		"Statistics",
 		"test-index",
+		"Top Owners",
+		"alice",
 	}
 
 	for _, expected := range expectedContent {
@@ -505,6 +890,85 @@ func TestStats(t *testing.T) {
 	}
 }
 
+// Test change journal page
+func TestChanges(t *testing.T) {
+	webapp, dbPath, cleanup := setupTestWebApp(t)
+	defer cleanup()
+
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	db.Exec(`INSERT INTO scan_history(id, scan_time, stats_json) VALUES (1, ?, '{}'), (2, ?, '{}')`, time.Now().Add(-time.Hour).Unix(), time.Now().Unix())
+	db.Exec(`INSERT INTO changes(scan_id, kind, dir, name, size, mod_time) VALUES (2, 'added', '/testroot/images', 'new.png', 2048, ?)`, time.Now().Unix())
+	db.Exec(`INSERT INTO changes(scan_id, kind, dir, name, old_dir, size, old_size, mod_time, old_mod_time) VALUES (2, 'moved', '/testroot/videos', 'clip.mp4', '/testroot/old', 10, 10, 0, 0)`)
+	db.Close()
+
+	tests := []struct {
+		name     string
+		url      string
+		expected []string
+		absent   []string
+	}{
+		{"latest scan", "/changes", []string{"What changed", "/testroot/images/new.png", "/testroot/old/clip.mp4", "Added (1)"}, nil},
+		{"filtered by kind", "/changes?index=test-index&scan=2&kind=moved", []string{"/testroot/videos/clip.mp4"}, []string{"new.png"}},
+		{"scan without changes", "/changes?index=test-index&scan=1", []string{"No changes compared to the previous scan"}, []string{"new.png"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			rec := httptest.NewRecorder()
+
+			webapp.Router.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d", rec.Code)
+			}
+			body := rec.Body.String()
+			for _, expected := range tt.expected {
+				if !strings.Contains(body, expected) {
+					t.Errorf("changes page should contain %q", expected)
+				}
+			}
+			for _, absent := range tt.absent {
+				if strings.Contains(body, absent) {
+					t.Errorf("changes page should not contain %q", absent)
+				}
+			}
+		})
+	}
+}
+
+// Test export endpoint
+func TestExport(t *testing.T) {
+	webapp, _, cleanup := setupTestWebApp(t)
+	defer cleanup()
+
+	req := httptest.NewRequest(http.MethodGet, "/export?format=csv&ext=pdf&index[]=test-index", nil)
+	rec := httptest.NewRecorder()
+
+	webapp.Router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/csv") {
+		t.Errorf("unexpected content type %q", ct)
+	}
+	lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "index_name,") || !strings.Contains(lines[1], "/testroot/documents/report.pdf") {
+		t.Errorf("expected header and report.pdf, got %q", rec.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/export?format=xml", nil)
+	rec = httptest.NewRecorder()
+	webapp.Router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for an unknown format, got %d", rec.Code)
+	}
+}
+
 // Test 404 for non-existent routes
 func TestNotFound(t *testing.T) {
 	webapp, _, cleanup := setupTestWebApp(t)
@@ -13,6 +13,8 @@ func router(webapp *WebApp) http.Handler {
 
 	r.Get("/", webapp.startPage())
 	r.Get("/stats", webapp.stats())
+	r.Get("/changes", webapp.changes())
+	r.Get("/export", webapp.export())
 	r.Get("/download/{index}-{id}", webapp.download())
 	r.Get("/browse/{index}", webapp.browse())
 
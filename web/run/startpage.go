@@ -1,11 +1,14 @@
 package webapp
 
 import (
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
-	"time"
+	"sync"
 
 	"github.com/ogefest/findex/app"
 	"github.com/ogefest/findex/models"
@@ -58,59 +61,91 @@ func (webapp *WebApp) startPage() http.HandlerFunc {
 				return
 			}
 			defer searcher.Close()
-
-			// Get more results for pagination
-			allResults, err := searcher.Search(query, filter, 1000)
-			if err != nil {
-				log.Printf("Search error: %v\n", err)
+			if webapp.AppConfig != nil {
+				searcher.Timeout = webapp.AppConfig.Server.SearchTimeout
 			}
 
-			totalResults := len(allResults)
-			totalPages := (totalResults + perPage - 1) / perPage
-			if totalPages < 1 {
-				totalPages = 1
+			// The total and the facets do not depend on the page, they are
+			// counted while the page is searched
+			var count app.Count
+			var facets *app.Facets
+			var wg sync.WaitGroup
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				c, err := searcher.Count(r.Context(), query, filter)
+				if err != nil {
+					log.Printf("Count error: %v\n", err)
+				} else {
+					count = c
+				}
+			}()
+			go func() {
+				defer wg.Done()
+				f, err := searcher.Facets(r.Context(), query, filter)
+				if err != nil {
+					log.Printf("Facets error: %v\n", err)
+				}
+				facets = f
+			}()
+
+			cursor := r.URL.Query().Get("cursor")
+			if cursor == "" {
+				page = 1
 			}
-			if page > totalPages {
-				page = totalPages
+			results, err := searcher.SearchPage(r.Context(), query, filter, cursor, perPage)
+			if errors.Is(err, app.ErrInvalidCursor) {
+				// A link from before the cursor format changed, start over
+				page = 1
+				results, err = searcher.SearchPage(r.Context(), query, filter, "", perPage)
 			}
-
-			// Paginate results
-			start := (page - 1) * perPage
-			end := start + perPage
-			if start > totalResults {
-				start = totalResults
+			var queryErr *app.QueryError
+			if errors.As(err, &queryErr) || errors.Is(err, app.ErrNoTrigramIndex) {
+				data["QueryError"] = err.Error()
+			} else if err != nil {
+				log.Printf("Search error: %v\n", err)
 			}
-			if end > totalResults {
-				end = totalResults
+			if results == nil {
+				results = &app.Page{}
 			}
 
-			var paginatedResults []models.FileRecord
-			if start < totalResults {
-				paginatedResults = allResults[start:end]
+			wg.Wait()
+			if len(results.Results) == 0 {
+				count, facets = app.Count{}, nil
+			}
+			for _, st := range app.FailedIndexes(results.Indexes) {
+				log.Printf("Index %s left out of the search: %v\n", st.Index, st.Err)
+			}
+			var facetIndexes []app.IndexStatus
+			if facets != nil {
+				facetIndexes = facets.Indexes
+			}
+			setServerTiming(w, results.Indexes, count.Indexes, facetIndexes)
+			totalPages := int((count.Total + int64(perPage) - 1) / int64(perPage))
+			if totalPages < page {
+				totalPages = page
 			}
 
-			log.Printf("Found %d total results, showing page %d (%d-%d)\n", totalResults, page, start+1, end)
+			log.Printf("Found %d total results (exact %v), showing page %d\n", count.Total, count.Exact, page)
 
-			data["Results"] = paginatedResults
-			data["TotalResults"] = totalResults
+			data["Results"] = results.Results
+			data["TotalResults"] = count.Total
+			data["TotalExact"] = count.Exact
 			data["TotalPages"] = totalPages
 			data["CurrentPage"] = page
 			data["HasSearch"] = true
-			data["HasPrevPage"] = page > 1
-			data["HasNextPage"] = page < totalPages
+			data["HasPrevPage"] = results.Prev != ""
+			data["HasNextPage"] = results.Next != ""
+			data["PrevCursor"] = results.Prev
+			data["NextCursor"] = results.Next
 			data["PrevPage"] = page - 1
 			data["NextPage"] = page + 1
-
-			// Generate page numbers for pagination
-			var pages []int
-			for i := 1; i <= totalPages; i++ {
-				if i == 1 || i == totalPages || (i >= page-2 && i <= page+2) {
-					pages = append(pages, i)
-				} else if len(pages) > 0 && pages[len(pages)-1] != -1 {
-					pages = append(pages, -1) // -1 represents "..."
-				}
-			}
-			data["Pages"] = pages
+			data["FailedIndexes"] = app.FailedIndexes(results.Indexes)
+			data["DeletedSkipped"] = results.DeletedSkipped
+			data["IndexTimings"] = results.Indexes
+			data["Facets"] = facets
+			data["ScopeDir"] = filter.InDir
+			data["ScopeClear"] = url.Values{"in": nil}
 		}
 
 		err := webapp.TemplateCache["startpage.html"].Execute(w, data)
@@ -121,101 +156,50 @@ func (webapp *WebApp) startPage() http.HandlerFunc {
 	}
 }
 
+// setServerTiming reports how long every index took to search, count and
+// break down by facet in the Server-Timing header, which browser developer
+// tools show per request
+func setServerTiming(w http.ResponseWriter, search, count, facets []app.IndexStatus) {
+	var metrics []string
+	for _, m := range []struct {
+		name     string
+		statuses []app.IndexStatus
+	}{{"search", search}, {"count", count}, {"facets", facets}} {
+		for i, st := range m.statuses {
+			metrics = append(metrics, fmt.Sprintf("%s-%d;desc=%q;dur=%.1f",
+				m.name, i, st.Index, float64(st.Duration.Microseconds())/1000))
+		}
+	}
+	if len(metrics) > 0 {
+		w.Header().Set("Server-Timing", strings.Join(metrics, ", "))
+	}
+}
+
 func hasActiveFilters(filter *app.FileFilter) bool {
 	if filter == nil {
 		return false
 	}
 	return filter.MinSize > 0 ||
 		filter.MaxSize > 0 ||
+		filter.HasMaxSize ||
 		len(filter.Exts) > 0 ||
 		filter.ModTimeFrom > 0 ||
 		filter.ModTimeTo > 0 ||
 		filter.OnlyFiles ||
-		filter.OnlyDirs
+		filter.OnlyDirs ||
+		filter.OnlyLinks ||
+		filter.Owner != "" ||
+		filter.Group != "" ||
+		filter.InDir != ""
 }
 
 func parseFilterParams(r *http.Request) *app.FileFilter {
-	filter := &app.FileFilter{}
-
-	// Parse size filters
-	if minSize := r.URL.Query().Get("min_size"); minSize != "" {
-		if val, err := parseSize(minSize); err == nil {
-			filter.MinSize = val
-		}
-	}
-	if maxSize := r.URL.Query().Get("max_size"); maxSize != "" {
-		if val, err := parseSize(maxSize); err == nil {
-			filter.MaxSize = val
-		}
-	}
-
-	// Parse extension filter
-	if exts := r.URL.Query().Get("ext"); exts != "" {
-		extList := strings.Split(exts, ",")
-		for _, ext := range extList {
-			ext = strings.TrimSpace(ext)
-			if ext != "" {
-				filter.Exts = append(filter.Exts, ext)
-			}
-		}
-	}
-
-	// Parse date filters
-	if dateFrom := r.URL.Query().Get("date_from"); dateFrom != "" {
-		if t, err := time.Parse("2006-01-02", dateFrom); err == nil {
-			filter.ModTimeFrom = t.Unix()
-		}
-	}
-	if dateTo := r.URL.Query().Get("date_to"); dateTo != "" {
-		if t, err := time.Parse("2006-01-02", dateTo); err == nil {
-			// End of day
-			filter.ModTimeTo = t.Add(24*time.Hour - time.Second).Unix()
-		}
-	}
-
-	// Parse type filter
-	fileType := r.URL.Query().Get("type")
-	if fileType == "files" {
-		filter.OnlyFiles = true
-	} else if fileType == "dirs" {
-		filter.OnlyDirs = true
-	}
-
-	return filter
+	return app.ParseFilter(r.URL.Query())
 }
 
 // parseSize parses size string like "10MB", "1GB", "500KB" to bytes
 func parseSize(s string) (int64, error) {
-	s = strings.ToUpper(strings.TrimSpace(s))
-	if s == "" {
-		return 0, nil
-	}
-
-	// Order matters - check longer suffixes first
-	suffixes := []struct {
-		suffix string
-		mult   int64
-	}{
-		{"TB", 1024 * 1024 * 1024 * 1024},
-		{"GB", 1024 * 1024 * 1024},
-		{"MB", 1024 * 1024},
-		{"KB", 1024},
-		{"B", 1},
-	}
-
-	for _, s2 := range suffixes {
-		if strings.HasSuffix(s, s2.suffix) {
-			numStr := strings.TrimSuffix(s, s2.suffix)
-			num, err := strconv.ParseFloat(numStr, 64)
-			if err != nil {
-				return 0, err
-			}
-			return int64(num * float64(s2.mult)), nil
-		}
-	}
-
-	// Try plain number (assume bytes)
-	return strconv.ParseInt(s, 10, 64)
+	return app.ParseSize(s)
 }
 
 // getFilterParamsForTemplate returns filter values for form inputs
@@ -227,5 +211,12 @@ func getFilterParamsForTemplate(r *http.Request) map[string]string {
 		"date_from": r.URL.Query().Get("date_from"),
 		"date_to":   r.URL.Query().Get("date_to"),
 		"type":      r.URL.Query().Get("type"),
+		"owner":     r.URL.Query().Get("owner"),
+		"group":     r.URL.Query().Get("group"),
+		"in":        r.URL.Query().Get("in"),
+		"deleted":   r.URL.Query().Get("deleted"),
+		"match":     r.URL.Query().Get("match"),
+		"sort":      r.URL.Query().Get("sort"),
+		"order":     r.URL.Query().Get("order"),
 	}
 }
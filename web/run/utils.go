@@ -4,8 +4,11 @@ import (
 	"fmt"
 	"html/template"
 	"net/url"
+	"slices"
 	"strings"
+	"time"
 
+	"github.com/ogefest/findex/models"
 	"github.com/ogefest/findex/version"
 )
 
@@ -65,8 +68,15 @@ func addTrailingSlash(path string) string {
 	return path + "/"
 }
 
-// buildQueryString builds a query string with a new per_page value
-func buildQueryString(data map[string]any, perPage int) template.URL {
+// formatDuration rounds a duration to a tenth of a millisecond
+func formatDuration(d time.Duration) string {
+	return d.Round(100 * time.Microsecond).String()
+}
+
+// baseSearchParams returns the parameters of the current search: the query,
+// the filters except the skip keys, the selected indexes and per_page.
+// The query string builders set or override their own keys on top.
+func baseSearchParams(data map[string]any, skip ...string) url.Values {
 	params := url.Values{}
 
 	if q, ok := data["Query"].(string); ok && q != "" {
@@ -75,7 +85,7 @@ func buildQueryString(data map[string]any, perPage int) template.URL {
 
 	if fp, ok := data["FilterParams"].(map[string]string); ok {
 		for key, val := range fp {
-			if val != "" {
+			if val != "" && !slices.Contains(skip, key) {
 				params.Set(key, val)
 			}
 		}
@@ -88,40 +98,72 @@ func buildQueryString(data map[string]any, perPage int) template.URL {
 		}
 	}
 
+	if pp, ok := data["PerPage"].(int); ok {
+		params.Set("per_page", fmt.Sprintf("%d", pp))
+	}
+
+	return params
+}
+
+// buildQueryString builds a query string with a new per_page value
+func buildQueryString(data map[string]any, perPage int) template.URL {
+	params := baseSearchParams(data)
 	params.Set("per_page", fmt.Sprintf("%d", perPage))
 	params.Set("page", "1") // Reset to page 1 when changing per_page
 
 	return template.URL(params.Encode())
 }
 
-// buildQueryStringPage builds a query string with a new page value
-func buildQueryStringPage(data map[string]any, page int) template.URL {
-	params := url.Values{}
+// buildQueryStringPage builds a query string for the page at a cursor of
+// the current search, the first page when it is empty
+func buildQueryStringPage(data map[string]any, cursor string, page int) template.URL {
+	params := baseSearchParams(data)
+	if cursor != "" {
+		params.Set("cursor", cursor)
+		params.Set("page", fmt.Sprintf("%d", page))
+	}
 
-	if q, ok := data["Query"].(string); ok && q != "" {
-		params.Set("q", q)
+	return template.URL(params.Encode())
+}
+
+// buildQueryStringSort builds a query string with a new sort and order,
+// empty values drop them
+func buildQueryStringSort(data map[string]any, sort, order string) template.URL {
+	params := baseSearchParams(data, "sort", "order")
+	if sort != "" {
+		params.Set("sort", sort)
+	}
+	if order != "" {
+		params.Set("order", order)
 	}
+	params.Set("page", "1") // Reset to page 1 when changing the order
 
-	if fp, ok := data["FilterParams"].(map[string]string); ok {
-		for key, val := range fp {
+	return template.URL(params.Encode())
+}
+
+// buildQueryStringRefine builds a query string narrowing the current search
+// to a facet value, refine replaces the parameters it holds
+func buildQueryStringRefine(data map[string]any, refine url.Values) template.URL {
+	params := baseSearchParams(data)
+	for key, vals := range refine {
+		params.Del(key)
+		for _, val := range vals {
 			if val != "" {
-				params.Set(key, val)
+				params.Add(key, val)
 			}
 		}
 	}
 
-	// Add selected indexes
-	if indexes, ok := data["SelectedIndexes"].([]string); ok {
-		for _, idx := range indexes {
-			params.Add("index[]", idx)
-		}
-	}
-
-	if pp, ok := data["PerPage"].(int); ok {
-		params.Set("per_page", fmt.Sprintf("%d", pp))
-	}
+	return template.URL(params.Encode())
+}
 
-	params.Set("page", fmt.Sprintf("%d", page))
+// highlight escapes text and wraps the spans matched by a search in <mark>
+func highlight(text string, spans []models.Span) template.HTML {
+	return template.HTML(models.Mark(text, spans, "<mark>", "</mark>", template.HTMLEscapeString))
+}
 
-	return template.URL(params.Encode())
+// pathSnippet shortens the directories of a search result to those that
+// matched, the first and the last two
+func pathSnippet(f models.FileRecord) []models.PathPart {
+	return models.PathSnippet(f.Path, f.PathMatches, 2)
 }